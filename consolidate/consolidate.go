@@ -0,0 +1,315 @@
+// Package consolidate merges small outputs into large ones.
+//
+// Every received payment is an output, and spending many of them makes
+// large transactions with high fees, or transactions the wallet can't
+// build at all. A Consolidator periodically counts the small outputs and,
+// when there are enough of them, sweeps them back to the wallet, within
+// the time windows and fee ceilings it's given.
+//
+// Sweeps are first created without being relayed, so their fees can be
+// checked (or just reported in dry-run mode), and then relayed as created.
+package consolidate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Wallet is the subset of *walletrpc.Client used by the Consolidator.
+type Wallet interface {
+	GetAccountAddress(accountIndex uint64) (string, error)
+	GetIncomingTransfers(req walletrpc.IncomingTransfersRequest) ([]walletrpc.IncTransfer, error)
+	SweepAll(req walletrpc.SweepAllRequest) (walletrpc.SweepAllResponse, error)
+	SweepSingle(req walletrpc.SweepSingleRequest) (walletrpc.SweepSingleResponse, error)
+	RelayTx(hex string) (string, error)
+}
+
+// Window is a time of day range, as offsets from midnight. A window whose
+// End is before its Start spans midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w Window) contains(t time.Time) bool {
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.End < w.Start {
+		return offset >= w.Start || offset < w.End
+	}
+	return offset >= w.Start && offset < w.End
+}
+
+// Config holds the configuration of a Consolidator.
+type Config struct {
+	Wallet Wallet
+	// Address receives the sweeps. Defaults to the primary address of the
+	// account swept.
+	Address string
+	// AccountIndex and SubaddrIndices (optional) restrict the outputs swept.
+	AccountIndex   uint64
+	SubaddrIndices []uint64
+	// SmallOutput is the amount under which an output is consolidated.
+	// Defaults to 0.1 XMR.
+	SmallOutput uint64
+	// MinOutputs is the number of small outputs that triggers a
+	// consolidation. Defaults to 20.
+	MinOutputs int
+	// MaxFee (optional) is the total fee a consolidation may pay.
+	MaxFee uint64
+	// MaxFeeRatio (optional) is the fee a consolidation may pay as a
+	// fraction of the amount swept, e.g. 0.01 for 1%.
+	MaxFeeRatio float64
+	// Windows (optional) restricts consolidations to these times of day.
+	Windows []Window
+	// Location of the windows, defaults to UTC.
+	Location *time.Location
+	Priority walletrpc.Priority
+	// DryRun reports the consolidations without relaying them.
+	DryRun bool
+	// Interval between two checks in Run. Defaults to one hour.
+	Interval time.Duration
+	// OnReport (optional) is called by Run after every check.
+	OnReport func(Report)
+	// OnError (optional) is called by Run when a check fails.
+	OnError func(error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Action is what a check did.
+type Action string
+
+// Actions
+const (
+	// ActionNone - not enough small outputs
+	ActionNone Action = "none"
+	// ActionOutsideWindow - the check ran outside the time windows
+	ActionOutsideWindow Action = "outside_window"
+	// ActionFeeTooHigh - the sweep was built, but not relayed because
+	// its fee is over the ceiling
+	ActionFeeTooHigh Action = "fee_too_high"
+	// ActionDryRun - the sweep was built, but not relayed in dry-run mode
+	ActionDryRun Action = "dry_run"
+	// ActionSwept - the sweep was relayed
+	ActionSwept Action = "swept"
+)
+
+// Report is the result of a check.
+type Report struct {
+	Time   time.Time
+	Action Action
+	// Outputs is the number of small outputs found, and Amount their total.
+	Outputs int
+	Amount  uint64
+	// TxHashes of the sweep transactions, relayed or not, and their Fee.
+	TxHashes []string
+	Fee      uint64
+}
+
+// Consolidator sweeps small outputs together.
+type Consolidator struct {
+	cfg Config
+}
+
+// New returns a Consolidator for the configuration.
+func New(cfg Config) *Consolidator {
+	if cfg.SmallOutput == 0 {
+		cfg.SmallOutput = 100000000000
+	}
+	if cfg.MinOutputs <= 0 {
+		cfg.MinOutputs = 20
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Consolidator{cfg: cfg}
+}
+
+// Analyse counts the unspent outputs under the SmallOutput amount that a
+// sweep would take: unlocked outputs of AccountIndex and SubaddrIndices,
+// frozen outputs excluded. Wallets older than v0.15 don't tell whether an
+// output is unlocked, so none is counted.
+func (c *Consolidator) Analyse() (outputs int, amount uint64, err error) {
+	transfers, err := c.cfg.Wallet.GetIncomingTransfers(walletrpc.IncomingTransfersRequest{
+		TransferType:   walletrpc.TransferAvailable,
+		AccountIndex:   c.cfg.AccountIndex,
+		SubaddrIndices: c.cfg.SubaddrIndices,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, in := range transfers {
+		if !in.Spent && !in.Frozen && in.Unlocked && in.Amount < c.cfg.SmallOutput && c.swept(in.SubaddrIndex) {
+			outputs++
+			amount += in.Amount
+		}
+	}
+	return outputs, amount, nil
+}
+
+// swept reports whether the outputs of a subaddress are swept.
+func (c *Consolidator) swept(index walletrpc.SubaddressIndex) bool {
+	if index.Major != c.cfg.AccountIndex {
+		return false
+	}
+	if len(c.cfg.SubaddrIndices) == 0 {
+		return true
+	}
+	for _, minor := range c.cfg.SubaddrIndices {
+		if index.Minor == minor {
+			return true
+		}
+	}
+	return false
+}
+
+// Check consolidates the small outputs if there are enough of them and the
+// time and fees allow it.
+func (c *Consolidator) Check() (Report, error) {
+	r := Report{Time: c.cfg.Now()}
+	if !c.inWindow(r.Time) {
+		r.Action = ActionOutsideWindow
+		return r, nil
+	}
+	var err error
+	r.Outputs, r.Amount, err = c.Analyse()
+	if err != nil {
+		return r, err
+	}
+	if r.Outputs < c.cfg.MinOutputs {
+		r.Action = ActionNone
+		return r, nil
+	}
+
+	address, err := c.address()
+	if err != nil {
+		return r, err
+	}
+	resp, err := c.cfg.Wallet.SweepAll(walletrpc.SweepAllRequest{
+		Address:        address,
+		AccountIndex:   c.cfg.AccountIndex,
+		SubaddrIndices: c.cfg.SubaddrIndices,
+		Priority:       c.cfg.Priority,
+		BelowAmount:    c.cfg.SmallOutput,
+		DoNotRelay:     true,
+		GetTxMetadata:  true,
+	})
+	if err != nil {
+		return r, err
+	}
+	r.TxHashes = resp.TxHashList
+	var swept uint64
+	for i := range resp.FeeList {
+		r.Fee += resp.FeeList[i]
+	}
+	for i := range resp.AmountList {
+		swept += resp.AmountList[i]
+	}
+	return c.relay(r, swept, resp.TxMetadataList)
+}
+
+// SweepOutputs sweeps the outputs with the given key images one by one,
+// e.g. to move large outputs received on a subaddress, with the same fee
+// ceilings and dry-run mode as Check. The windows don't apply.
+func (c *Consolidator) SweepOutputs(keyImages []string) (Report, error) {
+	r := Report{Time: c.cfg.Now(), Outputs: len(keyImages)}
+	address, err := c.address()
+	if err != nil {
+		return r, err
+	}
+	var swept uint64
+	var metadata []string
+	for _, ki := range keyImages {
+		resp, err := c.cfg.Wallet.SweepSingle(walletrpc.SweepSingleRequest{
+			Address:       address,
+			KeyImage:      ki,
+			Priority:      c.cfg.Priority,
+			DoNotRelay:    true,
+			GetTxMetadata: true,
+		})
+		if err != nil {
+			return r, err
+		}
+		r.TxHashes = append(r.TxHashes, resp.TxHash)
+		r.Fee += resp.Fee
+		r.Amount += resp.Amount + resp.Fee
+		swept += resp.Amount
+		metadata = append(metadata, resp.TxMetadata)
+	}
+	return c.relay(r, swept, metadata)
+}
+
+// relay relays the transactions of a report unless the fee or the dry-run
+// mode forbid it.
+func (c *Consolidator) relay(r Report, swept uint64, metadata []string) (Report, error) {
+	if c.cfg.MaxFee > 0 && r.Fee > c.cfg.MaxFee ||
+		c.cfg.MaxFeeRatio > 0 && float64(r.Fee) > c.cfg.MaxFeeRatio*float64(swept+r.Fee) {
+		r.Action = ActionFeeTooHigh
+		return r, nil
+	}
+	if c.cfg.DryRun {
+		r.Action = ActionDryRun
+		return r, nil
+	}
+	if len(metadata) != len(r.TxHashes) {
+		return r, errors.New("consolidate: the wallet returned no tx_metadata")
+	}
+	for i, m := range metadata {
+		if _, err := c.cfg.Wallet.RelayTx(m); err != nil {
+			return r, fmt.Errorf("consolidate: relay %v: %v", r.TxHashes[i], err)
+		}
+	}
+	r.Action = ActionSwept
+	return r, nil
+}
+
+func (c *Consolidator) inWindow(t time.Time) bool {
+	if len(c.cfg.Windows) == 0 {
+		return true
+	}
+	t = t.In(c.cfg.Location)
+	for _, w := range c.cfg.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Consolidator) address() (string, error) {
+	if c.cfg.Address != "" {
+		return c.cfg.Address, nil
+	}
+	return c.cfg.Wallet.GetAccountAddress(c.cfg.AccountIndex)
+}
+
+// Run checks every Interval until the context is done.
+func (c *Consolidator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		r, err := c.Check()
+		if err != nil && c.cfg.OnError != nil {
+			c.cfg.OnError(err)
+		}
+		if err == nil && c.cfg.OnReport != nil {
+			c.cfg.OnReport(r)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
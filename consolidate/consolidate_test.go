@@ -0,0 +1,195 @@
+package consolidate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWallet struct {
+	transfers []walletrpc.IncTransfer
+	fee       uint64
+	sweeps    []walletrpc.SweepAllRequest
+	relayed   []string
+}
+
+func (w *testWallet) GetAccountAddress(accountIndex uint64) (string, error) {
+	return fmt.Sprintf("primary%v", accountIndex), nil
+}
+
+func (w *testWallet) GetIncomingTransfers(req walletrpc.IncomingTransfersRequest) ([]walletrpc.IncTransfer, error) {
+	var transfers []walletrpc.IncTransfer
+	for _, in := range w.transfers {
+		if in.SubaddrIndex.Major != req.AccountIndex {
+			continue
+		}
+		if len(req.SubaddrIndices) > 0 {
+			found := false
+			for _, minor := range req.SubaddrIndices {
+				found = found || in.SubaddrIndex.Minor == minor
+			}
+			if !found {
+				continue
+			}
+		}
+		transfers = append(transfers, in)
+	}
+	return transfers, nil
+}
+
+func (w *testWallet) SweepAll(req walletrpc.SweepAllRequest) (resp walletrpc.SweepAllResponse, err error) {
+	w.sweeps = append(w.sweeps, req)
+	var amount uint64
+	for _, in := range w.transfers {
+		if in.Amount < req.BelowAmount && in.SubaddrIndex.Major == req.AccountIndex {
+			amount += in.Amount
+		}
+	}
+	resp.TxHashList = []string{"sweep"}
+	resp.AmountList = []uint64{amount - w.fee}
+	resp.FeeList = []uint64{w.fee}
+	if req.GetTxMetadata {
+		resp.TxMetadataList = []string{"meta-sweep"}
+	}
+	return
+}
+
+func (w *testWallet) SweepSingle(req walletrpc.SweepSingleRequest) (resp walletrpc.SweepSingleResponse, err error) {
+	for _, in := range w.transfers {
+		if in.KeyImage == req.KeyImage {
+			resp.TxHash = "single-" + req.KeyImage
+			resp.Amount = in.Amount - w.fee
+			resp.Fee = w.fee
+			resp.TxMetadata = "meta-" + resp.TxHash
+			return
+		}
+	}
+	return resp, &walletrpc.WalletError{Code: walletrpc.ErrWrongKeyImage, Message: "unknown key image"}
+}
+
+func (w *testWallet) RelayTx(hex string) (string, error) {
+	w.relayed = append(w.relayed, hex)
+	return hex, nil
+}
+
+func newWallet(small int) *testWallet {
+	w := &testWallet{fee: 1000}
+	for i := 0; i < small; i++ {
+		w.transfers = append(w.transfers, walletrpc.IncTransfer{Amount: 10000, KeyImage: fmt.Sprintf("ki%v", i), Unlocked: true})
+	}
+	w.transfers = append(w.transfers, walletrpc.IncTransfer{Amount: 1e12, KeyImage: "big", Unlocked: true})
+	return w
+}
+
+func TestCheck(t *testing.T) {
+	w := newWallet(5)
+	for i := range w.transfers {
+		w.transfers[i].SubaddrIndex.Major = 1
+	}
+	c := New(Config{Wallet: w, SmallOutput: 1e9, MinOutputs: 5, AccountIndex: 1})
+
+	r, err := c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionSwept, r.Action)
+	assert.Equal(t, 5, r.Outputs)
+	assert.Equal(t, uint64(50000), r.Amount)
+	assert.Equal(t, uint64(1000), r.Fee)
+	assert.Equal(t, []string{"meta-sweep"}, w.relayed)
+	assert.True(t, w.sweeps[0].DoNotRelay)
+	assert.Equal(t, "primary1", w.sweeps[0].Address, "swept to the same account")
+	assert.Equal(t, uint64(1), w.sweeps[0].AccountIndex)
+
+	w.transfers = w.transfers[1:]
+	r, err = c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionNone, r.Action)
+}
+
+func TestAnalyse(t *testing.T) {
+	w := newWallet(3)
+	w.transfers = append(w.transfers,
+		walletrpc.IncTransfer{Amount: 10000, SubaddrIndex: walletrpc.SubaddressIndex{Major: 1}, Unlocked: true},
+		walletrpc.IncTransfer{Amount: 10000, SubaddrIndex: walletrpc.SubaddressIndex{Major: 0, Minor: 2}, Unlocked: true},
+		walletrpc.IncTransfer{Amount: 10000},
+		walletrpc.IncTransfer{Amount: 10000, Unlocked: true, Frozen: true},
+	)
+	c := New(Config{Wallet: w, SmallOutput: 1e9})
+	outputs, amount, err := c.Analyse()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, outputs, "other account, locked and frozen outputs excluded")
+	assert.Equal(t, uint64(40000), amount)
+
+	c = New(Config{Wallet: w, SmallOutput: 1e9, SubaddrIndices: []uint64{2}})
+	outputs, _, _ = c.Analyse()
+	assert.Equal(t, 1, outputs)
+	c = New(Config{Wallet: w, SmallOutput: 1e9, AccountIndex: 1})
+	outputs, _, _ = c.Analyse()
+	assert.Equal(t, 1, outputs)
+}
+
+func TestCheckFeeCeiling(t *testing.T) {
+	w := newWallet(5)
+	c := New(Config{Wallet: w, SmallOutput: 1e9, MinOutputs: 5, MaxFeeRatio: 0.01})
+	r, err := c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionFeeTooHigh, r.Action)
+	assert.Empty(t, w.relayed)
+
+	c = New(Config{Wallet: w, SmallOutput: 1e9, MinOutputs: 5, MaxFee: 999})
+	r, err = c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionFeeTooHigh, r.Action)
+
+	c = New(Config{Wallet: w, SmallOutput: 1e9, MinOutputs: 5, DryRun: true})
+	r, err = c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionDryRun, r.Action)
+	assert.Equal(t, []string{"sweep"}, r.TxHashes)
+	assert.Empty(t, w.relayed)
+}
+
+func TestCheckWindows(t *testing.T) {
+	w := newWallet(5)
+	now := time.Date(2020, 1, 1, 23, 30, 0, 0, time.UTC)
+	c := New(Config{
+		Wallet:      w,
+		SmallOutput: 1e9,
+		MinOutputs:  5,
+		Windows:     []Window{{Start: 2 * time.Hour, End: 4 * time.Hour}},
+		Now:         func() time.Time { return now },
+	})
+	r, err := c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionOutsideWindow, r.Action)
+
+	// across midnight
+	c.cfg.Windows = []Window{{Start: 23 * time.Hour, End: time.Hour}}
+	r, err = c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionSwept, r.Action)
+
+	// 23:30 UTC is 00:30 in Paris
+	paris := time.FixedZone("CET", 3600)
+	c.cfg.Windows = []Window{{Start: 0, End: time.Hour}}
+	c.cfg.Location = paris
+	r, err = c.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, ActionSwept, r.Action)
+}
+
+func TestSweepOutputs(t *testing.T) {
+	w := newWallet(2)
+	c := New(Config{Wallet: w, Address: "cold"})
+	r, err := c.SweepOutputs([]string{"ki0", "big"})
+	assert.NoError(t, err)
+	assert.Equal(t, ActionSwept, r.Action)
+	assert.Equal(t, []string{"single-ki0", "single-big"}, r.TxHashes)
+	assert.Equal(t, uint64(2000), r.Fee)
+	assert.Equal(t, []string{"meta-single-ki0", "meta-single-big"}, w.relayed)
+
+	_, err = c.SweepOutputs([]string{"nope"})
+	assert.Error(t, err)
+}
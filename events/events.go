@@ -0,0 +1,86 @@
+// Package events turns the transfers of a wallet into a stream of events.
+//
+// A Watcher polls monero-wallet-rpc incrementally and emits an Event each
+// time a transfer is received, sent, confirmed, unlocked, fails or is
+// undone by a chain reorganisation.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Kind is the type of an Event.
+type Kind int
+
+const (
+	// Received - an incoming transfer was seen for the first time (mempool or block)
+	Received Kind = iota + 1
+	// ConfirmationsChanged - the number of confirmations of a transfer changed
+	ConfirmationsChanged
+	// Confirmed - a transfer reached the configured number of confirmations
+	Confirmed
+	// Unlocked - an incoming transfer became spendable
+	Unlocked
+	// Sent - an outgoing transfer was seen for the first time
+	Sent
+	// Failed - an outgoing transfer failed
+	Failed
+	// Reorged - the block holding the transfer was replaced, or the
+	// transfer disappeared from the wallet
+	Reorged
+)
+
+var kindNames = map[Kind]string{
+	Received:             "received",
+	ConfirmationsChanged: "confirmations_changed",
+	Confirmed:            "confirmed",
+	Unlocked:             "unlocked",
+	Sent:                 "sent",
+	Failed:               "failed",
+	Reorged:              "reorged",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// MarshalJSON encodes the kind as its name.
+func (k Kind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+// UnmarshalJSON decodes a kind name.
+func (k *Kind) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	for kind, name := range kindNames {
+		if name == s {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("events: unknown kind %q", s)
+}
+
+// Event is a change of a wallet transfer.
+type Event struct {
+	Kind Kind `json:"kind"`
+	// Transfer is the transfer as last reported by the wallet.
+	Transfer walletrpc.Transfer `json:"transfer"`
+	// Confirmations of the transfer when the event was emitted.
+	Confirmations uint64 `json:"confirmations"`
+	// Height is the wallet height when the event was emitted.
+	Height uint64 `json:"height"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%v %v %v (%v confirmations)", e.Kind, e.Transfer.TxID, walletrpc.XMRToDecimal(e.Transfer.Amount), e.Confirmations)
+}
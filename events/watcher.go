@@ -0,0 +1,497 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/internal/atomicfile"
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Wallet is the subset of *walletrpc.Client used by the Watcher.
+type Wallet interface {
+	GetHeight() (uint64, error)
+	GetTransfers(req walletrpc.GetTransfersRequest) (walletrpc.GetTransfersResponse, error)
+}
+
+// BlockSource is the subset of a daemon *walletrpc.Client used by the
+// Watcher to detect reorgs.
+type BlockSource interface {
+	GetBlockByHeight(height uint) (walletrpc.Block, error)
+}
+
+const (
+	// spendableAge is CRYPTONOTE_DEFAULT_TX_SPENDABLE_AGE
+	spendableAge = 10
+	// maxBlockNumber is CRYPTONOTE_MAX_BLOCK_NUMBER, unlock times
+	// above it are unix timestamps
+	maxBlockNumber = 500000000
+	// lockedTxAllowedDeltaSeconds is CRYPTONOTE_LOCKED_TX_ALLOWED_DELTA_SECONDS_V2
+	lockedTxAllowedDeltaSeconds = 120
+)
+
+// Config holds the configuration of a Watcher.
+type Config struct {
+	Wallet Wallet
+	// Daemon (optional) is used to follow block hashes. Without it, reorgs
+	// are only noticed once the wallet reports a transfer at another height.
+	Daemon BlockSource
+	// Store (optional) persists the checkpoint the Watcher resumes from.
+	Store Store
+	// AccountIndex is the wallet account to watch.
+	AccountIndex uint64
+	// Confirmations is the target of the Confirmed event. Defaults to 10.
+	Confirmations uint64
+	// ReorgDepth is the number of blocks followed for reorgs. Transfers
+	// deeper than that are considered final. Defaults to 20.
+	ReorgDepth uint64
+	// StartHeight is where a Watcher without checkpoint starts. By default
+	// only the last ReorgDepth blocks are looked at.
+	StartHeight uint64
+	// PollInterval is the delay between polls in Run. Defaults to 10 seconds.
+	PollInterval time.Duration
+	// Buffer is the capacity of the events channel.
+	Buffer int
+	// OnError is called by Run when a poll fails.
+	OnError func(error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Checkpoint is the persisted state of a Watcher.
+type Checkpoint struct {
+	// Height is the wallet height of the last completed poll.
+	Height    uint64            `json:"height"`
+	Blocks    []BlockHash       `json:"blocks,omitempty"`
+	Transfers []TrackedTransfer `json:"transfers,omitempty"`
+}
+
+// BlockHash is the hash of a block at a height.
+type BlockHash struct {
+	Height uint64 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// TrackedTransfer is a transfer followed by the Watcher and the events
+// already emitted for it.
+type TrackedTransfer struct {
+	Key           string             `json:"key"`
+	Transfer      walletrpc.Transfer `json:"transfer"`
+	Confirmations uint64             `json:"confirmations"`
+	Confirmed     bool               `json:"confirmed,omitempty"`
+	Unlocked      bool               `json:"unlocked,omitempty"`
+	Failed        bool               `json:"failed,omitempty"`
+	// Final transfers emit no more events, they are kept until they
+	// fall out of the polled range so they aren't reported twice.
+	Final bool `json:"final,omitempty"`
+}
+
+func (t *TrackedTransfer) incoming() bool {
+	return t.Transfer.Type == "in" || t.Transfer.Type == "pool"
+}
+
+// Store persists the checkpoint of a Watcher.
+type Store interface {
+	Load() (Checkpoint, error)
+	Save(Checkpoint) error
+}
+
+// FileStore is a Store backed by a JSON file.
+type FileStore string
+
+// Load implements Store. A missing file is an empty checkpoint.
+func (path FileStore) Load() (cp Checkpoint, err error) {
+	data, err := ioutil.ReadFile(string(path))
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(data, &cp)
+	return
+}
+
+// Save implements Store. The file is replaced atomically.
+func (path FileStore) Save(cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(string(path), data)
+}
+
+// Watcher polls a wallet and emits Events.
+//
+// Events are delivered at least once: the checkpoint is only saved after
+// all the events of a poll have been received, so a restart may repeat the
+// events of an interrupted poll.
+type Watcher struct {
+	cfg Config
+	out chan Event
+
+	// serializes polls
+	mu     sync.Mutex
+	height uint64
+	blocks map[uint64]string
+	state  map[string]TrackedTransfer
+}
+
+// New loads the checkpoint and returns a Watcher.
+func New(cfg Config) (*Watcher, error) {
+	if cfg.Confirmations == 0 {
+		cfg.Confirmations = 10
+	}
+	if cfg.ReorgDepth == 0 {
+		cfg.ReorgDepth = 20
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 10 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	w := &Watcher{
+		cfg:    cfg,
+		out:    make(chan Event, cfg.Buffer),
+		blocks: make(map[uint64]string),
+		state:  make(map[string]TrackedTransfer),
+	}
+	if cfg.Store != nil {
+		cp, err := cfg.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+		w.height = cp.Height
+		for _, b := range cp.Blocks {
+			w.blocks[b.Height] = b.Hash
+		}
+		for _, t := range cp.Transfers {
+			w.state[t.Key] = t
+		}
+	}
+	return w, nil
+}
+
+// Events returns the event channel. It is closed when Run returns.
+func (w *Watcher) Events() <-chan Event {
+	return w.out
+}
+
+// Run polls until the context is done, then closes the events channel.
+// A poll in progress is abandoned (and repeated after a restart) when the
+// context is cancelled while it waits on the channel.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.out)
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.Poll(ctx); err != nil && ctx.Err() == nil && w.cfg.OnError != nil {
+			w.cfg.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll queries the wallet once and sends the resulting events.
+func (w *Watcher) Poll(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	height, err := w.cfg.Wallet.GetHeight()
+	if err != nil {
+		return err
+	}
+
+	// work on copies, committed once every event is delivered
+	blocks := make(map[uint64]string, len(w.blocks))
+	for h, hash := range w.blocks {
+		blocks[h] = hash
+	}
+	state := make(map[string]TrackedTransfer, len(w.state))
+	for k, t := range w.state {
+		state[k] = t
+	}
+
+	fork, err := w.followBlocks(blocks, height)
+	if err != nil {
+		return err
+	}
+
+	minHeight := w.queryHeight(state, height, fork)
+	req := walletrpc.GetTransfersRequest{
+		In:             true,
+		Out:            true,
+		Pending:        true,
+		Failed:         true,
+		Pool:           true,
+		FilterByHeight: true,
+		MaxHeight:      height,
+		AccountIndex:   w.cfg.AccountIndex,
+	}
+	// min_height is exclusive
+	if minHeight > 0 {
+		req.MinHeight = minHeight - 1
+	}
+	resp, err := w.cfg.Wallet.GetTransfers(req)
+	if err != nil {
+		return err
+	}
+
+	var events []Event
+	emit := func(kind Kind, t TrackedTransfer) {
+		events = append(events, Event{
+			Kind:          kind,
+			Transfer:      t.Transfer,
+			Confirmations: t.Confirmations,
+			Height:        height,
+		})
+	}
+
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	reorged := make(map[string]bool)
+	if fork > 0 {
+		for _, key := range keys {
+			t := state[key]
+			if t.Final || t.Transfer.Height < fork || t.Transfer.Height == 0 {
+				continue
+			}
+			emit(Reorged, t)
+			reorged[key] = true
+			t.Confirmations, t.Confirmed, t.Unlocked = 0, false, false
+			state[key] = t
+		}
+	}
+
+	seen := make(map[string]bool)
+	groups := [][]walletrpc.Transfer{resp.In, resp.Pool, resp.Out, resp.Pending, resp.Failed}
+	for _, group := range groups {
+		for _, tr := range group {
+			key := transferKey(tr)
+			seen[key] = true
+			t, known := state[key]
+			if known && t.Final {
+				continue
+			}
+			prevHeight := t.Transfer.Height
+			t.Key, t.Transfer = key, tr
+
+			var confirmations uint64
+			if (tr.Type == "in" || tr.Type == "out") && tr.Height > 0 && height > tr.Height {
+				confirmations = height - tr.Height
+			}
+
+			switch {
+			case !known && t.incoming():
+				emit(Received, t)
+			case !known && tr.Type != "failed":
+				emit(Sent, t)
+			case known && prevHeight > 0 && prevHeight != tr.Height && !reorged[key]:
+				// moved to another block, or back to the pool
+				t.Confirmations = confirmations
+				emit(Reorged, t)
+				t.Confirmed, t.Unlocked = false, false
+			}
+
+			if tr.Type == "failed" {
+				if !t.Failed {
+					t.Failed, t.Final = true, true
+					emit(Failed, t)
+				}
+				state[key] = t
+				continue
+			}
+
+			if confirmations != t.Confirmations && !t.Confirmed {
+				t.Confirmations = confirmations
+				emit(ConfirmationsChanged, t)
+			}
+			t.Confirmations = confirmations
+			if !t.Confirmed && confirmations >= w.cfg.Confirmations {
+				t.Confirmed = true
+				emit(Confirmed, t)
+			}
+			if t.incoming() && !t.Unlocked && w.unlocked(tr, confirmations, height) {
+				t.Unlocked = true
+				emit(Unlocked, t)
+			}
+			t.Final = t.Confirmed && (t.Unlocked || !t.incoming()) && confirmations > w.cfg.ReorgDepth
+			state[key] = t
+		}
+	}
+
+	for _, key := range keys {
+		t := state[key]
+		if seen[key] {
+			continue
+		}
+		// not reported anymore although inside the polled range
+		if !t.Final && (t.Transfer.Height == 0 || t.Transfer.Height >= minHeight) {
+			emit(Reorged, t)
+		}
+		delete(state, key)
+	}
+
+	for _, e := range events {
+		select {
+		case w.out <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	w.height, w.blocks, w.state = height, blocks, state
+	return w.save()
+}
+
+// Checkpoint returns the current state of the watcher.
+func (w *Watcher) Checkpoint() Checkpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkpoint()
+}
+
+func (w *Watcher) checkpoint() Checkpoint {
+	cp := Checkpoint{Height: w.height}
+	for h, hash := range w.blocks {
+		cp.Blocks = append(cp.Blocks, BlockHash{h, hash})
+	}
+	sort.Slice(cp.Blocks, func(i, j int) bool { return cp.Blocks[i].Height < cp.Blocks[j].Height })
+	for _, t := range w.state {
+		cp.Transfers = append(cp.Transfers, t)
+	}
+	sort.Slice(cp.Transfers, func(i, j int) bool { return cp.Transfers[i].Key < cp.Transfers[j].Key })
+	return cp
+}
+
+func (w *Watcher) save() error {
+	if w.cfg.Store == nil {
+		return nil
+	}
+	return w.cfg.Store.Save(w.checkpoint())
+}
+
+// queryHeight is the lowest height that may hold a transfer that still
+// needs events.
+func (w *Watcher) queryHeight(state map[string]TrackedTransfer, height, fork uint64) uint64 {
+	min := uint64(0)
+	if height > w.cfg.ReorgDepth {
+		min = height - w.cfg.ReorgDepth
+	}
+	if w.height == 0 && len(state) == 0 && w.cfg.StartHeight > 0 && w.cfg.StartHeight < min {
+		min = w.cfg.StartHeight
+	}
+	if fork > 0 && fork < min {
+		min = fork
+	}
+	for _, t := range state {
+		if !t.Final && t.Transfer.Height > 0 && t.Transfer.Height < min {
+			min = t.Transfer.Height
+		}
+	}
+	return min
+}
+
+// followBlocks updates the known block hashes up to the wallet height and
+// returns the lowest height whose block changed, or 0.
+func (w *Watcher) followBlocks(blocks map[uint64]string, height uint64) (fork uint64, err error) {
+	if w.cfg.Daemon == nil || height == 0 {
+		return 0, nil
+	}
+	top := height - 1
+	var maxKnown, minKnown uint64
+	for h := range blocks {
+		if h > maxKnown {
+			maxKnown = h
+		}
+		if minKnown == 0 || h < minKnown {
+			minKnown = h
+		}
+	}
+	// the chain got shorter
+	for h := maxKnown; h > top && len(blocks) > 0; h-- {
+		if _, ok := blocks[h]; ok {
+			delete(blocks, h)
+			fork = h
+		}
+	}
+	if maxKnown > top {
+		maxKnown = top
+	}
+	// walk back from the newest known block until the hashes match
+	if len(blocks) > 0 {
+		for h := maxKnown; h >= minKnown && h > 0; h-- {
+			old, ok := blocks[h]
+			if !ok {
+				break
+			}
+			b, err := w.cfg.Daemon.GetBlockByHeight(uint(h))
+			if err != nil {
+				return 0, err
+			}
+			if b.BlockHeader.Hash == old {
+				break
+			}
+			blocks[h] = b.BlockHeader.Hash
+			fork = h
+		}
+	}
+
+	start := maxKnown + 1
+	if len(blocks) == 0 || start+w.cfg.ReorgDepth <= top {
+		start = 0
+		if top+1 > w.cfg.ReorgDepth {
+			start = top + 1 - w.cfg.ReorgDepth
+		}
+	}
+	for h := start; h <= top; h++ {
+		b, err := w.cfg.Daemon.GetBlockByHeight(uint(h))
+		if err != nil {
+			return 0, err
+		}
+		if prev, ok := blocks[h-1]; ok && h > 0 && b.BlockHeader.PrevHash != prev {
+			return 0, fmt.Errorf("events: block %v does not follow %v, the chain changed during the poll", h, prev)
+		}
+		blocks[h] = b.BlockHeader.Hash
+	}
+	for h := range blocks {
+		if h+w.cfg.ReorgDepth <= top {
+			delete(blocks, h)
+		}
+	}
+	return fork, nil
+}
+
+// unlocked mirrors wallet2::is_transfer_unlocked.
+func (w *Watcher) unlocked(tr walletrpc.Transfer, confirmations, height uint64) bool {
+	if tr.Type != "in" || confirmations < spendableAge {
+		return false
+	}
+	if tr.UnlockTime < maxBlockNumber {
+		return tr.UnlockTime <= height
+	}
+	return tr.UnlockTime <= uint64(w.cfg.Now().Unix())+lockedTxAllowedDeltaSeconds
+}
+
+func transferKey(tr walletrpc.Transfer) string {
+	switch tr.Type {
+	case "in", "pool":
+		return fmt.Sprintf("in:%v:%v:%v", tr.TxID, tr.SubaddrIndex.Major, tr.SubaddrIndex.Minor)
+	}
+	return "out:" + tr.TxID
+}
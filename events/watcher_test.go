@@ -0,0 +1,174 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testChain is an in-memory wallet and daemon.
+type testChain struct {
+	hashes    []string
+	transfers walletrpc.GetTransfersResponse
+}
+
+func (c *testChain) mine(n int, tag string) {
+	for i := 0; i < n; i++ {
+		c.hashes = append(c.hashes, fmt.Sprintf("%v-%v", tag, len(c.hashes)))
+	}
+}
+
+func (c *testChain) GetHeight() (uint64, error) {
+	return uint64(len(c.hashes)), nil
+}
+
+func (c *testChain) GetTransfers(req walletrpc.GetTransfersRequest) (resp walletrpc.GetTransfersResponse, err error) {
+	filter := func(in []walletrpc.Transfer) (out []walletrpc.Transfer) {
+		for _, t := range in {
+			if t.Height > req.MinHeight {
+				out = append(out, t)
+			}
+		}
+		return
+	}
+	resp.In = filter(c.transfers.In)
+	resp.Out = filter(c.transfers.Out)
+	resp.Pool = c.transfers.Pool
+	resp.Pending = c.transfers.Pending
+	resp.Failed = c.transfers.Failed
+	return
+}
+
+func (c *testChain) GetBlockByHeight(height uint) (b walletrpc.Block, err error) {
+	if int(height) >= len(c.hashes) {
+		return b, fmt.Errorf("no block %v", height)
+	}
+	b.BlockHeader.Hash = c.hashes[height]
+	if height > 0 {
+		b.BlockHeader.PrevHash = c.hashes[height-1]
+	}
+	return
+}
+
+func poll(t *testing.T, w *Watcher) (kinds []string) {
+	done := make(chan error, 1)
+	go func() { done <- w.Poll(context.Background()) }()
+	for {
+		select {
+		case e := <-w.Events():
+			kinds = append(kinds, fmt.Sprintf("%v:%v", e.Kind, e.Transfer.TxID))
+		case err := <-done:
+			assert.NoError(t, err)
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("poll timed out")
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	c := &testChain{}
+	c.mine(100, "a")
+	store := FileStore(filepath.Join(t.TempDir(), "watcher.json"))
+	cfg := Config{
+		Wallet:        c,
+		Daemon:        c,
+		Store:         store,
+		Confirmations: 3,
+		ReorgDepth:    5,
+	}
+	w, err := New(cfg)
+	assert.NoError(t, err)
+	assert.Empty(t, poll(t, w))
+
+	c.transfers.Pool = []walletrpc.Transfer{{TxID: "r1", Type: "pool", Amount: 5}}
+	c.transfers.Pending = []walletrpc.Transfer{{TxID: "s1", Type: "pending", Amount: 7}}
+	assert.Equal(t, []string{"received:r1", "sent:s1"}, poll(t, w))
+	assert.Empty(t, poll(t, w))
+
+	c.transfers.Pool, c.transfers.Pending = nil, nil
+	c.transfers.In = []walletrpc.Transfer{{TxID: "r1", Type: "in", Amount: 5, Height: 100}}
+	c.transfers.Out = []walletrpc.Transfer{{TxID: "s1", Type: "out", Amount: 7, Height: 100}}
+	c.mine(1, "a")
+	assert.Equal(t, []string{"confirmations_changed:r1", "confirmations_changed:s1"}, poll(t, w))
+
+	// resume from the checkpoint
+	w, err = New(cfg)
+	assert.NoError(t, err)
+	c.mine(2, "a")
+	assert.Equal(t, []string{
+		"confirmations_changed:r1", "confirmed:r1",
+		"confirmations_changed:s1", "confirmed:s1",
+	}, poll(t, w))
+
+	// replace the blocks from 100: both transfers are reorged and mined again
+	c.hashes = c.hashes[:100]
+	c.mine(4, "b")
+	c.transfers.In[0].Height = 101
+	c.transfers.Out[0].Height = 101
+	events := poll(t, w)
+	assert.Equal(t, []string{"reorged:r1", "reorged:s1"}, events[:2])
+	assert.Contains(t, events, "confirmed:r1")
+	assert.Contains(t, events, "confirmed:s1")
+
+	c.transfers.Failed = []walletrpc.Transfer{{TxID: "s2", Type: "failed"}}
+	assert.Equal(t, []string{"failed:s2"}, poll(t, w))
+
+	c.mine(8, "b")
+	assert.Equal(t, []string{"unlocked:r1"}, poll(t, w))
+
+	// deep enough: the transfers are final and dropped
+	c.mine(5, "b")
+	assert.Empty(t, poll(t, w))
+	c.mine(1, "b")
+	assert.Empty(t, poll(t, w))
+	cp := w.Checkpoint()
+	assert.Equal(t, uint64(118), cp.Height)
+	assert.Len(t, cp.Blocks, 5)
+	for _, tr := range cp.Transfers {
+		assert.True(t, tr.Final, tr.Key)
+	}
+}
+
+func TestWatcherVanishedTransfer(t *testing.T) {
+	c := &testChain{}
+	c.mine(10, "a")
+	w, err := New(Config{Wallet: c})
+	assert.NoError(t, err)
+	c.transfers.Pool = []walletrpc.Transfer{{TxID: "r1", Type: "pool"}}
+	assert.Equal(t, []string{"received:r1"}, poll(t, w))
+	c.transfers.Pool = nil
+	assert.Equal(t, []string{"reorged:r1"}, poll(t, w))
+}
+
+func TestWatcherRun(t *testing.T) {
+	c := &testChain{}
+	c.mine(10, "a")
+	c.transfers.Pool = []walletrpc.Transfer{{TxID: "r1", Type: "pool"}}
+	w, err := New(Config{Wallet: c, PollInterval: time.Millisecond})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	e := <-w.Events()
+	assert.Equal(t, Received, e.Kind)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+}
+
+func TestKindJSON(t *testing.T) {
+	b, err := ConfirmationsChanged.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `"confirmations_changed"`, string(b))
+	var k Kind
+	assert.NoError(t, k.UnmarshalJSON(b))
+	assert.Equal(t, ConfirmationsChanged, k)
+	assert.Error(t, k.UnmarshalJSON([]byte(`"nope"`)))
+}
@@ -0,0 +1,439 @@
+// Package failover spreads the daemon calls over a few monerod nodes.
+//
+// Check asks every node for its height with get_info, timing the answer.
+// A node is healthy when it answers within Timeout and its height is
+// within MaxLag blocks of the median height of the nodes answering, the
+// lower of the two middle ones for an even number, so that a single node
+// claiming a height far ahead can't pass for the best one, even against a
+// single other node; the healthy nodes are ranked by latency. With
+// CrossCheck, the nodes must also agree on the hash of their last common
+// block, and those that don't side with the majority are deemed forked.
+//
+// Calls go to the best node, and to the next one when a node fails to
+// answer, which is then deemed unhealthy until the next Check. A wallet
+// whose daemon turns unhealthy is switched to the best node with
+// set_daemon.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// ErrNoNode is returned when no node is healthy.
+var ErrNoNode = errors.New("failover: no healthy node")
+
+// ForkError is the reason a node is deemed forked: its block at Height has
+// Hash where the other nodes have Want.
+type ForkError struct {
+	Address string
+	Height  uint64
+	Hash    string
+	Want    string
+}
+
+func (e *ForkError) Error() string {
+	return fmt.Sprintf("failover: %v: block %v is %v, not %v", e.Address, e.Height, e.Hash, e.Want)
+}
+
+// Node is a monerod node.
+type Node struct {
+	// Address is the host:port of the node, given to the wallet.
+	Address string
+	// Client (optional) is a client of the node. Defaults to a client of
+	// http://Address/json_rpc.
+	Client *walletrpc.Client
+	// Trusted tells the wallet whether the node is trusted.
+	Trusted bool
+}
+
+// Wallet is the subset of *walletrpc.Client switched between the nodes.
+type Wallet interface {
+	SetDaemon(req walletrpc.SetDaemonRequest) error
+}
+
+// Config holds the configuration of a Failover.
+type Config struct {
+	Nodes []Node
+	// MaxLag is how many blocks a node may lag, or be ahead of, the
+	// median height. Defaults to 2, negative for none.
+	MaxLag int
+	// CrossCheck compares the block hashes of the nodes.
+	CrossCheck bool
+	// Timeout of the calls of a check to a node. Defaults to 10 seconds.
+	Timeout time.Duration
+	// Wallet (optional) is switched to the best node when its daemon is
+	// unhealthy, WalletDaemon being the address of its daemon at start,
+	// if known.
+	Wallet       Wallet
+	WalletDaemon string
+	// Interval between two checks in Run. Defaults to 30 seconds.
+	Interval time.Duration
+	// OnError (optional) is called with the errors the callers don't get:
+	// failed checks, forked nodes and failed wallet switches.
+	OnError func(error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Status is the state of a node as of the last Check.
+type Status struct {
+	Address string
+	Height  uint64
+	Latency time.Duration
+	Healthy bool
+	// Err is why the node is unhealthy.
+	Err error
+}
+
+// node is a Node with its state, guarded by Failover.mu.
+type node struct {
+	Node
+	status Status
+}
+
+// Failover calls the healthiest of the nodes.
+type Failover struct {
+	cfg Config
+
+	mu    sync.Mutex
+	nodes []*node
+	// ranked are the healthy nodes, best first
+	ranked []*node
+	// wallet is the address of the daemon of the wallet
+	wallet string
+}
+
+// New returns a Failover for the configuration. Until the first Check,
+// the nodes are assumed healthy, in their order.
+func New(cfg Config) *Failover {
+	if cfg.MaxLag == 0 {
+		cfg.MaxLag = 2
+	}
+	if cfg.MaxLag < 0 {
+		cfg.MaxLag = 0
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	f := &Failover{cfg: cfg, wallet: cfg.WalletDaemon}
+	for _, n := range cfg.Nodes {
+		if n.Client == nil {
+			n.Client = walletrpc.New(walletrpc.Config{Address: "http://" + n.Address + "/json_rpc"})
+		}
+		nd := &node{Node: n, status: Status{Address: n.Address, Healthy: true}}
+		f.nodes = append(f.nodes, nd)
+		f.ranked = append(f.ranked, nd)
+	}
+	return f
+}
+
+// Do calls fn with the client of the best node, and of the next ones while
+// it fails with an error other than an RPC error of the node, e.g. an
+// invalid parameter. It returns the last error.
+func (f *Failover) Do(fn func(*walletrpc.Client) error) error {
+	f.mu.Lock()
+	ranked := append([]*node(nil), f.ranked...)
+	f.mu.Unlock()
+	err := ErrNoNode
+	for _, n := range ranked {
+		if err = fn(n.Client); !failsOver(err) {
+			return err
+		}
+		f.mu.Lock()
+		n.status.Healthy, n.status.Err = false, err
+		f.rank()
+		f.mu.Unlock()
+	}
+	return err
+}
+
+// failsOver reports whether a call failed because of the node.
+func failsOver(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if iswerr, _ := walletrpc.GetWalletError(err); iswerr {
+		return walletrpc.IsRetryable(err)
+	}
+	return true
+}
+
+// rank orders the healthy nodes by latency, then height, f.mu being held.
+func (f *Failover) rank() {
+	f.ranked = f.ranked[:0]
+	for _, n := range f.nodes {
+		if n.status.Healthy {
+			f.ranked = append(f.ranked, n)
+		}
+	}
+	sort.SliceStable(f.ranked, func(i, j int) bool {
+		a, b := f.ranked[i], f.ranked[j]
+		if a.status.Latency != b.status.Latency {
+			return a.status.Latency < b.status.Latency
+		}
+		return a.status.Height > b.status.Height
+	})
+}
+
+// Check checks the health of the nodes, and switches the wallet to the best
+// one if its daemon is unhealthy.
+func (f *Failover) Check() {
+	statuses := make([]Status, len(f.nodes))
+	var wg sync.WaitGroup
+	for i, n := range f.nodes {
+		wg.Add(1)
+		go func(i int, n *node) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), f.cfg.Timeout)
+			defer cancel()
+			start := f.cfg.Now()
+			info, err := n.Client.WithContext(ctx).GetInfo()
+			if err == nil && info.Status != "" && info.Status != "OK" {
+				err = fmt.Errorf("status %v", info.Status)
+			}
+			if err == nil && info.Offline {
+				err = errors.New("offline")
+			}
+			statuses[i] = Status{
+				Address: n.Address,
+				Height:  info.Height,
+				Latency: f.cfg.Now().Sub(start),
+				Healthy: err == nil,
+				Err:     err,
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	median := medianHeight(statuses)
+	lag := uint64(f.cfg.MaxLag)
+	for i := range statuses {
+		s := &statuses[i]
+		switch {
+		case !s.Healthy:
+		case s.Height+lag < median:
+			s.Healthy = false
+			s.Err = fmt.Errorf("height %v lags %v", s.Height, median)
+		case s.Height > median+lag:
+			s.Healthy = false
+			s.Err = fmt.Errorf("height %v ahead of %v", s.Height, median)
+		}
+	}
+	if f.cfg.CrossCheck {
+		f.crossCheck(statuses)
+	}
+
+	f.mu.Lock()
+	for i, n := range f.nodes {
+		n.status = statuses[i]
+	}
+	f.rank()
+	f.mu.Unlock()
+	for _, s := range statuses {
+		if s.Err != nil {
+			f.onError(fmt.Errorf("failover: %v: %v", s.Address, s.Err))
+		}
+	}
+	f.switchWallet()
+}
+
+// medianHeight returns the median height of the healthy nodes, the lower
+// of the two middle ones for an even number of nodes: with two nodes, the
+// one ahead has to be within MaxLag of the other.
+func medianHeight(statuses []Status) uint64 {
+	var heights []uint64
+	for _, s := range statuses {
+		if s.Healthy {
+			heights = append(heights, s.Height)
+		}
+	}
+	if len(heights) == 0 {
+		return 0
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights[(len(heights)-1)/2]
+}
+
+// crossCheck compares the hashes of the last block the healthy nodes have
+// in common. The nodes outside of the largest group agreeing on a hash are
+// unhealthy; between groups of the same size, the one with the fastest
+// node wins.
+func (f *Failover) crossCheck(statuses []Status) {
+	var healthy []int
+	height := ^uint64(0)
+	for i, s := range statuses {
+		if s.Healthy {
+			healthy = append(healthy, i)
+			if s.Height < height {
+				height = s.Height
+			}
+		}
+	}
+	if len(healthy) < 2 || height == 0 {
+		return
+	}
+	// the height of the last block is the number of blocks minus one
+	height--
+
+	hashes := make([]string, len(statuses))
+	var wg sync.WaitGroup
+	for _, i := range healthy {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), f.cfg.Timeout)
+			defer cancel()
+			block, err := f.nodes[i].Client.WithContext(ctx).GetBlockByHeight(uint(height))
+			if err != nil {
+				statuses[i].Healthy, statuses[i].Err = false, err
+				return
+			}
+			hashes[i] = block.BlockHeader.Hash
+		}(i)
+	}
+	wg.Wait()
+
+	votes := map[string]int{}
+	fastest := map[string]time.Duration{}
+	for _, i := range healthy {
+		h := hashes[i]
+		if !statuses[i].Healthy {
+			continue
+		}
+		if d, ok := fastest[h]; !ok || statuses[i].Latency < d {
+			fastest[h] = statuses[i].Latency
+		}
+		votes[h]++
+	}
+	want := ""
+	for h, v := range votes {
+		if want == "" || v > votes[want] || v == votes[want] && fastest[h] < fastest[want] {
+			want = h
+		}
+	}
+	for _, i := range healthy {
+		if statuses[i].Healthy && hashes[i] != want {
+			statuses[i].Healthy = false
+			statuses[i].Err = &ForkError{Address: statuses[i].Address, Height: height, Hash: hashes[i], Want: want}
+		}
+	}
+}
+
+// switchWallet points the wallet at the best node, unless its daemon is
+// healthy.
+func (f *Failover) switchWallet() {
+	if f.cfg.Wallet == nil {
+		return
+	}
+	f.mu.Lock()
+	var best *node
+	if len(f.ranked) > 0 {
+		best = f.ranked[0]
+	}
+	current := f.wallet
+	for _, n := range f.ranked {
+		if n.Address == current {
+			best = nil
+		}
+	}
+	f.mu.Unlock()
+	if best == nil {
+		return
+	}
+	err := f.cfg.Wallet.SetDaemon(walletrpc.SetDaemonRequest{
+		Address: best.Address,
+		Trusted: best.Trusted,
+	})
+	if err != nil {
+		f.onError(fmt.Errorf("failover: switching the wallet to %v: %v", best.Address, err))
+		return
+	}
+	f.mu.Lock()
+	f.wallet = best.Address
+	f.mu.Unlock()
+}
+
+// WalletDaemon returns the address of the daemon of the wallet, empty if
+// unknown.
+func (f *Failover) WalletDaemon() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.wallet
+}
+
+// Nodes returns the state of the nodes, in their order.
+func (f *Failover) Nodes() []Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statuses := make([]Status, len(f.nodes))
+	for i, n := range f.nodes {
+		statuses[i] = n.status
+	}
+	return statuses
+}
+
+// Run checks the nodes every Interval until the context is done, starting
+// right away.
+func (f *Failover) Run(ctx context.Context) error {
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		f.Check()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *Failover) onError(err error) {
+	if f.cfg.OnError != nil {
+		f.cfg.OnError(err)
+	}
+}
+
+func (f *Failover) GetInfo() (res walletrpc.DaemonInfo, err error) {
+	err = f.Do(func(c *walletrpc.Client) error {
+		res, err = c.GetInfo()
+		return err
+	})
+	return
+}
+
+func (f *Failover) GetLastBlockHeader() (res walletrpc.BlockHeaderResponse, err error) {
+	err = f.Do(func(c *walletrpc.Client) error {
+		res, err = c.GetLastBlockHeader()
+		return err
+	})
+	return
+}
+
+func (f *Failover) GetBlockByHeight(height uint) (res walletrpc.Block, err error) {
+	err = f.Do(func(c *walletrpc.Client) error {
+		res, err = c.GetBlockByHeight(height)
+		return err
+	})
+	return
+}
+
+func (f *Failover) GetBlockByHash(hash string) (res walletrpc.Block, err error) {
+	err = f.Do(func(c *walletrpc.Client) error {
+		res, err = c.GetBlockByHash(hash)
+		return err
+	})
+	return
+}
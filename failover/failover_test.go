@@ -0,0 +1,276 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNode is a monerod stand-in.
+type fakeNode struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	height uint64
+	// hashes of the blocks by height, "h<height>" if missing
+	hashes map[uint64]string
+	delay  time.Duration
+	down   bool
+	calls  int
+}
+
+func newFakeNode(height uint64, delay time.Duration) *fakeNode {
+	n := &fakeNode{height: height, delay: delay, hashes: map[uint64]string{}}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	return n
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     uint64 `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			Height uint64 `json:"height"`
+		} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	n.mu.Lock()
+	n.calls++
+	down, delay := n.down, n.delay
+	n.mu.Unlock()
+	time.Sleep(delay)
+	if down {
+		http.Error(w, "down", http.StatusBadGateway)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "get_info":
+		resp["result"] = map[string]interface{}{"height": n.height, "status": "OK"}
+	case "getlastblockheader":
+		resp["result"] = map[string]interface{}{"block_header": map[string]interface{}{"height": n.height - 1}}
+	case "getblock":
+		if req.Params.Height >= n.height {
+			resp["error"] = map[string]interface{}{"code": -2, "message": "Requested block height too big"}
+			break
+		}
+		hash, ok := n.hashes[req.Params.Height]
+		if !ok {
+			hash = "h" + string(rune('0'+req.Params.Height%10))
+		}
+		resp["result"] = map[string]interface{}{"block_header": map[string]interface{}{"hash": hash}}
+	default:
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "Method not found"}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (n *fakeNode) address() string {
+	return strings.TrimPrefix(n.URL, "http://")
+}
+
+func (n *fakeNode) set(fn func(n *fakeNode)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fn(n)
+}
+
+// fakeWallet records its daemons.
+type fakeWallet struct {
+	daemons []string
+	err     error
+}
+
+func (w *fakeWallet) SetDaemon(req walletrpc.SetDaemonRequest) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.daemons = append(w.daemons, req.Address)
+	return nil
+}
+
+func newFailover(nodes []*fakeNode, cfg Config) *Failover {
+	for _, n := range nodes {
+		cfg.Nodes = append(cfg.Nodes, Node{Address: n.address()})
+	}
+	return New(cfg)
+}
+
+func TestCheck(t *testing.T) {
+	n0, n1, n2 := newFakeNode(100, 20*time.Millisecond), newFakeNode(99, 0), newFakeNode(90, 0)
+	defer n0.Close()
+	defer n1.Close()
+	defer n2.Close()
+	var errs []error
+	f := newFailover([]*fakeNode{n0, n1, n2}, Config{OnError: func(err error) { errs = append(errs, err) }})
+
+	f.Check()
+	statuses := f.Nodes()
+	assert.True(t, statuses[0].Healthy)
+	assert.True(t, statuses[1].Healthy)
+	assert.False(t, statuses[2].Healthy, "lags")
+	assert.Equal(t, uint64(90), statuses[2].Height)
+	assert.True(t, statuses[0].Latency > statuses[1].Latency)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "lags")
+
+	// the fastest node answers
+	header, err := f.GetLastBlockHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(98), header.BlockHeader.Height)
+
+	n2.set(func(n *fakeNode) { n.height = 100 })
+	f.Check()
+	assert.True(t, f.Nodes()[2].Healthy)
+}
+
+func TestCheckAhead(t *testing.T) {
+	n0, n1, n2 := newFakeNode(100, 10*time.Millisecond), newFakeNode(101, 10*time.Millisecond), newFakeNode(1000000, 0)
+	defer n0.Close()
+	defer n1.Close()
+	defer n2.Close()
+	w := &fakeWallet{}
+	f := newFailover([]*fakeNode{n0, n1, n2}, Config{Wallet: w, WalletDaemon: n0.address()})
+
+	// the fastest node claims a height far ahead: the others don't lag it
+	f.Check()
+	statuses := f.Nodes()
+	assert.True(t, statuses[0].Healthy)
+	assert.True(t, statuses[1].Healthy)
+	assert.False(t, statuses[2].Healthy)
+	assert.Contains(t, statuses[2].Err.Error(), "ahead")
+	assert.Len(t, w.daemons, 0)
+	info, err := f.GetInfo()
+	assert.NoError(t, err)
+	assert.True(t, info.Height <= 101)
+}
+
+func TestCheckAheadOfOne(t *testing.T) {
+	n0, n1 := newFakeNode(100, 10*time.Millisecond), newFakeNode(1000000, 0)
+	defer n0.Close()
+	defer n1.Close()
+	f := newFailover([]*fakeNode{n0, n1}, Config{})
+
+	// the honest node isn't deemed lagging the rogue one
+	f.Check()
+	statuses := f.Nodes()
+	assert.True(t, statuses[0].Healthy)
+	assert.False(t, statuses[1].Healthy)
+	assert.Contains(t, statuses[1].Err.Error(), "ahead")
+	info, err := f.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), info.Height)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	n0, n1 := newFakeNode(100, 300*time.Millisecond), newFakeNode(100, 0)
+	defer n0.Close()
+	defer n1.Close()
+	f := newFailover([]*fakeNode{n0, n1}, Config{Timeout: 50 * time.Millisecond, CrossCheck: true})
+
+	// a node not answering doesn't hold the check
+	start := time.Now()
+	f.Check()
+	assert.True(t, time.Since(start) < 300*time.Millisecond)
+	statuses := f.Nodes()
+	assert.False(t, statuses[0].Healthy)
+	assert.True(t, errors.Is(statuses[0].Err, context.DeadlineExceeded))
+	assert.True(t, statuses[1].Healthy)
+}
+
+func TestDo(t *testing.T) {
+	n0, n1 := newFakeNode(100, 0), newFakeNode(100, 0)
+	defer n0.Close()
+	defer n1.Close()
+	f := newFailover([]*fakeNode{n0, n1}, Config{})
+
+	n0.set(func(n *fakeNode) { n.down = true })
+	info, err := f.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), info.Height)
+	assert.False(t, f.Nodes()[0].Healthy)
+	assert.Error(t, f.Nodes()[0].Err)
+
+	// an unhealthy node isn't called until the next check
+	_, err = f.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n0.calls)
+
+	// an error of the node doesn't fail over
+	_, err = f.GetBlockByHeight(1000)
+	iswerr, _ := walletrpc.GetWalletError(err)
+	assert.True(t, iswerr)
+	assert.True(t, f.Nodes()[1].Healthy)
+
+	n1.set(func(n *fakeNode) { n.down = true })
+	_, err = f.GetInfo()
+	assert.Error(t, err)
+	_, err = f.GetInfo()
+	assert.True(t, errors.Is(err, ErrNoNode))
+
+	n0.set(func(n *fakeNode) { n.down = false })
+	f.Check()
+	_, err = f.GetInfo()
+	assert.NoError(t, err)
+}
+
+func TestCrossCheck(t *testing.T) {
+	n0, n1, n2 := newFakeNode(100, 0), newFakeNode(101, 0), newFakeNode(100, 0)
+	defer n0.Close()
+	defer n1.Close()
+	defer n2.Close()
+	n1.set(func(n *fakeNode) { n.hashes[99] = "forked" })
+	var errs []error
+	f := newFailover([]*fakeNode{n0, n1, n2}, Config{
+		CrossCheck: true,
+		OnError:    func(err error) { errs = append(errs, err) },
+	})
+
+	f.Check()
+	statuses := f.Nodes()
+	assert.True(t, statuses[0].Healthy)
+	assert.False(t, statuses[1].Healthy)
+	assert.True(t, statuses[2].Healthy)
+	var ferr *ForkError
+	assert.True(t, errors.As(statuses[1].Err, &ferr))
+	assert.Equal(t, &ForkError{Address: n1.address(), Height: 99, Hash: "forked", Want: "h9"}, ferr)
+	assert.Len(t, errs, 1)
+}
+
+func TestWallet(t *testing.T) {
+	n0, n1 := newFakeNode(100, 10*time.Millisecond), newFakeNode(100, 0)
+	defer n0.Close()
+	defer n1.Close()
+	w := &fakeWallet{}
+	f := newFailover([]*fakeNode{n0, n1}, Config{Wallet: w, WalletDaemon: n0.address()})
+
+	// the daemon of the wallet is healthy, if slower
+	f.Check()
+	assert.Len(t, w.daemons, 0)
+
+	n0.set(func(n *fakeNode) { n.down = true })
+	f.Check()
+	assert.Equal(t, []string{n1.address()}, w.daemons)
+	assert.Equal(t, n1.address(), f.WalletDaemon())
+
+	var errs []error
+	f.cfg.OnError = func(err error) { errs = append(errs, err) }
+	w.err = errors.New("no wallet")
+	n0.set(func(n *fakeNode) { n.down = false })
+	n1.set(func(n *fakeNode) { n.down = true })
+	f.Check()
+	assert.Len(t, errs, 2)
+	assert.Equal(t, n1.address(), f.WalletDaemon())
+}
@@ -0,0 +1,35 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.json")
+	assert.NoError(t, WriteFile(path, []byte("one")))
+	assert.NoError(t, WriteFile(path, []byte("two")))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+
+	// a failed write leaves the file as it was, without temporary files
+	failed := errors.New("failed")
+	err = Write(path, func(w io.Writer) error {
+		io.WriteString(w, "three")
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "two", string(data))
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	assert.Error(t, WriteFile(filepath.Join(dir, "missing", "f"), nil))
+}
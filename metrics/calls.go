@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the call duration
+// histogram buckets. Transfers may take tens of seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// CallMetrics measures the calls of a client, through its Interceptor:
+//
+//	monero_wallet_rpc_call_duration_seconds{method}  histogram
+//	monero_wallet_rpc_call_errors_total{method,code} counter
+//	monero_wallet_rpc_calls_in_flight{method}        gauge
+//
+// The code of an error is the walletrpc.ErrorCode of a wallet error, or
+// "transport", "http_<status>", "unsupported" or "other".
+type CallMetrics struct {
+	durations *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+	inFlight  *prometheus.GaugeVec
+}
+
+// NewCallMetrics returns the metrics of calls, with the given histogram
+// buckets or DefaultBuckets if nil.
+func NewCallMetrics(buckets []float64) *CallMetrics {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &CallMetrics{
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "monero_wallet_rpc_call_duration_seconds",
+			Help:    "Duration of the wallet rpc calls.",
+			Buckets: buckets,
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "monero_wallet_rpc_call_errors_total",
+			Help: "Failed wallet rpc calls, by error code.",
+		}, []string{"method", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "monero_wallet_rpc_calls_in_flight",
+			Help: "Wallet rpc calls in progress.",
+		}, []string{"method"}),
+	}
+}
+
+// Interceptor returns the interceptor measuring the calls.
+func (m *CallMetrics) Interceptor() walletrpc.Interceptor {
+	return func(ctx context.Context, method string, params, result interface{}, next walletrpc.Invoker) error {
+		inFlight := m.inFlight.WithLabelValues(method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		err := next(ctx, method, params, result)
+		m.durations.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.errors.WithLabelValues(method, errorCode(err)).Inc()
+		}
+		return err
+	}
+}
+
+func errorCode(err error) string {
+	var werr *walletrpc.WalletError
+	var herr *walletrpc.HTTPStatusError
+	var terr *walletrpc.TransportError
+	switch {
+	case errors.As(err, &werr):
+		return strconv.Itoa(int(werr.Code))
+	case errors.As(err, &herr):
+		return "http_" + strconv.Itoa(herr.StatusCode)
+	case errors.As(err, &terr):
+		return "transport"
+	case errors.Is(err, walletrpc.ErrUnsupported):
+		return "unsupported"
+	}
+	return "other"
+}
+
+// Describe implements prometheus.Collector.
+func (m *CallMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.durations.Describe(ch)
+	m.errors.Describe(ch)
+	m.inFlight.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *CallMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.durations.Collect(ch)
+	m.errors.Collect(ch)
+	m.inFlight.Collect(ch)
+}
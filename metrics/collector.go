@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Wallet is the subset of *walletrpc.Client sampled by the Collector.
+type Wallet interface {
+	GetHeight() (uint64, error)
+	GetAccounts(tag string) (walletrpc.GetAccountsResponse, error)
+}
+
+// Daemon is the subset of a *walletrpc.Client pointed at monerod sampled
+// by the Collector.
+type Daemon interface {
+	GetLastBlockHeader() (walletrpc.BlockHeaderResponse, error)
+}
+
+// Config holds the configuration of a Collector.
+type Config struct {
+	Wallet Wallet
+	// Daemon (optional) gives the daemon height, to export the sync lag.
+	Daemon Daemon
+	// Interval between two samples in Run. Defaults to 30 seconds.
+	Interval time.Duration
+	// OnError (optional) is called by Run when a sample fails.
+	OnError func(error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Collector samples the state of a wallet:
+//
+//	monero_wallet_balance_atomic{account}          gauge
+//	monero_wallet_unlocked_balance_atomic{account} gauge
+//	monero_wallet_height                           gauge
+//	monero_daemon_height                           gauge
+//	monero_wallet_sync_lag_blocks                  gauge
+//	monero_wallet_collect_errors_total             counter
+//	monero_wallet_last_collect_timestamp_seconds   gauge
+//
+// The balances are in atomic units. The metrics of a failed sample keep
+// their previous values; the heights are only collected after a
+// successful one.
+type Collector struct {
+	cfg Config
+
+	balance      *prometheus.GaugeVec
+	unlocked     *prometheus.GaugeVec
+	height       prometheus.Gauge
+	daemonHeight prometheus.Gauge
+	lag          prometheus.Gauge
+	errors       prometheus.Counter
+	last         prometheus.Gauge
+
+	mu sync.Mutex
+	// sampled is set after the first successful sample
+	sampled bool
+}
+
+// NewCollector returns a Collector for the configuration.
+func NewCollector(cfg Config) *Collector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	gauge := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+	}
+	return &Collector{
+		cfg: cfg,
+		balance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "monero_wallet_balance_atomic",
+			Help: "Balance of the account, in atomic units.",
+		}, []string{"account"}),
+		unlocked: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "monero_wallet_unlocked_balance_atomic",
+			Help: "Unlocked balance of the account, in atomic units.",
+		}, []string{"account"}),
+		height:       gauge("monero_wallet_height", "Height the wallet is synced to."),
+		daemonHeight: gauge("monero_daemon_height", "Height of the daemon."),
+		lag:          gauge("monero_wallet_sync_lag_blocks", "Blocks the wallet is behind the daemon."),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "monero_wallet_collect_errors_total",
+			Help: "Failed samples.",
+		}),
+		last: gauge("monero_wallet_last_collect_timestamp_seconds", "Time of the last successful sample."),
+	}
+}
+
+// Sample samples the wallet, and the daemon if any.
+func (c *Collector) Sample() error {
+	height, err := c.cfg.Wallet.GetHeight()
+	if err != nil {
+		return c.failed(err)
+	}
+	accounts, err := c.cfg.Wallet.GetAccounts("")
+	if err != nil {
+		return c.failed(err)
+	}
+	var daemonHeight uint64
+	if c.cfg.Daemon != nil {
+		header, err := c.cfg.Daemon.GetLastBlockHeader()
+		if err != nil {
+			return c.failed(err)
+		}
+		// the height of a chain is the height of its top block + 1, as
+		// reported by the wallet
+		daemonHeight = uint64(header.BlockHeader.Height) + 1
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.balance.Reset()
+	c.unlocked.Reset()
+	for _, a := range accounts.SubaddressAccounts {
+		account := strconv.FormatUint(a.AccountIndex, 10)
+		c.balance.WithLabelValues(account).Set(float64(a.Balance))
+		c.unlocked.WithLabelValues(account).Set(float64(a.UnlockedBalance))
+	}
+	c.height.Set(float64(height))
+	c.daemonHeight.Set(float64(daemonHeight))
+	var lag uint64
+	if daemonHeight > height {
+		lag = daemonHeight - height
+	}
+	c.lag.Set(float64(lag))
+	c.last.Set(float64(c.cfg.Now().UnixNano()) / 1e9)
+	c.sampled = true
+	return nil
+}
+
+func (c *Collector) failed(err error) error {
+	c.errors.Inc()
+	return err
+}
+
+// Run samples every Interval until the context is done.
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Sample(); err != nil && c.cfg.OnError != nil {
+			c.cfg.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.balance.Describe(ch)
+	c.unlocked.Describe(ch)
+	for _, m := range []prometheus.Metric{c.height, c.daemonHeight, c.lag, c.last, c.errors} {
+		ch <- m.Desc()
+	}
+}
+
+// Collect implements prometheus.Collector, with the metrics of the last
+// sample.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.balance.Collect(ch)
+	c.unlocked.Collect(ch)
+	if c.sampled {
+		ch <- c.height
+		if c.cfg.Daemon != nil {
+			ch <- c.daemonHeight
+			ch <- c.lag
+		}
+		ch <- c.last
+	}
+	ch <- c.errors
+}
@@ -0,0 +1,34 @@
+// Package metrics exports the calls of a walletrpc.Client and the state of
+// a wallet as Prometheus metrics.
+//
+// CallMetrics is an interceptor timing every call, counting the errors by
+// wallet error code and the calls in flight. The Collector samples the
+// balances of the accounts, the wallet height and the daemon height, to
+// export how far behind the daemon the wallet is. Both are
+// prometheus.Collectors, to register with a registry, or to serve with
+// Handler:
+//
+//	calls := metrics.NewCallMetrics(nil)
+//	client := walletrpc.New(walletrpc.Config{
+//		Address:      "http://127.0.0.1:18082/json_rpc",
+//		Interceptors: []walletrpc.Interceptor{calls.Interceptor()},
+//	})
+//	collector := metrics.NewCollector(metrics.Config{Wallet: client})
+//	go collector.Run(ctx)
+//	http.Handle("/metrics", metrics.Handler(calls, collector))
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler serves the metrics of the collectors, registered with a registry
+// of their own.
+func Handler(collectors ...prometheus.Collector) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors...)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
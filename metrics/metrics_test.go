@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func walletServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     uint64 `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "getheight":
+			resp["result"] = map[string]uint64{"height": 100}
+		case "getbalance":
+			resp["error"] = map[string]interface{}{"code": -13, "message": "no wallet file"}
+		case "getaddress":
+			http.Error(w, "login", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestCallMetrics(t *testing.T) {
+	sv := walletServer(t)
+	defer sv.Close()
+	m := NewCallMetrics([]float64{1, 0.001})
+	client := walletrpc.New(walletrpc.Config{
+		Address:      sv.URL + "/json_rpc",
+		Interceptors: []walletrpc.Interceptor{m.Interceptor()},
+	})
+	_, err := client.GetHeight()
+	assert.NoError(t, err)
+	client.GetHeight()
+	client.GetBalance()
+	client.GetAddress()
+
+	assert.NoError(t, testutil.CollectAndCompare(m, strings.NewReader(`
+# HELP monero_wallet_rpc_call_errors_total Failed wallet rpc calls, by error code.
+# TYPE monero_wallet_rpc_call_errors_total counter
+monero_wallet_rpc_call_errors_total{code="-13",method="getbalance"} 1
+monero_wallet_rpc_call_errors_total{code="http_401",method="getaddress"} 1
+# HELP monero_wallet_rpc_calls_in_flight Wallet rpc calls in progress.
+# TYPE monero_wallet_rpc_calls_in_flight gauge
+monero_wallet_rpc_calls_in_flight{method="getaddress"} 0
+monero_wallet_rpc_calls_in_flight{method="getbalance"} 0
+monero_wallet_rpc_calls_in_flight{method="getheight"} 0
+`), "monero_wallet_rpc_call_errors_total", "monero_wallet_rpc_calls_in_flight"))
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+	var h *dto.Histogram
+	for _, f := range families {
+		if f.GetName() == "monero_wallet_rpc_call_duration_seconds" {
+			for _, metric := range f.Metric {
+				if metric.Label[0].GetValue() == "getheight" {
+					h = metric.Histogram
+				}
+			}
+		}
+	}
+	if assert.NotNil(t, h) {
+		assert.Equal(t, uint64(2), h.GetSampleCount())
+		// buckets are sorted, and cumulative
+		assert.Equal(t, 0.001, h.Bucket[0].GetUpperBound())
+		assert.Equal(t, 1.0, h.Bucket[1].GetUpperBound())
+		assert.Equal(t, uint64(2), h.Bucket[1].GetCumulativeCount())
+	}
+}
+
+type fakeWallet struct {
+	height   uint64
+	accounts []walletrpc.Account
+	err      error
+}
+
+func (w *fakeWallet) GetHeight() (uint64, error) {
+	return w.height, w.err
+}
+
+func (w *fakeWallet) GetAccounts(tag string) (walletrpc.GetAccountsResponse, error) {
+	return walletrpc.GetAccountsResponse{SubaddressAccounts: w.accounts}, w.err
+}
+
+type fakeDaemon struct {
+	height uint
+}
+
+func (d *fakeDaemon) GetLastBlockHeader() (walletrpc.BlockHeaderResponse, error) {
+	return walletrpc.BlockHeaderResponse{BlockHeader: walletrpc.BlockHeader{Height: d.height}}, nil
+}
+
+func TestCollector(t *testing.T) {
+	wallet := &fakeWallet{
+		height: 90,
+		accounts: []walletrpc.Account{
+			{AccountIndex: 0, Balance: 3000000000000, UnlockedBalance: 1000000000000},
+			{AccountIndex: 1, Balance: 5},
+		},
+	}
+	c := NewCollector(Config{
+		Wallet: wallet,
+		Daemon: &fakeDaemon{height: 99},
+		Now:    func() time.Time { return time.Unix(1500000000, 0) },
+	})
+	assert.NoError(t, c.Sample())
+	wallet.err = errors.New("down")
+	wallet.height = 100
+	assert.Error(t, c.Sample())
+
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP monero_daemon_height Height of the daemon.
+# TYPE monero_daemon_height gauge
+monero_daemon_height 100
+# HELP monero_wallet_balance_atomic Balance of the account, in atomic units.
+# TYPE monero_wallet_balance_atomic gauge
+monero_wallet_balance_atomic{account="0"} 3e+12
+monero_wallet_balance_atomic{account="1"} 5
+# HELP monero_wallet_collect_errors_total Failed samples.
+# TYPE monero_wallet_collect_errors_total counter
+monero_wallet_collect_errors_total 1
+# HELP monero_wallet_height Height the wallet is synced to.
+# TYPE monero_wallet_height gauge
+monero_wallet_height 90
+# HELP monero_wallet_last_collect_timestamp_seconds Time of the last successful sample.
+# TYPE monero_wallet_last_collect_timestamp_seconds gauge
+monero_wallet_last_collect_timestamp_seconds 1.5e+09
+# HELP monero_wallet_sync_lag_blocks Blocks the wallet is behind the daemon.
+# TYPE monero_wallet_sync_lag_blocks gauge
+monero_wallet_sync_lag_blocks 10
+# HELP monero_wallet_unlocked_balance_atomic Unlocked balance of the account, in atomic units.
+# TYPE monero_wallet_unlocked_balance_atomic gauge
+monero_wallet_unlocked_balance_atomic{account="0"} 1e+12
+monero_wallet_unlocked_balance_atomic{account="1"} 0
+`)))
+
+	// no heights before the first sample
+	c = NewCollector(Config{Wallet: wallet})
+	assert.Equal(t, 1, testutil.CollectAndCount(c))
+
+	sv := httptest.NewServer(Handler(c))
+	defer sv.Close()
+	resp, err := http.Get(sv.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "monero_wallet_collect_errors_total 0\n")
+}
@@ -0,0 +1,367 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// ErrPaymentIDCollision is returned by DepositPoller.Register when a payment
+// id is already assigned to another owner.
+var ErrPaymentIDCollision = errors.New("payments: payment id collision")
+
+// DepositWallet is the subset of *walletrpc.Client used by the DepositPoller.
+type DepositWallet interface {
+	GetHeight() (uint64, error)
+	GetBulkPayments(payments []string, minHeight uint) ([]walletrpc.Payment, error)
+}
+
+// DepositKey identifies a deposit.
+type DepositKey struct {
+	TxHash    string `json:"tx_hash"`
+	PaymentID string `json:"payment_id"`
+	Amount    uint64 `json:"amount"`
+}
+
+// Deposit is a payment to a registered payment id.
+type Deposit struct {
+	DepositKey
+	// Owner is the owner the payment id was registered for.
+	Owner         string
+	BlockHeight   uint64
+	UnlockTime    uint64
+	Confirmations uint64
+	// Reverted is set when a deposit that was already acknowledged
+	// disappeared from the chain (reorg or double spend).
+	Reverted bool
+}
+
+// Checkpoint is the persisted state of a DepositPoller.
+type Checkpoint struct {
+	// Height is the lowest block height that may still hold a deposit
+	// that was not acknowledged.
+	Height uint64 `json:"height"`
+	// Acked are the acknowledged deposits inside the safety window.
+	Acked []AckedDeposit `json:"acked,omitempty"`
+}
+
+// AckedDeposit is an acknowledged deposit and the height it was mined at.
+type AckedDeposit struct {
+	DepositKey
+	BlockHeight uint64 `json:"block_height"`
+}
+
+// CheckpointStore persists the checkpoint of a DepositPoller.
+type CheckpointStore interface {
+	LoadCheckpoint() (Checkpoint, error)
+	SaveCheckpoint(Checkpoint) error
+}
+
+// FileCheckpointStore is a CheckpointStore backed by a JSON file.
+type FileCheckpointStore string
+
+// LoadCheckpoint implements CheckpointStore. A missing file is an empty checkpoint.
+func (path FileCheckpointStore) LoadCheckpoint() (cp Checkpoint, err error) {
+	data, err := ioutil.ReadFile(string(path))
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(data, &cp)
+	return
+}
+
+// SaveCheckpoint implements CheckpointStore.
+func (path FileCheckpointStore) SaveCheckpoint(cp Checkpoint) error {
+	return writeFileAtomic(string(path), cp)
+}
+
+type memoryCheckpointStore struct {
+	cp Checkpoint
+}
+
+func (s *memoryCheckpointStore) LoadCheckpoint() (Checkpoint, error) { return s.cp, nil }
+func (s *memoryCheckpointStore) SaveCheckpoint(cp Checkpoint) error  { s.cp = cp; return nil }
+
+// DepositConfig holds the configuration of a DepositPoller.
+type DepositConfig struct {
+	Wallet DepositWallet
+	// Checkpoints defaults to an in-memory store.
+	Checkpoints CheckpointStore
+	// Confirmations required before a deposit is delivered.
+	Confirmations uint64
+	// SafetyWindow is the number of blocks below the checkpoint that are
+	// queried again on every poll to notice reorgs. Defaults to 10.
+	SafetyWindow uint64
+	// PollInterval is the delay between polls in Run. Defaults to 30 seconds.
+	PollInterval time.Duration
+	// OnError is called by Run when a poll fails.
+	OnError func(error)
+}
+
+// DepositPoller watches payments to legacy payment ids with GetBulkPayments.
+//
+// Deposits are delivered on the Deposits channel at least once: a deposit
+// is delivered again (after a restart) until it is acknowledged with Ack,
+// and acknowledged deposits are never delivered twice.
+type DepositPoller struct {
+	cfg DepositConfig
+	out chan Deposit
+
+	mu       sync.Mutex
+	owners   map[string]string
+	cp       Checkpoint
+	acked    map[DepositKey]uint64
+	inflight map[DepositKey]bool
+}
+
+// NewDepositPoller loads the checkpoint and returns a DepositPoller.
+// Payment ids have to be registered again after a restart.
+func NewDepositPoller(cfg DepositConfig) (*DepositPoller, error) {
+	if cfg.Checkpoints == nil {
+		cfg.Checkpoints = &memoryCheckpointStore{}
+	}
+	if cfg.SafetyWindow == 0 {
+		cfg.SafetyWindow = 10
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	cp, err := cfg.Checkpoints.LoadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	p := &DepositPoller{
+		cfg:      cfg,
+		out:      make(chan Deposit),
+		owners:   make(map[string]string),
+		cp:       cp,
+		acked:    make(map[DepositKey]uint64),
+		inflight: make(map[DepositKey]bool),
+	}
+	for _, a := range cp.Acked {
+		p.acked[a.DepositKey] = a.BlockHeight
+	}
+	return p, nil
+}
+
+// Deposits returns the channel deposits are delivered on.
+func (p *DepositPoller) Deposits() <-chan Deposit {
+	return p.out
+}
+
+// Register starts watching a payment id on behalf of owner. Registering an
+// id twice for the same owner is a no-op, for another owner it fails with
+// ErrPaymentIDCollision.
+func (p *DepositPoller) Register(paymentID, owner string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if prev, ok := p.owners[paymentID]; ok {
+		if prev == owner {
+			return nil
+		}
+		return ErrPaymentIDCollision
+	}
+	p.owners[paymentID] = owner
+	return nil
+}
+
+// NewPaymentID generates and registers a random payment id that is not
+// in use yet. Long selects a 256 bit id instead of a 64 bit one.
+func (p *DepositPoller) NewPaymentID(owner string, long bool) (string, error) {
+	gen := walletrpc.NewPaymentID64
+	if long {
+		gen = walletrpc.NewPaymentID256
+	}
+	for {
+		id, err := gen()
+		if err != nil {
+			return "", err
+		}
+		err = p.Register(id, owner)
+		if err == nil {
+			return id, nil
+		}
+		if err != ErrPaymentIDCollision {
+			return "", err
+		}
+	}
+}
+
+// Ack marks a deposit as processed and persists the checkpoint.
+func (p *DepositPoller) Ack(d Deposit) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.inflight, d.DepositKey)
+	if d.Reverted {
+		delete(p.acked, d.DepositKey)
+	} else {
+		p.acked[d.DepositKey] = d.BlockHeight
+	}
+	return p.saveLocked()
+}
+
+// Poll queries the wallet once and delivers the new deposits. It blocks
+// until they are received from the Deposits channel or ctx is done.
+func (p *DepositPoller) Poll(ctx context.Context) error {
+	p.mu.Lock()
+	ids := make([]string, 0, len(p.owners))
+	for id := range p.owners {
+		ids = append(ids, id)
+	}
+	from := p.queryHeight()
+	p.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+
+	height, err := p.cfg.Wallet.GetHeight()
+	if err != nil {
+		return err
+	}
+	// min_block_height is exclusive
+	payments, err := p.cfg.Wallet.GetBulkPayments(ids, uint(from))
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	var deliver []Deposit
+	present := make(map[DepositKey]bool, len(payments))
+	// lowest height of a deposit that still has to be delivered
+	pending := height
+	for _, pm := range payments {
+		owner, ok := p.owners[pm.PaymentID]
+		if !ok {
+			continue
+		}
+		d := Deposit{
+			DepositKey: DepositKey{
+				TxHash:    pm.TxHash,
+				PaymentID: pm.PaymentID,
+				Amount:    pm.Amount,
+			},
+			Owner:       owner,
+			BlockHeight: pm.BlockHeight,
+			UnlockTime:  pm.UnlockTime,
+		}
+		if height > pm.BlockHeight {
+			d.Confirmations = height - pm.BlockHeight
+		}
+		present[d.DepositKey] = true
+		if ackedAt, ok := p.acked[d.DepositKey]; ok {
+			if ackedAt != d.BlockHeight {
+				// re-mined in another block after a reorg, same deposit
+				p.acked[d.DepositKey] = d.BlockHeight
+			}
+			continue
+		}
+		if pm.BlockHeight < pending {
+			pending = pm.BlockHeight
+		}
+		if d.Confirmations < p.cfg.Confirmations || p.inflight[d.DepositKey] {
+			continue
+		}
+		p.inflight[d.DepositKey] = true
+		deliver = append(deliver, d)
+	}
+	for key, at := range p.acked {
+		owner, watched := p.owners[key.PaymentID]
+		if watched && at > from && !present[key] && !p.inflight[key] {
+			p.inflight[key] = true
+			deliver = append(deliver, Deposit{
+				DepositKey:  key,
+				Owner:       owner,
+				BlockHeight: at,
+				Reverted:    true,
+			})
+		}
+	}
+	// may move back when an older deposit shows up late
+	p.cp.Height = pending
+	err = p.saveLocked()
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(deliver, func(i, j int) bool { return deliver[i].BlockHeight < deliver[j].BlockHeight })
+	for i, d := range deliver {
+		select {
+		case p.out <- d:
+		case <-ctx.Done():
+			// let the next poll deliver them again
+			p.mu.Lock()
+			for _, d := range deliver[i:] {
+				delete(p.inflight, d.DepositKey)
+			}
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Checkpoint returns a copy of the current checkpoint.
+func (p *DepositPoller) Checkpoint() Checkpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cp := p.cp
+	cp.Acked = append([]AckedDeposit(nil), cp.Acked...)
+	return cp
+}
+
+// Run polls until the context is done.
+func (p *DepositPoller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil && p.cfg.OnError != nil {
+			p.cfg.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *DepositPoller) queryHeight() uint64 {
+	if p.cp.Height <= p.cfg.SafetyWindow {
+		return 0
+	}
+	return p.cp.Height - p.cfg.SafetyWindow
+}
+
+// saveLocked prunes the acknowledged deposits below the safety window
+// and persists the checkpoint.
+func (p *DepositPoller) saveLocked() error {
+	from := p.queryHeight()
+	p.cp.Acked = p.cp.Acked[:0]
+	for key, at := range p.acked {
+		if at <= from {
+			delete(p.acked, key)
+			continue
+		}
+		p.cp.Acked = append(p.cp.Acked, AckedDeposit{key, at})
+	}
+	sort.Slice(p.cp.Acked, func(i, j int) bool {
+		a, b := p.cp.Acked[i], p.cp.Acked[j]
+		if a.BlockHeight != b.BlockHeight {
+			return a.BlockHeight < b.BlockHeight
+		}
+		return a.TxHash < b.TxHash
+	})
+	return p.cfg.Checkpoints.SaveCheckpoint(p.cp)
+}
@@ -0,0 +1,100 @@
+package payments
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// drain polls once and collects the delivered deposits.
+func drain(t *testing.T, p *DepositPoller) []Deposit {
+	var got []Deposit
+	done := make(chan error)
+	go func() { done <- p.Poll(context.Background()) }()
+	for {
+		select {
+		case d := <-p.Deposits():
+			got = append(got, d)
+		case err := <-done:
+			assert.NoError(t, err)
+			return got
+		case <-time.After(5 * time.Second):
+			t.Fatal("poll timed out")
+		}
+	}
+}
+
+func TestDepositPoller(t *testing.T) {
+	w := &testWallet{height: 100}
+	sv := w.serve()
+	defer sv.Close()
+	wallet := walletrpc.New(walletrpc.Config{Address: sv.URL + "/json_rpc"})
+	cpfile := FileCheckpointStore(filepath.Join(t.TempDir(), "cursor.json"))
+
+	p, err := NewDepositPoller(DepositConfig{
+		Wallet:        wallet,
+		Checkpoints:   cpfile,
+		Confirmations: 2,
+		SafetyWindow:  5,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Register("0000000000000001", "alice"))
+	assert.NoError(t, p.Register("0000000000000001", "alice"))
+	assert.Equal(t, ErrPaymentIDCollision, p.Register("0000000000000001", "bob"))
+	bobID, err := p.NewPaymentID("bob", false)
+	assert.NoError(t, err)
+	assert.Len(t, bobID, 16)
+
+	assert.Empty(t, drain(t, p))
+	assert.Equal(t, uint64(100), p.Checkpoint().Height)
+
+	w.payments = []walletrpc.Payment{
+		{PaymentID: "0000000000000001", TxHash: "a", Amount: 5, BlockHeight: 99},
+		{PaymentID: bobID, TxHash: "b", Amount: 7, BlockHeight: 100},
+		{PaymentID: "ffffffffffffffff", TxHash: "c", Amount: 9, BlockHeight: 100},
+	}
+	w.height = 101
+	got := drain(t, p)
+	assert.Equal(t, uint(95), w.lastMin)
+	// only alice has two confirmations
+	assert.Len(t, got, 1)
+	assert.Equal(t, "alice", got[0].Owner)
+	assert.Equal(t, uint64(2), got[0].Confirmations)
+	// not acked: the checkpoint moves back to it
+	assert.Equal(t, uint64(99), p.Checkpoint().Height)
+
+	// after a restart the unacked deposit is delivered again
+	p, err = NewDepositPoller(DepositConfig{
+		Wallet:        wallet,
+		Checkpoints:   cpfile,
+		Confirmations: 2,
+		SafetyWindow:  5,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Register("0000000000000001", "alice"))
+	assert.NoError(t, p.Register(bobID, "bob"))
+	w.height = 102
+	got = drain(t, p)
+	assert.Len(t, got, 2)
+	for _, d := range got {
+		assert.NoError(t, p.Ack(d))
+	}
+	assert.Empty(t, drain(t, p))
+	assert.Equal(t, uint64(102), p.Checkpoint().Height)
+
+	// reorg: bob's deposit moves to another block, alice's disappears
+	w.payments = []walletrpc.Payment{
+		{PaymentID: bobID, TxHash: "b", Amount: 7, BlockHeight: 101},
+	}
+	got = drain(t, p)
+	assert.Len(t, got, 1)
+	assert.True(t, got[0].Reverted)
+	assert.Equal(t, "a", got[0].TxHash)
+	assert.NoError(t, p.Ack(got[0]))
+	assert.Empty(t, drain(t, p))
+	assert.Len(t, p.Checkpoint().Acked, 1)
+}
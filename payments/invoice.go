@@ -0,0 +1,110 @@
+// Package payments tracks incoming payments for invoices.
+//
+// Every invoice gets a fresh subaddress of the wallet, so incoming transfers
+// can be matched to invoices without payment ids. A Tracker polls the wallet
+// and moves each invoice through its states:
+//
+//	pending -> seen_in_pool -> partially_paid -> paid -> confirmed/overpaid
+//	      \______________________________________/
+//	                          -> expired
+package payments
+
+import (
+	"time"
+)
+
+// State is the state of an invoice.
+type State string
+
+const (
+	// StatePending - nothing received yet
+	StatePending State = "pending"
+	// StateSeenInPool - a payment is in the mempool, nothing in a block yet
+	StateSeenInPool State = "seen_in_pool"
+	// StatePartiallyPaid - less than the invoice amount was received
+	StatePartiallyPaid State = "partially_paid"
+	// StatePaid - the amount was received but lacks confirmations
+	StatePaid State = "paid"
+	// StateConfirmed - the amount was received with enough confirmations
+	StateConfirmed State = "confirmed"
+	// StateOverpaid - like StateConfirmed, but more than the amount was received
+	StateOverpaid State = "overpaid"
+	// StateExpired - the invoice expired before it was paid
+	StateExpired State = "expired"
+)
+
+// Final reports whether the invoice is no longer watched.
+func (s State) Final() bool {
+	return s == StateConfirmed || s == StateOverpaid || s == StateExpired
+}
+
+// Invoice is a payment request tied to a subaddress.
+type Invoice struct {
+	ID string `json:"id"`
+	// Amount is the requested amount, in atomic units.
+	Amount uint64 `json:"amount"`
+	// RequiredConfirmations before the invoice is confirmed.
+	// Zero accepts payments still in the mempool.
+	RequiredConfirmations uint64 `json:"required_confirmations"`
+
+	AccountIndex uint64 `json:"account_index"`
+	AddressIndex uint64 `json:"address_index"`
+	Address      string `json:"address"`
+
+	State     State     `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// CreatedHeight is the wallet height when the invoice was created,
+	// older transfers are not considered.
+	CreatedHeight uint64 `json:"created_height"`
+
+	// Received is the total amount of the payments, mempool included.
+	Received uint64 `json:"received"`
+	// Confirmed is the amount of the payments with enough confirmations.
+	Confirmed uint64    `json:"confirmed"`
+	Payments  []Payment `json:"payments,omitempty"`
+}
+
+// Payment is a transfer to the invoice subaddress.
+type Payment struct {
+	TxID   string `json:"txid"`
+	Amount uint64 `json:"amount"`
+	// Height is zero while the transfer is in the mempool.
+	Height        uint64 `json:"height"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+// nextState computes the state of the invoice from its payments.
+func (inv *Invoice) nextState(now time.Time) State {
+	if inv.State.Final() {
+		return inv.State
+	}
+	switch {
+	case inv.Confirmed > inv.Amount:
+		return StateOverpaid
+	case inv.Confirmed == inv.Amount:
+		return StateConfirmed
+	case inv.Received >= inv.Amount:
+		return StatePaid
+	}
+	if !inv.ExpiresAt.IsZero() && !now.Before(inv.ExpiresAt) {
+		return StateExpired
+	}
+	switch {
+	case inv.Received == 0:
+		return StatePending
+	case inv.inBlocks() == 0:
+		return StateSeenInPool
+	}
+	return StatePartiallyPaid
+}
+
+func (inv *Invoice) inBlocks() (amount uint64) {
+	for _, p := range inv.Payments {
+		if p.Height > 0 {
+			amount += p.Amount
+		}
+	}
+	return
+}
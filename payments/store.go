@@ -0,0 +1,160 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ibclabs/go-monero/internal/atomicfile"
+)
+
+// ErrNotFound is returned by a Store when an invoice doesn't exist.
+var ErrNotFound = errors.New("payments: invoice not found")
+
+// Store persists invoices. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save creates or replaces an invoice.
+	Save(inv Invoice) error
+	// Get returns the invoice with the given id or ErrNotFound.
+	Get(id string) (Invoice, error)
+	// Open returns the invoices that are not in a final state.
+	Open() ([]Invoice, error)
+}
+
+// MemoryStore is a Store that keeps invoices in memory.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	invoices map[string]Invoice
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		invoices: make(map[string]Invoice),
+	}
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(inv Invoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invoices[inv.ID] = copyInvoice(inv)
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(id string) (Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inv, ok := s.invoices[id]
+	if !ok {
+		return Invoice{}, ErrNotFound
+	}
+	return copyInvoice(inv), nil
+}
+
+// Open implements Store.
+func (s *MemoryStore) Open() ([]Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return openInvoices(s.invoices), nil
+}
+
+// FileStore is a Store backed by a JSON file. The whole file is rewritten
+// (atomically, through a rename) on every Save, so it suits up to a few
+// thousand invoices.
+type FileStore struct {
+	mem  *MemoryStore
+	path string
+	// serializes file writes
+	wmu sync.Mutex
+}
+
+// NewFileStore opens or creates the store at path.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		mem:  NewMemoryStore(),
+		path: path,
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var invoices []Invoice
+	if err := json.Unmarshal(data, &invoices); err != nil {
+		return nil, err
+	}
+	for _, inv := range invoices {
+		s.mem.invoices[inv.ID] = inv
+	}
+	return s, nil
+}
+
+// Save implements Store.
+func (s *FileStore) Save(inv Invoice) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mem.mu.Lock()
+	prev, existed := s.mem.invoices[inv.ID]
+	s.mem.invoices[inv.ID] = copyInvoice(inv)
+	all := make([]Invoice, 0, len(s.mem.invoices))
+	for _, v := range s.mem.invoices {
+		all = append(all, v)
+	}
+	s.mem.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	err := writeFileAtomic(s.path, all)
+	if err != nil {
+		// keep memory and disk in sync
+		s.mem.mu.Lock()
+		if existed {
+			s.mem.invoices[inv.ID] = prev
+		} else {
+			delete(s.mem.invoices, inv.ID)
+		}
+		s.mem.mu.Unlock()
+	}
+	return err
+}
+
+// Get implements Store.
+func (s *FileStore) Get(id string) (Invoice, error) {
+	return s.mem.Get(id)
+}
+
+// Open implements Store.
+func (s *FileStore) Open() ([]Invoice, error) {
+	return s.mem.Open()
+}
+
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data)
+}
+
+func openInvoices(m map[string]Invoice) []Invoice {
+	out := make([]Invoice, 0, len(m))
+	for _, inv := range m {
+		if !inv.State.Final() {
+			out = append(out, copyInvoice(inv))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func copyInvoice(inv Invoice) Invoice {
+	inv.Payments = append([]Payment(nil), inv.Payments...)
+	return inv
+}
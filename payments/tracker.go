@@ -0,0 +1,247 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Wallet is the subset of *walletrpc.Client used by the Tracker.
+type Wallet interface {
+	CreateAddress(accountIndex uint64, label string) (string, uint64, error)
+	GetHeight() (uint64, error)
+	GetTransfers(req walletrpc.GetTransfersRequest) (walletrpc.GetTransfersResponse, error)
+}
+
+// Callback is called after an invoice changed state.
+type Callback func(inv Invoice, previous State)
+
+// Config holds the configuration of a Tracker.
+type Config struct {
+	Wallet Wallet
+	// Store defaults to a MemoryStore.
+	Store Store
+	// AccountIndex is the wallet account the invoice subaddresses are created in.
+	AccountIndex uint64
+	// PollInterval is the delay between polls in Run. Defaults to 30 seconds.
+	PollInterval time.Duration
+	// OnStateChange is called, from the polling goroutine, on every state change.
+	OnStateChange Callback
+	// OnError is called by Run when a poll fails.
+	OnError func(error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// InvoiceRequest holds the parameters of a new invoice.
+type InvoiceRequest struct {
+	// ID (optional) - a random id is generated if empty
+	ID string
+	// Amount to receive, in atomic units
+	Amount uint64
+	// Expiry (optional) - the invoice expires if it isn't paid in time
+	Expiry time.Duration
+	// Confirmations - required confirmations (0 accepts mempool payments)
+	Confirmations uint64
+}
+
+// Tracker creates invoices and follows their payments.
+type Tracker struct {
+	cfg Config
+	// serializes Create and Poll
+	mu sync.Mutex
+}
+
+// NewTracker returns a Tracker for the configuration.
+func NewTracker(cfg Config) *Tracker {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Tracker{cfg: cfg}
+}
+
+// Create allocates a new subaddress and stores a pending invoice for it.
+func (t *Tracker) Create(req InvoiceRequest) (Invoice, error) {
+	if req.Amount == 0 {
+		return Invoice{}, errors.New("payments: invoice amount must be positive")
+	}
+	if req.ID == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return Invoice{}, err
+		}
+		req.ID = hex.EncodeToString(buf)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.cfg.Store.Get(req.ID); err == nil {
+		return Invoice{}, errors.New("payments: duplicate invoice id " + req.ID)
+	} else if err != ErrNotFound {
+		return Invoice{}, err
+	}
+
+	height, err := t.cfg.Wallet.GetHeight()
+	if err != nil {
+		return Invoice{}, err
+	}
+	addr, index, err := t.cfg.Wallet.CreateAddress(t.cfg.AccountIndex, req.ID)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	now := t.cfg.Now()
+	inv := Invoice{
+		ID:                    req.ID,
+		Amount:                req.Amount,
+		RequiredConfirmations: req.Confirmations,
+		AccountIndex:          t.cfg.AccountIndex,
+		AddressIndex:          index,
+		Address:               addr,
+		State:                 StatePending,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+		CreatedHeight:         height,
+	}
+	if req.Expiry > 0 {
+		inv.ExpiresAt = now.Add(req.Expiry)
+	}
+	if err := t.cfg.Store.Save(inv); err != nil {
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// Get returns an invoice from the store.
+func (t *Tracker) Get(id string) (Invoice, error) {
+	return t.cfg.Store.Get(id)
+}
+
+// Poll fetches the transfers of all the open invoices once and updates
+// their state.
+func (t *Tracker) Poll() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	open, err := t.cfg.Store.Open()
+	if err != nil || len(open) == 0 {
+		return err
+	}
+
+	height, err := t.cfg.Wallet.GetHeight()
+	if err != nil {
+		return err
+	}
+	req := walletrpc.GetTransfersRequest{
+		In:             true,
+		Pool:           true,
+		FilterByHeight: true,
+		MinHeight:      open[0].CreatedHeight,
+		// the wallet treats a zero max_height as a real bound
+		MaxHeight:    height,
+		AccountIndex: t.cfg.AccountIndex,
+	}
+	for _, inv := range open {
+		if inv.CreatedHeight < req.MinHeight {
+			req.MinHeight = inv.CreatedHeight
+		}
+		req.SubaddrIndices = append(req.SubaddrIndices, inv.AddressIndex)
+	}
+	// min_height is exclusive
+	if req.MinHeight > 0 {
+		req.MinHeight--
+	}
+	resp, err := t.cfg.Wallet.GetTransfers(req)
+	if err != nil {
+		return err
+	}
+
+	byIndex := make(map[uint64][]Payment)
+	add := func(tr walletrpc.Transfer, inBlock bool) {
+		if tr.SubaddrIndex.Major != t.cfg.AccountIndex {
+			return
+		}
+		p := Payment{
+			TxID:   tr.TxID,
+			Amount: tr.Amount,
+		}
+		if inBlock {
+			p.Height = tr.Height
+			if height > tr.Height {
+				p.Confirmations = height - tr.Height
+			}
+		}
+		byIndex[tr.SubaddrIndex.Minor] = append(byIndex[tr.SubaddrIndex.Minor], p)
+	}
+	for _, tr := range resp.In {
+		add(tr, true)
+	}
+	for _, tr := range resp.Pool {
+		add(tr, false)
+	}
+
+	now := t.cfg.Now()
+	for _, inv := range open {
+		prev := inv.State
+		changed := inv.update(byIndex[inv.AddressIndex])
+		inv.State = inv.nextState(now)
+		if !changed && inv.State == prev {
+			continue
+		}
+		inv.UpdatedAt = now
+		if err := t.cfg.Store.Save(inv); err != nil {
+			return err
+		}
+		if inv.State != prev && t.cfg.OnStateChange != nil {
+			t.cfg.OnStateChange(inv, prev)
+		}
+	}
+	return nil
+}
+
+// update replaces the payments of the invoice and reports whether
+// anything changed.
+func (inv *Invoice) update(payments []Payment) bool {
+	var received, confirmed uint64
+	for _, p := range payments {
+		received += p.Amount
+		if p.Height > 0 && p.Confirmations >= inv.RequiredConfirmations ||
+			inv.RequiredConfirmations == 0 {
+			confirmed += p.Amount
+		}
+	}
+	changed := received != inv.Received || confirmed != inv.Confirmed || len(payments) != len(inv.Payments)
+	for i := 0; !changed && i < len(payments); i++ {
+		changed = payments[i] != inv.Payments[i]
+	}
+	inv.Received, inv.Confirmed, inv.Payments = received, confirmed, payments
+	return changed
+}
+
+// Run polls until the context is done.
+func (t *Tracker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := t.Poll(); err != nil && t.cfg.OnError != nil {
+			t.cfg.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
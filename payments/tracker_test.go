@@ -0,0 +1,183 @@
+package payments
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testWallet is a monero-wallet-rpc stand-in serving canned transfers.
+type testWallet struct {
+	mu        sync.Mutex
+	height    uint64
+	next      uint64
+	transfers walletrpc.GetTransfersResponse
+	lastReq   walletrpc.GetTransfersRequest
+	payments  []walletrpc.Payment
+	lastMin   uint
+}
+
+func (w *testWallet) serve() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     uint64          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(rw, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		var result interface{}
+		switch req.Method {
+		case "getheight":
+			result = walletrpc.H{"height": w.height}
+		case "create_address":
+			w.next++
+			result = walletrpc.H{"address": testAddress, "address_index": w.next}
+		case "get_transfers":
+			json.Unmarshal(req.Params, &w.lastReq)
+			result = w.transfers
+		case "get_bulk_payments":
+			var in struct {
+				MinBlockHeight uint `json:"min_block_height"`
+			}
+			json.Unmarshal(req.Params, &in)
+			w.lastMin = in.MinBlockHeight
+			var out []walletrpc.Payment
+			for _, p := range w.payments {
+				if p.BlockHeight > uint64(in.MinBlockHeight) {
+					out = append(out, p)
+				}
+			}
+			result = walletrpc.H{"payments": out}
+		default:
+			http.Error(rw, "unknown method", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(rw).Encode(walletrpc.H{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+}
+
+const testAddress = "45eoXYNHC4LcL2Hh42T9FMPTmZHyDEwDbgfBEuNj3RZUek8A4og4KiCfVL6ZmvHBfCALnggWtHH7QHF8426yRayLQq7MLf5"
+
+func incoming(txid string, minor, amount, height uint64) walletrpc.Transfer {
+	return walletrpc.Transfer{
+		TxID:         txid,
+		Amount:       amount,
+		Height:       height,
+		SubaddrIndex: walletrpc.SubaddressIndex{Minor: minor},
+	}
+}
+
+func TestTracker(t *testing.T) {
+	w := &testWallet{height: 100}
+	sv := w.serve()
+	defer sv.Close()
+
+	now := time.Unix(1500000000, 0)
+	var changes []State
+	tr := NewTracker(Config{
+		Wallet:        walletrpc.New(walletrpc.Config{Address: sv.URL + "/json_rpc"}),
+		Now:           func() time.Time { return now },
+		OnStateChange: func(inv Invoice, prev State) { changes = append(changes, inv.State) },
+	})
+
+	inv, err := tr.Create(InvoiceRequest{ID: "a", Amount: 1000, Confirmations: 2, Expiry: time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), inv.AddressIndex)
+	assert.Equal(t, StatePending, inv.State)
+	_, err = tr.Create(InvoiceRequest{ID: "a", Amount: 1000})
+	assert.Error(t, err)
+	_, err = tr.Create(InvoiceRequest{Amount: 0})
+	assert.Error(t, err)
+
+	assert.NoError(t, tr.Poll())
+	assert.Equal(t, uint64(99), w.lastReq.MinHeight)
+	assert.Equal(t, uint64(100), w.lastReq.MaxHeight)
+	assert.Equal(t, []uint64{1}, w.lastReq.SubaddrIndices)
+	assert.Empty(t, changes)
+
+	w.transfers.Pool = []walletrpc.Transfer{incoming("t1", 1, 400, 0)}
+	assert.NoError(t, tr.Poll())
+
+	w.transfers.Pool = nil
+	w.transfers.In = []walletrpc.Transfer{incoming("t1", 1, 400, 101), incoming("other", 2, 5000, 101)}
+	w.height = 102
+	assert.NoError(t, tr.Poll())
+
+	w.transfers.In = append(w.transfers.In, incoming("t2", 1, 600, 102))
+	w.height = 103
+	assert.NoError(t, tr.Poll())
+
+	w.height = 104
+	assert.NoError(t, tr.Poll())
+
+	assert.Equal(t, []State{StateSeenInPool, StatePartiallyPaid, StatePaid, StateConfirmed}, changes)
+	inv, err = tr.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000), inv.Confirmed)
+	assert.Len(t, inv.Payments, 2)
+
+	// final invoices are not polled anymore
+	w.transfers.In = append(w.transfers.In, incoming("t3", 1, 1, 104))
+	assert.NoError(t, tr.Poll())
+	assert.Len(t, changes, 4)
+}
+
+func TestTrackerExpiryAndOverpay(t *testing.T) {
+	w := &testWallet{height: 10}
+	sv := w.serve()
+	defer sv.Close()
+
+	now := time.Unix(1500000000, 0)
+	states := make(map[string]State)
+	tr := NewTracker(Config{
+		Wallet:        walletrpc.New(walletrpc.Config{Address: sv.URL + "/json_rpc"}),
+		Now:           func() time.Time { return now },
+		OnStateChange: func(inv Invoice, prev State) { states[inv.ID] = inv.State },
+	})
+	_, err := tr.Create(InvoiceRequest{ID: "late", Amount: 1000, Expiry: time.Minute})
+	assert.NoError(t, err)
+	_, err = tr.Create(InvoiceRequest{ID: "generous", Amount: 1000, Expiry: time.Minute})
+	assert.NoError(t, err)
+
+	w.transfers.Pool = []walletrpc.Transfer{incoming("t1", 2, 1500, 0)}
+	assert.NoError(t, tr.Poll())
+	assert.Equal(t, StateOverpaid, states["generous"])
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, tr.Poll())
+	assert.Equal(t, StateExpired, states["late"])
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invoices.json")
+	s, err := NewFileStore(path)
+	assert.NoError(t, err)
+	_, err = s.Get("x")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, s.Save(Invoice{ID: "x", Amount: 1, State: StatePending}))
+	assert.NoError(t, s.Save(Invoice{ID: "y", Amount: 2, State: StateConfirmed,
+		Payments: []Payment{{TxID: "t", Amount: 2, Height: 5}}}))
+
+	s, err = NewFileStore(path)
+	assert.NoError(t, err)
+	inv, err := s.Get("y")
+	assert.NoError(t, err)
+	assert.Equal(t, "t", inv.Payments[0].TxID)
+	open, err := s.Open()
+	assert.NoError(t, err)
+	assert.Len(t, open, 1)
+	assert.Equal(t, "x", open[0].ID)
+}
@@ -0,0 +1,335 @@
+// Package planner predicts whether a transfer can be sent.
+//
+// A wallet with enough unlocked balance may still refuse a transfer: the
+// change of a previous transfer is locked for 10 blocks, hundreds of small
+// outputs make a transaction too large, and dust costs more in fees than
+// it's worth. The Planner looks at the spendable outputs and explains why a
+// transfer can't be sent, how long to wait, and whether to consolidate the
+// outputs first.
+package planner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+const (
+	// spendableAge is CRYPTONOTE_DEFAULT_TX_SPENDABLE_AGE
+	spendableAge = 10
+	// maxBlockNumber is CRYPTONOTE_MAX_BLOCK_NUMBER, unlock times
+	// above it are unix timestamps
+	maxBlockNumber = 500000000
+	// blockTime is DIFFICULTY_TARGET_V2
+	blockTime = 2 * time.Minute
+)
+
+// Wallet is the subset of *walletrpc.Client used by the Planner.
+type Wallet interface {
+	GetHeight() (uint64, error)
+	GetIncomingTransfers(req walletrpc.IncomingTransfersRequest) ([]walletrpc.IncTransfer, error)
+	GetTransfers(req walletrpc.GetTransfersRequest) (walletrpc.GetTransfersResponse, error)
+}
+
+// Config holds the configuration of a Planner. The fees are estimates, the
+// wallet computes the real ones from the transaction weight.
+type Config struct {
+	Wallet Wallet
+	// AccountIndex is the account the transfers are sent from, and
+	// SubaddrIndices (optional) the subaddresses whose outputs they spend.
+	AccountIndex   uint64
+	SubaddrIndices []uint64
+	// BaseFee is the fee of a transaction with one input and two outputs.
+	// Defaults to 0.00003 XMR.
+	BaseFee uint64
+	// InputFee is the fee of every additional input. Defaults to
+	// 0.00001 XMR.
+	InputFee uint64
+	// DustThreshold is the amount under which an output isn't worth
+	// spending. Defaults to InputFee.
+	DustThreshold uint64
+	// MaxInputs is the number of inputs above which a transaction is
+	// considered too large. Defaults to 100.
+	MaxInputs int
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Reason explains why a transfer can't be sent.
+type Reason string
+
+// Reasons
+const (
+	// ReasonNone - the transfer can be sent
+	ReasonNone Reason = ""
+	// ReasonInsufficientFunds - the wallet doesn't hold enough, locked or not
+	ReasonInsufficientFunds Reason = "insufficient_funds"
+	// ReasonLocked - enough funds, but part of them are still locked
+	ReasonLocked Reason = "locked"
+	// ReasonFragmented - enough unlocked funds, spread over too many outputs
+	ReasonFragmented Reason = "fragmented"
+	// ReasonDust - enough funds only counting the dust outputs
+	ReasonDust Reason = "dust"
+)
+
+// Plan is the prediction for a transfer.
+type Plan struct {
+	// Amount requested
+	Amount uint64
+	// Fee estimated for the inputs selected
+	Fee uint64
+	// Inputs is the number of outputs the transfer would spend.
+	Inputs int
+
+	CanSend bool
+	Reason  Reason
+	// Explanation is a sentence for humans.
+	Explanation string
+
+	// Unlocked is the amount of the spendable outputs, dust excluded.
+	Unlocked uint64
+	// Locked is the amount of the outputs not yet spendable.
+	Locked uint64
+	// Dust is the amount of the outputs under the dust threshold, and
+	// DustOutputs their number.
+	Dust        uint64
+	DustOutputs int
+	// Frozen is the amount of the outputs excluded from spending.
+	Frozen uint64
+
+	// WaitBlocks and Wait estimate when enough funds unlock, for
+	// ReasonLocked.
+	WaitBlocks uint64
+	Wait       time.Duration
+	// Consolidate suggests sweeping the outputs together first, to be
+	// able to send (ReasonFragmented and ReasonDust) or to keep the
+	// transfer small.
+	Consolidate bool
+}
+
+// Err returns nil if the transfer can be sent, and a *CantSendError
+// otherwise.
+func (p Plan) Err() error {
+	if p.CanSend {
+		return nil
+	}
+	return &CantSendError{Plan: p}
+}
+
+// CantSendError is the error of a transfer that would fail.
+type CantSendError struct {
+	Plan Plan
+}
+
+func (e *CantSendError) Error() string {
+	return "can't send: " + e.Plan.Explanation
+}
+
+// Planner predicts transfers.
+type Planner struct {
+	cfg Config
+}
+
+// New returns a Planner for the configuration.
+func New(cfg Config) *Planner {
+	if cfg.BaseFee == 0 {
+		cfg.BaseFee = 30000000
+	}
+	if cfg.InputFee == 0 {
+		cfg.InputFee = 10000000
+	}
+	if cfg.DustThreshold == 0 {
+		cfg.DustThreshold = cfg.InputFee
+	}
+	if cfg.MaxInputs <= 0 {
+		cfg.MaxInputs = 100
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Planner{cfg: cfg}
+}
+
+// output is a spendable output and the height it unlocks at.
+type output struct {
+	amount       uint64
+	unlockHeight uint64
+}
+
+// Plan predicts whether amount can be sent now.
+func (p *Planner) Plan(amount uint64) (Plan, error) {
+	height, err := p.cfg.Wallet.GetHeight()
+	if err != nil {
+		return Plan{}, err
+	}
+	transfers, err := p.cfg.Wallet.GetIncomingTransfers(walletrpc.IncomingTransfersRequest{
+		TransferType:   walletrpc.TransferAvailable,
+		AccountIndex:   p.cfg.AccountIndex,
+		SubaddrIndices: p.cfg.SubaddrIndices,
+	})
+	if err != nil {
+		return Plan{}, err
+	}
+	unlockHeights, err := p.unlockHeights(transfers, height)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	var unlocked, locked []output
+	plan := Plan{Amount: amount}
+	for _, in := range transfers {
+		if in.Spent {
+			continue
+		}
+		if in.Frozen {
+			plan.Frozen += in.Amount
+			continue
+		}
+		o := output{amount: in.Amount, unlockHeight: in.BlockHeight + spendableAge}
+		if unlockHeights[in.TxHash] > o.unlockHeight {
+			o.unlockHeight = unlockHeights[in.TxHash]
+		}
+		switch {
+		case o.unlockHeight > height:
+			plan.Locked += o.amount
+			locked = append(locked, o)
+		case o.amount < p.cfg.DustThreshold:
+			plan.Dust += o.amount
+			plan.DustOutputs++
+		default:
+			plan.Unlocked += o.amount
+			unlocked = append(unlocked, o)
+		}
+	}
+
+	// spend the largest outputs first
+	sort.Slice(unlocked, func(i, j int) bool { return unlocked[i].amount > unlocked[j].amount })
+	var total uint64
+	for _, o := range unlocked {
+		if total >= amount+p.fee(plan.Inputs) {
+			break
+		}
+		total += o.amount
+		plan.Inputs++
+	}
+	plan.Fee = p.fee(plan.Inputs)
+	need := amount + plan.Fee
+	waitBlocks, unlocks := p.waitBlocks(locked, total, plan.Inputs, amount, height)
+
+	switch {
+	case total >= need && plan.Inputs <= p.cfg.MaxInputs:
+		plan.CanSend = true
+		plan.Consolidate = plan.Inputs > p.cfg.MaxInputs/2
+		plan.Explanation = fmt.Sprintf("%v spends %v outputs with a fee of about %v",
+			xmr(amount), plan.Inputs, xmr(plan.Fee))
+
+	case total >= need:
+		plan.Reason = ReasonFragmented
+		plan.Consolidate = true
+		plan.Explanation = fmt.Sprintf("%v needs %v outputs, more than the %v a transaction can spend: consolidate the outputs first",
+			xmr(amount), plan.Inputs, p.cfg.MaxInputs)
+
+	case unlocks:
+		plan.Reason = ReasonLocked
+		plan.WaitBlocks = waitBlocks
+		plan.Wait = time.Duration(plan.WaitBlocks) * blockTime
+		plan.Explanation = fmt.Sprintf("%v of the %v needed are unlocked, enough funds unlock in %v blocks (about %v)",
+			xmr(plan.Unlocked), xmr(need), plan.WaitBlocks, plan.Wait)
+
+	case plan.Dust > 0 && plan.Unlocked+plan.Locked+plan.Dust >= need:
+		plan.Reason = ReasonDust
+		plan.Consolidate = true
+		plan.Explanation = fmt.Sprintf("%v of the funds are in %v dust outputs worth less than the fee to spend them: sweep the dust first",
+			xmr(plan.Dust), plan.DustOutputs)
+
+	default:
+		plan.Reason = ReasonInsufficientFunds
+		plan.Explanation = fmt.Sprintf("%v needed but the wallet holds %v", xmr(need),
+			xmr(plan.Unlocked+plan.Locked+plan.Dust))
+	}
+	return plan, nil
+}
+
+// Check returns the error of Plan.Err, or of the wallet.
+func (p *Planner) Check(amount uint64) error {
+	plan, err := p.Plan(amount)
+	if err != nil {
+		return err
+	}
+	return plan.Err()
+}
+
+func (p *Planner) fee(inputs int) uint64 {
+	if inputs <= 1 {
+		return p.cfg.BaseFee
+	}
+	return p.cfg.BaseFee + uint64(inputs-1)*p.cfg.InputFee
+}
+
+// waitBlocks returns the number of blocks before the locked outputs,
+// added to the unlocked ones, cover the amount and the fee of the inputs,
+// and false if they never do.
+func (p *Planner) waitBlocks(locked []output, total uint64, inputs int, amount, height uint64) (uint64, bool) {
+	sort.Slice(locked, func(i, j int) bool { return locked[i].unlockHeight < locked[j].unlockHeight })
+	for _, o := range locked {
+		total += o.amount
+		inputs++
+		if total >= amount+p.fee(inputs) {
+			return o.unlockHeight - height, true
+		}
+	}
+	return 0, false
+}
+
+// unlockHeights returns the heights the outputs old enough to be spendable
+// but not unlocked (locked by an unlock time, or of a wallet not reporting
+// the unlocked flag) unlock at, by transaction. The unlock times are read
+// in a single get_transfers call, and estimated when given as timestamps.
+func (p *Planner) unlockHeights(transfers []walletrpc.IncTransfer, height uint64) (map[string]uint64, error) {
+	heights := make(map[string]uint64)
+	minHeight := height
+	for _, in := range transfers {
+		if !in.Spent && !in.Frozen && !in.Unlocked && in.BlockHeight+spendableAge <= height {
+			heights[in.TxHash] = 0
+			if in.BlockHeight < minHeight {
+				minHeight = in.BlockHeight
+			}
+		}
+	}
+	if len(heights) == 0 {
+		return heights, nil
+	}
+	req := walletrpc.GetTransfersRequest{
+		In:             true,
+		AccountIndex:   p.cfg.AccountIndex,
+		SubaddrIndices: p.cfg.SubaddrIndices,
+	}
+	if minHeight > 0 {
+		// min_height is exclusive
+		req.FilterByHeight = true
+		req.MinHeight = minHeight - 1
+	}
+	resp, err := p.cfg.Wallet.GetTransfers(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, tr := range resp.In {
+		if _, ok := heights[tr.TxID]; !ok {
+			continue
+		}
+		if tr.UnlockTime < maxBlockNumber {
+			heights[tr.TxID] = tr.UnlockTime
+			continue
+		}
+		if wait := time.Unix(int64(tr.UnlockTime), 0).Sub(p.cfg.Now()); wait > 0 {
+			heights[tr.TxID] = height + uint64((wait+blockTime-1)/blockTime)
+		}
+	}
+	return heights, nil
+}
+
+func xmr(amount uint64) string {
+	return fmt.Sprintf("%v XMR", walletrpc.XMRToDecimal(amount))
+}
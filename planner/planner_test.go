@@ -0,0 +1,204 @@
+package planner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWallet struct {
+	height    uint64
+	transfers []walletrpc.IncTransfer
+	unlock    map[string]uint64
+	lookups   int
+}
+
+func (w *testWallet) GetHeight() (uint64, error) {
+	return w.height, nil
+}
+
+func (w *testWallet) GetIncomingTransfers(req walletrpc.IncomingTransfersRequest) ([]walletrpc.IncTransfer, error) {
+	var transfers []walletrpc.IncTransfer
+	for _, in := range w.transfers {
+		if in.SubaddrIndex.Major == req.AccountIndex {
+			transfers = append(transfers, in)
+		}
+	}
+	return transfers, nil
+}
+
+func (w *testWallet) GetTransfers(req walletrpc.GetTransfersRequest) (resp walletrpc.GetTransfersResponse, err error) {
+	w.lookups++
+	for _, in := range w.transfers {
+		if in.SubaddrIndex.Major != req.AccountIndex || req.FilterByHeight && in.BlockHeight <= req.MinHeight {
+			continue
+		}
+		resp.In = append(resp.In, walletrpc.Transfer{TxID: in.TxHash, Height: in.BlockHeight, UnlockTime: w.unlock[in.TxHash]})
+	}
+	return
+}
+
+func (w *testWallet) add(n int, amount, height uint64) {
+	for i := 0; i < n; i++ {
+		w.transfers = append(w.transfers, walletrpc.IncTransfer{
+			Amount:      amount,
+			TxHash:      fmt.Sprintf("tx%v", len(w.transfers)),
+			BlockHeight: height,
+			Unlocked:    height+spendableAge <= w.height,
+		})
+	}
+}
+
+const xmrUnit = 1e12
+
+func newPlanner(w *testWallet) *Planner {
+	return New(Config{Wallet: w, BaseFee: 100, InputFee: 10, MaxInputs: 4})
+}
+
+func TestPlan(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(1, 5*xmrUnit, 900)
+	w.add(1, 1*xmrUnit, 995)
+	p := newPlanner(w)
+
+	plan, err := p.Plan(4 * xmrUnit)
+	assert.NoError(t, err)
+	assert.True(t, plan.CanSend)
+	assert.NoError(t, plan.Err())
+	assert.Equal(t, 1, plan.Inputs)
+	assert.Equal(t, uint64(100), plan.Fee)
+	assert.Equal(t, uint64(5*xmrUnit), plan.Unlocked)
+	assert.Equal(t, uint64(1*xmrUnit), plan.Locked)
+
+	// the change of the last transfer unlocks in 5 blocks
+	plan, err = p.Plan(5.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.False(t, plan.CanSend)
+	assert.Equal(t, ReasonLocked, plan.Reason)
+	assert.Equal(t, uint64(5), plan.WaitBlocks)
+	assert.Equal(t, 10*time.Minute, plan.Wait)
+	err = plan.Err()
+	assert.IsType(t, &CantSendError{}, err)
+	assert.Contains(t, err.Error(), "unlock in 5 blocks")
+
+	plan, err = p.Plan(7 * xmrUnit)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonInsufficientFunds, plan.Reason)
+}
+
+func TestPlanLockedShortOfFee(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(1, 1000, 900)
+	w.add(1, 100, 995)
+	p := newPlanner(w)
+
+	// enough once the locked output unlocks, but not for the fee of a
+	// second input
+	plan, err := p.Plan(1000)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonInsufficientFunds, plan.Reason)
+	assert.Equal(t, uint64(0), plan.WaitBlocks)
+
+	plan, err = p.Plan(990)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonLocked, plan.Reason)
+	assert.Equal(t, uint64(5), plan.WaitBlocks)
+}
+
+func TestPlanAccount(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(1, xmrUnit, 900)
+	w.add(2, xmrUnit, 900)
+	w.transfers[1].SubaddrIndex.Major = 1
+	w.transfers[2].SubaddrIndex.Major = 1
+	p := New(Config{Wallet: w, AccountIndex: 1, BaseFee: 100, InputFee: 10})
+
+	plan, err := p.Plan(1.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.True(t, plan.CanSend)
+	assert.Equal(t, uint64(2*xmrUnit), plan.Unlocked)
+
+	p = newPlanner(w)
+	plan, err = p.Plan(1.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonInsufficientFunds, plan.Reason)
+}
+
+func TestPlanFragmented(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(10, xmrUnit, 900)
+	p := newPlanner(w)
+
+	plan, err := p.Plan(3 * xmrUnit)
+	assert.NoError(t, err)
+	assert.True(t, plan.CanSend)
+	assert.True(t, plan.Consolidate)
+	assert.Equal(t, 4, plan.Inputs)
+
+	plan, err = p.Plan(6 * xmrUnit)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonFragmented, plan.Reason)
+	assert.True(t, plan.Consolidate)
+}
+
+func TestPlanDust(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(1, 100, 900)
+	w.add(50, 5, 900)
+	p := newPlanner(w)
+
+	plan, err := p.Plan(50)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonDust, plan.Reason)
+	assert.Equal(t, 50, plan.DustOutputs)
+	assert.Equal(t, uint64(250), plan.Dust)
+}
+
+func TestPlanUnlockTime(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(1, xmrUnit, 900)
+	w.add(1, xmrUnit, 900)
+	w.transfers[1].Unlocked = false
+	w.add(1, xmrUnit, 950)
+	w.transfers[2].Unlocked = false
+	w.unlock = map[string]uint64{"tx1": 1020, "tx2": 1010}
+	p := newPlanner(w)
+
+	plan, err := p.Plan(1.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonLocked, plan.Reason)
+	assert.Equal(t, uint64(10), plan.WaitBlocks)
+	assert.Equal(t, 1, w.lookups, "one get_transfers for all the unlock times")
+	w.transfers = w.transfers[:2]
+
+	// a timestamp unlock time
+	now := time.Unix(1600000000, 0)
+	w.unlock["tx1"] = uint64(now.Add(time.Hour).Unix())
+	p.cfg.Now = func() time.Time { return now }
+	plan, err = p.Plan(1.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(30), plan.WaitBlocks)
+
+	// an older wallet without the unlocked flag
+	w.transfers[1].Unlocked = false
+	w.transfers[0].Unlocked = false
+	delete(w.unlock, "tx1")
+	plan, err = p.Plan(1.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.True(t, plan.CanSend)
+}
+
+func TestPlanFrozen(t *testing.T) {
+	w := &testWallet{height: 1000}
+	w.add(2, xmrUnit, 900)
+	w.transfers[0].Frozen = true
+	p := newPlanner(w)
+
+	plan, err := p.Plan(1.5 * xmrUnit)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonInsufficientFunds, plan.Reason)
+	assert.Equal(t, uint64(xmrUnit), plan.Frozen)
+}
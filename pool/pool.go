@@ -0,0 +1,399 @@
+// Package pool routes the calls to many wallets across a few
+// monero-wallet-rpc servers.
+//
+// A monero-wallet-rpc server has a single wallet open at a time. The Pool
+// keeps track of the wallet open on every backend, calls a wallet on the
+// backend that has it open, and otherwise opens it on a free backend or on
+// the one whose wallet was used least recently, storing and closing that
+// wallet first. The calls to a backend share its wallet, up to a limit,
+// and a wallet is only closed once its calls returned.
+//
+// Backends are checked periodically, and one that stops answering gets no
+// more calls. Its wallet may still be open there, and opening it elsewhere
+// would let the stale copy overwrite the file later: the calls to it fail
+// with ErrWalletUnavailable until the backend answers again, then the
+// wallet is stored and closed before the backend is used again.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// ErrNoBackend is returned when no backend is healthy.
+var ErrNoBackend = errors.New("pool: no healthy backend")
+
+// ErrWalletUnavailable is returned for a wallet open on an unhealthy
+// backend.
+var ErrWalletUnavailable = errors.New("pool: wallet open on an unhealthy backend")
+
+// Config holds the configuration of a Pool.
+type Config struct {
+	// Backends are the clients of the monero-wallet-rpc servers, which
+	// must not be used outside of the pool.
+	Backends []*walletrpc.Client
+	// Password returns the password of a wallet.
+	Password func(wallet string) (walletrpc.Secret, error)
+	// MaxConcurrent is the number of calls a backend serves at once.
+	// Defaults to 4.
+	MaxConcurrent int
+	// HealthInterval between two health checks in Run. Defaults to 30
+	// seconds.
+	HealthInterval time.Duration
+	// HealthTimeout of a health check call. Defaults to 10 seconds.
+	HealthTimeout time.Duration
+	// OnError (optional) is called with the errors the callers don't get:
+	// failed health checks and wallets failing to store before closing.
+	// It may be called concurrently.
+	OnError func(error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// backend is a monero-wallet-rpc server, guarded by Pool.mu unless noted.
+type backend struct {
+	index  int
+	client *walletrpc.Client
+	// sem limits the calls in progress
+	sem chan struct{}
+	// rw is held for writing to switch wallets, and for reading by the
+	// calls
+	rw sync.RWMutex
+
+	// wallet is open, or being opened if !ready
+	wallet string
+	ready  bool
+	// users are the calls routed to the backend and not yet returned,
+	// which keep its wallet open
+	users    int
+	lastUsed time.Time
+	healthy  bool
+	// closing is set while the wallet of a backend answering again is
+	// closed
+	closing bool
+}
+
+// Pool routes calls to wallets.
+type Pool struct {
+	cfg      Config
+	mu       sync.Mutex
+	released *sync.Cond
+	backends []*backend
+}
+
+// New returns a Pool for the configuration. The backends are assumed
+// healthy, with no wallet open.
+func New(cfg Config) *Pool {
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 4
+	}
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = 30 * time.Second
+	}
+	if cfg.HealthTimeout <= 0 {
+		cfg.HealthTimeout = 10 * time.Second
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	p := &Pool{cfg: cfg}
+	p.released = sync.NewCond(&p.mu)
+	for i, c := range cfg.Backends {
+		p.backends = append(p.backends, &backend{
+			index:   i,
+			client:  c,
+			sem:     make(chan struct{}, cfg.MaxConcurrent),
+			healthy: true,
+		})
+	}
+	return p
+}
+
+// Do calls fn with the client of a backend that has the wallet open. fn
+// must not open or close wallets.
+func (p *Pool) Do(wallet string, fn func(*walletrpc.Client) error) error {
+	for {
+		b, err := p.acquire(wallet)
+		if err != nil {
+			return err
+		}
+		b.rw.RLock()
+		p.mu.Lock()
+		ok := b.wallet == wallet && b.ready
+		p.mu.Unlock()
+		if !ok {
+			// failed to open, or closed by a health check: route again
+			b.rw.RUnlock()
+			p.release(b)
+			continue
+		}
+		b.sem <- struct{}{}
+		err = fn(b.client)
+		<-b.sem
+		b.rw.RUnlock()
+		p.release(b)
+		return err
+	}
+}
+
+// acquire returns the backend of a wallet, opening it if needed, with a
+// user added.
+func (p *Pool) acquire(wallet string) (*backend, error) {
+	p.mu.Lock()
+	for {
+		if b := p.route(wallet); b != nil {
+			switch {
+			case b.healthy:
+				b.users++
+				p.mu.Unlock()
+				return b, nil
+			case !b.closing:
+				p.mu.Unlock()
+				return nil, fmt.Errorf("%w: %v on backend %v", ErrWalletUnavailable, wallet, b.index)
+			}
+			// the backend answers again and closes the wallet
+			p.released.Wait()
+			continue
+		}
+		b, err := p.evictable()
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		if b != nil {
+			return p.open(b, wallet)
+		}
+		// every backend is in use
+		p.released.Wait()
+	}
+}
+
+// route returns the backend that has the wallet open or is opening it,
+// healthy or not, p.mu being held.
+func (p *Pool) route(wallet string) *backend {
+	for _, b := range p.backends {
+		if b.wallet == wallet {
+			return b
+		}
+	}
+	return nil
+}
+
+// evictable returns a healthy backend without users, preferably without a
+// wallet, or else the one used least recently, p.mu being held.
+func (p *Pool) evictable() (*backend, error) {
+	var best *backend
+	healthy := false
+	for _, b := range p.backends {
+		if !b.healthy {
+			continue
+		}
+		healthy = true
+		if b.users > 0 {
+			continue
+		}
+		if b.wallet == "" {
+			return b, nil
+		}
+		if best == nil || b.lastUsed.Before(best.lastUsed) {
+			best = b
+		}
+	}
+	if !healthy {
+		return nil, ErrNoBackend
+	}
+	return best, nil
+}
+
+// open switches the backend to the wallet, p.mu being held and released.
+func (p *Pool) open(b *backend, wallet string) (*backend, error) {
+	old := b.wallet
+	b.wallet, b.ready = wallet, false
+	b.users++
+	// without users, nothing holds rw
+	b.rw.Lock()
+	p.mu.Unlock()
+
+	err := p.switchWallet(b, old, wallet)
+
+	p.mu.Lock()
+	if err != nil {
+		b.wallet = ""
+	}
+	b.ready = err == nil
+	p.mu.Unlock()
+	b.rw.Unlock()
+	if err != nil {
+		p.release(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *Pool) switchWallet(b *backend, old, wallet string) error {
+	if old != "" {
+		p.close(b, old)
+	}
+	password, err := p.cfg.Password(wallet)
+	if err != nil {
+		return err
+	}
+	return b.client.OpenWallet(wallet, password)
+}
+
+// close stores and closes the wallet of a backend, b.rw being held. It
+// returns the error of a backend not answering close_wallet, a wallet
+// error meaning that no wallet is open anymore.
+func (p *Pool) close(b *backend, wallet string) error {
+	if err := b.client.Store(); err != nil {
+		p.onError(fmt.Errorf("pool: backend %v: store %v: %v", b.index, wallet, err))
+	}
+	err := b.client.CloseWallet()
+	if err == nil {
+		return nil
+	}
+	p.onError(fmt.Errorf("pool: backend %v: close %v: %v", b.index, wallet, err))
+	if iswerr, _ := walletrpc.GetWalletError(err); iswerr {
+		return nil
+	}
+	return err
+}
+
+func (p *Pool) release(b *backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.users--
+	b.lastUsed = p.cfg.Now()
+	p.released.Broadcast()
+}
+
+// Check checks the health of the backends. A backend is unhealthy when it
+// doesn't answer a GetHeight call within HealthTimeout, errors of the
+// wallet excepted. An unhealthy backend keeps its wallet, which it may
+// still have open, and stores and closes it once it answers again.
+func (p *Pool) Check() {
+	var wg sync.WaitGroup
+	errs := make([]error, len(p.backends))
+	for i, b := range p.backends {
+		wg.Add(1)
+		go func(i int, b *backend) {
+			defer wg.Done()
+			errs[i] = p.check(b)
+		}(i, b)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			p.onError(fmt.Errorf("pool: backend %v: %v", i, err))
+		}
+	}
+}
+
+// check calls GetHeight on a backend, for HealthTimeout at most, and
+// updates its health.
+func (p *Pool) check(b *backend) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.HealthTimeout)
+	defer cancel()
+	_, err := b.client.WithContext(ctx).GetHeight()
+	if iswerr, _ := walletrpc.GetWalletError(err); iswerr {
+		// e.g. no wallet open
+		err = nil
+	}
+	p.mu.Lock()
+	recovered := err == nil && !b.healthy && b.wallet != ""
+	switch {
+	case recovered && b.closing:
+		// closed by another check
+		recovered = false
+	case recovered:
+		b.closing = true
+		b.users++
+	default:
+		b.healthy = err == nil
+	}
+	p.released.Broadcast()
+	p.mu.Unlock()
+	if recovered {
+		p.recover(b)
+	}
+	return err
+}
+
+// recover closes the wallet of a backend answering again, with a user
+// added, and makes it healthy. It stays unhealthy if it fails to.
+func (p *Pool) recover(b *backend) {
+	b.rw.Lock()
+	p.mu.Lock()
+	wallet := b.wallet
+	p.mu.Unlock()
+	var err error
+	if wallet != "" {
+		err = p.close(b, wallet)
+	}
+	p.mu.Lock()
+	b.closing = false
+	if err == nil {
+		b.wallet, b.ready, b.healthy = "", false, true
+	}
+	p.mu.Unlock()
+	b.rw.Unlock()
+	p.release(b)
+}
+
+// Run checks the backends every HealthInterval until the context is done.
+func (p *Pool) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		p.Check()
+	}
+}
+
+// Wallets returns the wallets open, by backend index.
+func (p *Pool) Wallets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	wallets := make([]string, len(p.backends))
+	for i, b := range p.backends {
+		if b.ready {
+			wallets[i] = b.wallet
+		}
+	}
+	return wallets
+}
+
+// Close stores and closes the wallets, waiting for their calls to return.
+func (p *Pool) Close() {
+	for _, b := range p.backends {
+		// a user keeps the backend from being switched meanwhile
+		p.mu.Lock()
+		b.users++
+		p.mu.Unlock()
+		b.rw.Lock()
+		p.mu.Lock()
+		wallet, ready := b.wallet, b.ready
+		b.wallet, b.ready = "", false
+		p.mu.Unlock()
+		if ready {
+			p.close(b, wallet)
+		}
+		b.rw.Unlock()
+		p.release(b)
+	}
+}
+
+func (p *Pool) onError(err error) {
+	if p.cfg.OnError != nil {
+		p.cfg.OnError(err)
+	}
+}
@@ -0,0 +1,259 @@
+package pool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer is a monero-wallet-rpc stand-in with a wallet open at a time.
+type fakeServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	open        string
+	log         []string
+	calls       int
+	maxCalls    int
+	down        bool
+	balanceWait time.Duration
+	heightWait  time.Duration
+}
+
+// balances of the wallets, the same on every server
+var balances = map[string]uint64{"a": 1, "b": 2, "c": 3, "d": 4}
+
+func newFakeServer() *fakeServer {
+	s := &fakeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     uint64 `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			Filename string `json:"filename"`
+			Password string `json:"password"`
+		} `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	if s.down {
+		s.mu.Unlock()
+		http.Error(w, "down", http.StatusBadGateway)
+		return
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": struct{}{}}
+	noWallet := map[string]interface{}{"code": -13, "message": "No wallet file"}
+	switch req.Method {
+	case "open_wallet":
+		s.open = ""
+		if req.Params.Password != "pw-"+req.Params.Filename {
+			resp["error"] = map[string]interface{}{"code": -1, "message": "invalid password"}
+			break
+		}
+		s.open = req.Params.Filename
+		s.log = append(s.log, "open "+s.open)
+	case "store", "close_wallet":
+		if s.open == "" {
+			resp["error"] = noWallet
+			break
+		}
+		s.log = append(s.log, req.Method+" "+s.open)
+		if req.Method == "close_wallet" {
+			s.open = ""
+		}
+	case "getheight":
+		s.mu.Unlock()
+		time.Sleep(s.heightWait)
+		s.mu.Lock()
+		if s.open == "" {
+			resp["error"] = noWallet
+			break
+		}
+		resp["result"] = map[string]uint64{"height": 1}
+	case "getbalance":
+		s.calls++
+		if s.calls > s.maxCalls {
+			s.maxCalls = s.calls
+		}
+		open := s.open
+		s.mu.Unlock()
+		time.Sleep(s.balanceWait)
+		s.mu.Lock()
+		s.calls--
+		resp["result"] = map[string]uint64{"balance": balances[open]}
+	}
+	s.mu.Unlock()
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *fakeServer) opened() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+func newPool(servers []*fakeServer, cfg Config) *Pool {
+	for _, s := range servers {
+		cfg.Backends = append(cfg.Backends, walletrpc.New(walletrpc.Config{Address: s.URL + "/json_rpc"}))
+	}
+	cfg.Password = func(wallet string) (walletrpc.Secret, error) {
+		return walletrpc.Secret("pw-" + wallet), nil
+	}
+	return New(cfg)
+}
+
+func balance(p *Pool, wallet string) (uint64, error) {
+	var balance uint64
+	err := p.Do(wallet, func(c *walletrpc.Client) error {
+		var err error
+		balance, _, err = c.GetBalance()
+		return err
+	})
+	return balance, err
+}
+
+func TestPoolLRU(t *testing.T) {
+	s0, s1 := newFakeServer(), newFakeServer()
+	defer s0.Close()
+	defer s1.Close()
+	now := time.Unix(0, 0)
+	p := newPool([]*fakeServer{s0, s1}, Config{Now: func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}})
+
+	for _, w := range []string{"a", "b", "a", "c", "b"} {
+		got, err := balance(p, w)
+		assert.NoError(t, err)
+		assert.Equal(t, balances[w], got, w)
+	}
+	// c evicted b, the least recently used, then b evicted a
+	assert.Equal(t, []string{"open a", "store a", "close_wallet a", "open b"}, s0.opened())
+	assert.Equal(t, []string{"open b", "store b", "close_wallet b", "open c"}, s1.opened())
+	assert.Equal(t, []string{"b", "c"}, p.Wallets())
+
+	p.Close()
+	assert.Equal(t, []string{"", ""}, p.Wallets())
+	assert.Equal(t, "close_wallet b", s0.opened()[len(s0.opened())-1])
+}
+
+func TestPoolConcurrency(t *testing.T) {
+	s0, s1 := newFakeServer(), newFakeServer()
+	defer s0.Close()
+	defer s1.Close()
+	s0.balanceWait, s1.balanceWait = 5*time.Millisecond, 5*time.Millisecond
+	p := newPool([]*fakeServer{s0, s1}, Config{MaxConcurrent: 2})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 60)
+	for i := 0; i < 60; i++ {
+		w := []string{"a", "b", "c", "d"}[i%4]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := balance(p, w)
+			if err == nil && got != balances[w] {
+				err = fmt.Errorf("%v routed to the wrong wallet: %v", w, got)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.True(t, s0.maxCalls <= 2 && s1.maxCalls <= 2)
+}
+
+func setDown(s *fakeServer, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func TestPoolHealth(t *testing.T) {
+	s0, s1 := newFakeServer(), newFakeServer()
+	defer s0.Close()
+	defer s1.Close()
+	var errs []error
+	p := newPool([]*fakeServer{s0, s1}, Config{OnError: func(err error) { errs = append(errs, err) }})
+
+	_, err := balance(p, "a")
+	assert.NoError(t, err)
+	_, err = balance(p, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, p.Wallets())
+
+	// s0 may still have a open: it isn't opened elsewhere
+	setDown(s0, true)
+	p.Check()
+	assert.Len(t, errs, 1)
+	assert.Equal(t, []string{"a", "b"}, p.Wallets())
+	_, err = balance(p, "a")
+	assert.True(t, errors.Is(err, ErrWalletUnavailable))
+	got, err := balance(p, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, balances["c"], got)
+	assert.Equal(t, []string{"open b", "store b", "close_wallet b", "open c"}, s1.opened())
+
+	// a is closed on s0 before s0 is used again
+	setDown(s0, false)
+	p.Check()
+	assert.Equal(t, []string{"open a", "store a", "close_wallet a"}, s0.opened())
+	assert.Equal(t, []string{"", "c"}, p.Wallets())
+	got, err = balance(p, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, balances["a"], got)
+	assert.Equal(t, []string{"a", "c"}, p.Wallets())
+
+	setDown(s0, true)
+	setDown(s1, true)
+	p.Check()
+	_, err = balance(p, "a")
+	assert.True(t, errors.Is(err, ErrWalletUnavailable))
+	_, err = balance(p, "d")
+	assert.True(t, errors.Is(err, ErrNoBackend))
+
+	setDown(s1, false)
+	p.Check()
+	assert.Equal(t, []string{"a", ""}, p.Wallets())
+	p.cfg.Password = func(string) (walletrpc.Secret, error) { return "wrong", nil }
+	_, err = balance(p, "d")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"a", ""}, p.Wallets())
+}
+
+func TestPoolHealthTimeout(t *testing.T) {
+	s0, s1 := newFakeServer(), newFakeServer()
+	defer s0.Close()
+	defer s1.Close()
+	s0.heightWait = time.Second
+	var errs []error
+	p := newPool([]*fakeServer{s0, s1}, Config{
+		HealthTimeout: 50 * time.Millisecond,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+
+	start := time.Now()
+	p.Check()
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Len(t, errs, 1)
+	_, err := balance(p, "a")
+	assert.NoError(t, err)
+	assert.Empty(t, s0.opened())
+	assert.Equal(t, []string{"open a"}, s1.opened())
+}
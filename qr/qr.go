@@ -0,0 +1,349 @@
+// Package qr renders monero: payment URIs as QR codes.
+//
+// The encoder is self contained (byte mode, versions 1-40, all four error
+// correction levels) so it can be used without cgo or third party packages.
+package qr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Level is the error correction level of a QR code.
+type Level int
+
+const (
+	// Low recovers ~7% of the codewords
+	Low Level = iota
+	// Medium recovers ~15% of the codewords
+	Medium
+	// Quartile recovers ~25% of the codewords
+	Quartile
+	// High recovers ~30% of the codewords
+	High
+)
+
+func (l Level) String() string {
+	switch l {
+	case Low:
+		return "L"
+	case Medium:
+		return "M"
+	case Quartile:
+		return "Q"
+	case High:
+		return "H"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// formatBits is the two bit value of the level in the format information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// QuietZone is the width, in modules, of the light border drawn around
+// rendered codes.
+const QuietZone = 4
+
+// ErrTooLong is returned when the data doesn't fit in a version 40 code.
+var ErrTooLong = errors.New("qr: data too long")
+
+// Code is an encoded QR code.
+type Code struct {
+	// Version is the QR version (1-40).
+	Version int
+	// Level is the error correction level.
+	Level Level
+	// Size is the width (and height) of the code in modules,
+	// not counting the quiet zone.
+	Size int
+
+	modules    []bool
+	isFunction []bool
+}
+
+// Black reports whether the module at x, y is dark. Coordinates outside
+// of the code (e.g. in the quiet zone) are light.
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y*c.Size+x]
+}
+
+// Encode encodes data as the smallest QR code that fits it at the given
+// error correction level.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("qr: invalid level %v", level)
+	}
+	for version := 1; version <= 40; version++ {
+		capacity := numDataCodewords(version, level) * 8
+		if 4+charCountBits(version)+len(data)*8 <= capacity {
+			return encodeVersion(data, version, level), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+// EncodeURI encodes a payment request, built with walletrpc.EncodeURI,
+// as a QR code.
+func EncodeURI(def walletrpc.URIDef, level Level) (*Code, error) {
+	uri, err := walletrpc.EncodeURI(def)
+	if err != nil {
+		return nil, err
+	}
+	return Encode([]byte(uri), level)
+}
+
+// EncodePaymentURI encodes a (possibly multi recipient) payment request
+// as a QR code.
+func EncodePaymentURI(p walletrpc.PaymentURI, level Level) (*Code, error) {
+	uri, err := p.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return Encode([]byte(uri), level)
+}
+
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+func encodeVersion(data []byte, version int, level Level) *Code {
+	capacity := numDataCodewords(version, level) * 8
+
+	var bb bitBuffer
+	bb.append(0x4, 4) // byte mode
+	bb.append(uint32(len(data)), charCountBits(version))
+	for _, b := range data {
+		bb.append(uint32(b), 8)
+	}
+	// terminator, then pad to a byte boundary and fill with the pad bytes
+	term := capacity - len(bb)
+	if term > 4 {
+		term = 4
+	}
+	bb.append(0, term)
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := uint32(0xEC); len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			codewords[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+
+	size := version*4 + 17
+	c := &Code{
+		Version:    version,
+		Level:      level,
+		Size:       size,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+	c.drawFunctionPatterns()
+	c.drawCodewords(addECCAndInterleave(codewords, version, level))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // XOR again to undo
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	c.isFunction = nil
+	return c
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, v>>uint(i)&1 != 0)
+	}
+}
+
+func (c *Code) set(x, y int, black bool) {
+	c.modules[y*c.Size+x] = black
+	c.isFunction[y*c.Size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	// timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	pos := alignmentPositions(c.Version)
+	n := len(pos)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			// skip the three corners occupied by finder patterns
+			if i == 0 && j == 0 || i == 0 && j == n-1 || i == n-1 && j == 0 {
+				continue
+			}
+			c.drawAlignment(pos[i], pos[j])
+		}
+	}
+
+	// reserve the format areas, the real bits are drawn per mask
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			dist := abs(dx)
+			if abs(dy) > dist {
+				dist = abs(dy)
+			}
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			dist := abs(dx)
+			if abs(dy) > dist {
+				dist = abs(dy)
+			}
+			c.set(cx+dx, cy+dy, dist != 1)
+		}
+	}
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	data := c.Level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	bit := func(i int) bool { return bits>>uint(i)&1 != 0 }
+
+	// first copy, around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	// second copy, split between the other two finders
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // the dark module
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := c.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		black := bits>>uint(i)&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, black)
+		c.set(b, a, black)
+	}
+}
+
+// drawCodewords places the data in the zigzag pattern, two columns at a
+// time from the bottom right, skipping function modules.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y*c.Size+x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y*c.Size+x] = data[i>>3]>>uint(7-i&7)&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.isFunction[y*c.Size+x] {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,96 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAddress = "45eoXYNHC4LcL2Hh42T9FMPTmZHyDEwDbgfBEuNj3RZUek8A4og4KiCfVL6ZmvHBfCALnggWtHH7QHF8426yRayLQq7MLf5"
+
+func TestEncodeVersion(t *testing.T) {
+	// a version 1 L code holds 17 bytes
+	c, err := Encode([]byte(strings.Repeat("a", 17)), Low)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c.Version)
+	assert.Equal(t, 21, c.Size)
+
+	c, err = Encode([]byte(strings.Repeat("a", 18)), Low)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Version)
+
+	c, err = Encode([]byte(strings.Repeat("a", 2953)), Low)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, c.Version)
+
+	_, err = Encode([]byte(strings.Repeat("a", 2954)), Low)
+	assert.Equal(t, ErrTooLong, err)
+
+	_, err = Encode([]byte("a"), Level(7))
+	assert.Error(t, err)
+}
+
+func TestFunctionPatterns(t *testing.T) {
+	c, err := Encode([]byte("monero:"+testAddress), High)
+	assert.NoError(t, err)
+	// finder patterns: dark ring, light ring, dark 3x3 center
+	for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		x, y := corner[0], corner[1]
+		assert.True(t, c.Black(x, y))
+		assert.False(t, c.Black(x+1, y+1))
+		assert.True(t, c.Black(x+3, y+3))
+	}
+	// timing pattern
+	for i := 8; i < c.Size-8; i++ {
+		assert.Equal(t, i%2 == 0, c.Black(6, i))
+		assert.Equal(t, i%2 == 0, c.Black(i, 6))
+	}
+	// the dark module
+	assert.True(t, c.Black(8, c.Size-8))
+	assert.False(t, c.Black(-1, 0))
+	assert.False(t, c.Black(0, c.Size))
+}
+
+func TestEncodeURI(t *testing.T) {
+	c, err := EncodeURI(walletrpc.URIDef{Address: testAddress, Amount: 1e10}, Medium)
+	assert.NoError(t, err)
+	assert.Equal(t, Medium, c.Level)
+
+	_, err = EncodeURI(walletrpc.URIDef{Address: "bogus"}, Medium)
+	assert.Error(t, err)
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode([]byte("monero:"+testAddress), Low)
+	assert.NoError(t, err)
+	width := c.Size + 2*QuietZone
+
+	b, err := c.PNG(width * 4)
+	assert.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, width*4, img.Bounds().Dx())
+	// top left pixel is quiet zone, the first finder module is dark
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	r, _, _, _ = img.At(QuietZone*4, QuietZone*4).RGBA()
+	assert.Equal(t, uint32(0), r)
+
+	// too small sizes fall back to one pixel per module
+	assert.Equal(t, width, c.Image(10).Bounds().Dx())
+
+	svg := c.SVG(256)
+	assert.True(t, strings.HasPrefix(svg, "<?xml"))
+	assert.Contains(t, svg, `width="256"`)
+	assert.Contains(t, svg, "M4,4h1v1h-1z")
+
+	lines := strings.Split(strings.TrimSuffix(c.Terminal(false), "\n"), "\n")
+	assert.Len(t, lines, (width+1)/2)
+	assert.Equal(t, width, len([]rune(lines[0])))
+	assert.Equal(t, strings.Repeat("█", width), lines[0])
+	assert.Equal(t, strings.Repeat(" ", width), strings.Split(c.Terminal(true), "\n")[0])
+}
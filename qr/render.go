@@ -0,0 +1,100 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// scale returns the number of pixels per module needed to render the
+// code (quiet zone included) in at most size pixels, and at least one.
+func (c *Code) scale(size int) int {
+	s := size / (c.Size + 2*QuietZone)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// Image renders the code as a black and white image of at most size x size
+// pixels. Modules are never smaller than one pixel, so a too small size is
+// rounded up.
+func (c *Code) Image(size int) image.Image {
+	scale := c.scale(size)
+	width := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[((y+QuietZone)*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[(x+QuietZone)*scale+dx] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG renders the code as a PNG image of at most size x size pixels.
+func (c *Code) PNG(size int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.Image(size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as a standalone SVG document of size x size user
+// units. The drawing is vector based, so any size renders crisply.
+func (c *Code) SVG(size int) string {
+	width := c.Size + 2*QuietZone
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		size, size, width, width)
+	fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	sb.WriteString(`<path fill="#000000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				fmt.Fprintf(&sb, "M%d,%dh1v1h-1z", x+QuietZone, y+QuietZone)
+			}
+		}
+	}
+	sb.WriteString(`"/>` + "\n</svg>\n")
+	return sb.String()
+}
+
+// Terminal renders the code with unicode half block characters, two
+// modules per character cell. Light modules are drawn as blocks, which is
+// what scanners need on the usual light-on-dark terminal; set invert for
+// terminals with a light background.
+func (c *Code) Terminal(invert bool) string {
+	var sb strings.Builder
+	filled := func(x, y int) bool { return c.Black(x, y) == invert }
+	for y := -QuietZone; y < c.Size+QuietZone; y += 2 {
+		for x := -QuietZone; x < c.Size+QuietZone; x++ {
+			top := filled(x, y)
+			bottom := y+1 < c.Size+QuietZone && filled(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,355 @@
+// Package supervisor runs monero-wallet-rpc as a child process.
+//
+// The command line is built from a typed Config. Start launches the
+// process and waits for its RPC server to answer; Run keeps it running,
+// restarting it with a backoff when it exits, until its context is done.
+// Stop asks the wallet to stop through the RPC, then sends SIGTERM and
+// finally SIGKILL to a process that doesn't exit in time.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// ErrNotRunning is returned by Stop when no process runs.
+var ErrNotRunning = errors.New("supervisor: not running")
+
+// Config holds the configuration of a Supervisor.
+type Config struct {
+	// Binary is the path of monero-wallet-rpc. Defaults to
+	// "monero-wallet-rpc", looked up in the PATH.
+	Binary string
+	// RPCBindIP (optional) is the address the RPC server listens on.
+	RPCBindIP string
+	// RPCBindPort is the port the RPC server listens on.
+	RPCBindPort int
+	// WalletDir is the directory of the wallets.
+	WalletDir string
+	// DaemonAddress (optional) is the host:port of monerod.
+	DaemonAddress string
+	// RPCLogin (optional) is the username:password of the RPC server, or
+	// DisableRPCLogin disables the authentication; with neither, the
+	// server makes up a login. The server uses HTTP digest
+	// authentication, which Client must then handle.
+	//
+	// RPCLogin is passed with --rpc-login, where the other users of the
+	// host can read it, e.g. with ps. To keep it out of the command line,
+	// write rpc-login=username:password to a file readable by the wallet
+	// only, pass --config-file with it in Args and leave RPCLogin empty.
+	RPCLogin        walletrpc.Secret
+	DisableRPCLogin bool
+	// LogLevel (optional) is the log level, 0 to 4, and LogFile the log
+	// file.
+	LogLevel *int
+	LogFile  string
+	// Args are appended to the command line.
+	Args []string
+	// Env (optional) is the environment of the process, defaults to the
+	// environment of the current process.
+	Env []string
+	// Stdout and Stderr (optional) receive the output of the process.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Client checks the readiness of the server and stops it. It's
+	// optional with DisableRPCLogin only: it defaults to a client of
+	// RPCBindIP:RPCBindPort, which doesn't authenticate.
+	Client *walletrpc.Client
+	// ReadyTimeout is how long Start waits for the server to answer.
+	// Defaults to one minute.
+	ReadyTimeout time.Duration
+	// PollInterval between two readiness checks, and their timeout.
+	// Defaults to 500ms.
+	PollInterval time.Duration
+	// StopTimeout is how long Stop waits for the process to exit after
+	// stop_wallet, and then after SIGTERM, before killing it. Defaults to
+	// 10 seconds.
+	StopTimeout time.Duration
+	// InitialBackoff is the delay before the first restart in Run,
+	// doubled at every restart up to MaxBackoff, and reset once the
+	// process ran for MaxBackoff. Default to 1 second and 1 minute.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// OnExit (optional) is called by Run when the process exits or fails
+	// to start, with the reason.
+	OnExit func(error)
+}
+
+// CommandArgs returns the command line arguments of the configuration.
+func (cfg Config) CommandArgs() ([]string, error) {
+	if cfg.RPCBindPort <= 0 {
+		return nil, errors.New("supervisor: no rpc bind port")
+	}
+	if cfg.RPCLogin != "" && cfg.DisableRPCLogin {
+		return nil, errors.New("supervisor: rpc login set and disabled")
+	}
+	args := []string{"--rpc-bind-port", strconv.Itoa(cfg.RPCBindPort)}
+	if cfg.RPCBindIP != "" {
+		args = append(args, "--rpc-bind-ip", cfg.RPCBindIP)
+	}
+	if cfg.WalletDir != "" {
+		args = append(args, "--wallet-dir", cfg.WalletDir)
+	}
+	if cfg.DaemonAddress != "" {
+		args = append(args, "--daemon-address", cfg.DaemonAddress)
+	}
+	if cfg.RPCLogin != "" {
+		args = append(args, "--rpc-login", cfg.RPCLogin.Reveal())
+	}
+	if cfg.DisableRPCLogin {
+		args = append(args, "--disable-rpc-login")
+	}
+	if cfg.LogLevel != nil {
+		args = append(args, "--log-level", strconv.Itoa(*cfg.LogLevel))
+	}
+	if cfg.LogFile != "" {
+		args = append(args, "--log-file", cfg.LogFile)
+	}
+	return append(args, cfg.Args...), nil
+}
+
+// Supervisor runs a monero-wallet-rpc process.
+type Supervisor struct {
+	cfg    Config
+	client *walletrpc.Client
+
+	mu sync.Mutex
+	// cmd is the running process, and exited is closed once it exited,
+	// with err its exit error
+	cmd    *exec.Cmd
+	exited chan struct{}
+	err    error
+}
+
+// New returns a Supervisor for the configuration.
+func New(cfg Config) (*Supervisor, error) {
+	if _, err := cfg.CommandArgs(); err != nil {
+		return nil, err
+	}
+	if cfg.Client == nil && !cfg.DisableRPCLogin {
+		return nil, errors.New("supervisor: rpc login without a client to authenticate")
+	}
+	if cfg.Binary == "" {
+		cfg.Binary = "monero-wallet-rpc"
+	}
+	if cfg.ReadyTimeout <= 0 {
+		cfg.ReadyTimeout = time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 500 * time.Millisecond
+	}
+	if cfg.StopTimeout <= 0 {
+		cfg.StopTimeout = 10 * time.Second
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	client := cfg.Client
+	if client == nil {
+		host := cfg.RPCBindIP
+		if host == "" || host == "0.0.0.0" {
+			host = "127.0.0.1"
+		}
+		client = walletrpc.New(walletrpc.Config{
+			Address: fmt.Sprintf("http://%v:%v/json_rpc", host, cfg.RPCBindPort),
+		})
+	}
+	return &Supervisor{cfg: cfg, client: client}, nil
+}
+
+// Client returns the client of the server.
+func (s *Supervisor) Client() *walletrpc.Client {
+	return s.client
+}
+
+// Start starts the process and waits for its RPC server to answer. The
+// process is killed if it doesn't in time.
+func (s *Supervisor) Start(ctx context.Context) error {
+	args, err := s.cfg.CommandArgs()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.cmd != nil {
+		s.mu.Unlock()
+		return errors.New("supervisor: already running")
+	}
+	cmd := exec.Command(s.cfg.Binary, args...)
+	cmd.Env = s.cfg.Env
+	cmd.Stdout = s.cfg.Stdout
+	cmd.Stderr = s.cfg.Stderr
+	if err := cmd.Start(); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("supervisor: %v", err)
+	}
+	exited := make(chan struct{})
+	s.cmd, s.exited = cmd, exited
+	s.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		s.mu.Lock()
+		s.err = err
+		s.cmd = nil
+		s.mu.Unlock()
+		close(exited)
+	}()
+
+	if err := s.waitReady(ctx, exited); err != nil {
+		cmd.Process.Kill()
+		<-exited
+		return err
+	}
+	return nil
+}
+
+// waitReady polls the server until it answers, for ReadyTimeout at most.
+func (s *Supervisor) waitReady(ctx context.Context, exited chan struct{}) error {
+	ready, cancel := context.WithTimeout(ctx, s.cfg.ReadyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		err := s.poll(ready)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ready.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("supervisor: not ready after %v: %v", s.cfg.ReadyTimeout, err)
+		case <-exited:
+			return fmt.Errorf("supervisor: exited before ready: %v", s.exitError())
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll calls GetHeight, for PollInterval at most, and returns nil if the
+// server answered: a wallet error means it runs without a wallet open, and
+// a 401 status that it listens but the client doesn't authenticate.
+func (s *Supervisor) poll(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.PollInterval)
+	defer cancel()
+	_, err := s.client.WithContext(ctx).GetHeight()
+	if iswerr, _ := walletrpc.GetWalletError(err); err == nil || iswerr {
+		return nil
+	}
+	var he *walletrpc.HTTPStatusError
+	if errors.As(err, &he) && he.StatusCode == http.StatusUnauthorized {
+		return nil
+	}
+	return err
+}
+
+// Exited returns a channel closed when the last process started exits,
+// nil if none was.
+func (s *Supervisor) Exited() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exited
+}
+
+func (s *Supervisor) exitError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		return errors.New("exit status 0")
+	}
+	return s.err
+}
+
+// Stop stops the process: with stop_wallet, which stores the wallet, then
+// SIGTERM and SIGKILL, waiting StopTimeout in between, stop_wallet
+// included.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.mu.Unlock()
+	if cmd == nil {
+		return ErrNotRunning
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.StopTimeout)
+	err := s.client.WithContext(ctx).StopWallet()
+	cancel()
+	if err == nil && s.wait(exited) {
+		return nil
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err == nil && s.wait(exited) {
+		return nil
+	}
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("supervisor: %v", err)
+	}
+	<-exited
+	return nil
+}
+
+// wait reports whether the process exited within StopTimeout.
+func (s *Supervisor) wait(exited chan struct{}) bool {
+	t := time.NewTimer(s.cfg.StopTimeout)
+	defer t.Stop()
+	select {
+	case <-exited:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// Run starts the process, restarting it when it exits or fails to start,
+// until the context is done, and then stops it.
+func (s *Supervisor) Run(ctx context.Context) error {
+	backoff := s.cfg.InitialBackoff
+	for {
+		started := time.Now()
+		err := s.Start(ctx)
+		if err == nil {
+			select {
+			case <-ctx.Done():
+				s.Stop()
+				return ctx.Err()
+			case <-s.Exited():
+				err = fmt.Errorf("supervisor: exited: %v", s.exitError())
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.cfg.OnExit != nil {
+			s.cfg.OnExit(err)
+		}
+
+		if time.Since(started) >= s.cfg.MaxBackoff {
+			backoff = s.cfg.InitialBackoff
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
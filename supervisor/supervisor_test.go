@@ -0,0 +1,299 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandArgs(t *testing.T) {
+	level := 2
+	args, err := Config{
+		RPCBindIP:     "127.0.0.1",
+		RPCBindPort:   18082,
+		WalletDir:     "/wallets",
+		DaemonAddress: "node:18081",
+		RPCLogin:      "user:pass",
+		LogLevel:      &level,
+		LogFile:       "/var/log/wallet.log",
+		Args:          []string{"--trusted-daemon"},
+	}.CommandArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--rpc-bind-port", "18082",
+		"--rpc-bind-ip", "127.0.0.1",
+		"--wallet-dir", "/wallets",
+		"--daemon-address", "node:18081",
+		"--rpc-login", "user:pass",
+		"--log-level", "2",
+		"--log-file", "/var/log/wallet.log",
+		"--trusted-daemon",
+	}, args)
+
+	args, err = Config{RPCBindPort: 1, DisableRPCLogin: true}.CommandArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--rpc-bind-port", "1", "--disable-rpc-login"}, args)
+
+	_, err = Config{}.CommandArgs()
+	assert.Error(t, err)
+	_, err = Config{RPCBindPort: 1, RPCLogin: "a:b", DisableRPCLogin: true}.CommandArgs()
+	assert.Error(t, err)
+}
+
+// TestFakeWallet isn't a test: it's the fake monero-wallet-rpc run by the
+// script of fakeConfig, when FAKE_WALLET is set to its behaviour:
+//
+//	normal   - stops on stop_wallet
+//	stubborn - ignores stop_wallet and SIGTERM
+//	hung     - never answers stop_wallet
+//	crash    - exits with status 1 after 50ms
+//	fail     - exits with status 1 right away
+func TestFakeWallet(t *testing.T) {
+	mode := os.Getenv("FAKE_WALLET")
+	if mode == "" {
+		return
+	}
+	args := os.Args
+	for i, a := range args {
+		if a == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	f, _ := os.OpenFile(os.Getenv("FAKE_WALLET_LOG"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	fmt.Fprintln(f, strings.Join(args, " "))
+	f.Close()
+
+	if mode == "fail" {
+		os.Exit(1)
+	}
+	if mode == "stubborn" {
+		signal.Ignore(syscall.SIGTERM)
+	}
+	if mode == "crash" {
+		time.AfterFunc(50*time.Millisecond, func() { os.Exit(1) })
+	}
+	port := "0"
+	for i := range args {
+		if args[i] == "--rpc-bind-port" && i+1 < len(args) {
+			port = args[i+1]
+		}
+	}
+	http.ListenAndServe("127.0.0.1:"+port, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     uint64 `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "stop_wallet":
+			if mode == "hung" {
+				select {}
+			}
+			resp["result"] = struct{}{}
+			if mode == "normal" {
+				time.AfterFunc(10*time.Millisecond, func() { os.Exit(0) })
+			}
+		default:
+			resp["error"] = map[string]interface{}{"code": -13, "message": "No wallet file"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	os.Exit(2)
+}
+
+// fakeConfig returns the configuration of a fake wallet, and the file its
+// command lines are written to.
+func fakeConfig(t *testing.T, mode string) (Config, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script")
+	}
+	dir, err := ioutil.TempDir("", "supervisor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "monero-wallet-rpc")
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestFakeWallet -- \"$@\"\n", os.Args[0])
+	if err := ioutil.WriteFile(binary, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "log")
+	return Config{
+		Binary:          binary,
+		RPCBindPort:     freePort(t),
+		WalletDir:       dir,
+		DisableRPCLogin: true,
+		Env:             append(os.Environ(), "FAKE_WALLET="+mode, "FAKE_WALLET_LOG="+log),
+		ReadyTimeout:    10 * time.Second,
+		PollInterval:    10 * time.Millisecond,
+		StopTimeout:     100 * time.Millisecond,
+		InitialBackoff:  10 * time.Millisecond,
+	}, log
+}
+
+func newSupervisor(t *testing.T, cfg Config) *Supervisor {
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func commandLines(log string) []string {
+	b, _ := ioutil.ReadFile(log)
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestStartStop(t *testing.T) {
+	cfg, log := fakeConfig(t, "normal")
+	defer os.RemoveAll(cfg.WalletDir)
+	cfg.StopTimeout = 5 * time.Second
+	s := newSupervisor(t, cfg)
+	assert.Equal(t, ErrNotRunning, s.Stop())
+
+	assert.NoError(t, s.Start(context.Background()))
+	assert.Error(t, s.Start(context.Background()))
+	assert.Equal(t, []string{
+		"--rpc-bind-port " + strconv.Itoa(cfg.RPCBindPort) + " --wallet-dir " + cfg.WalletDir + " --disable-rpc-login",
+	}, commandLines(log))
+	_, err := s.Client().GetHeight()
+	iswerr, _ := walletrpc.GetWalletError(err)
+	assert.True(t, iswerr)
+
+	start := time.Now()
+	assert.NoError(t, s.Stop())
+	assert.True(t, time.Since(start) < cfg.StopTimeout, "stopped by stop_wallet")
+	<-s.Exited()
+	assert.Equal(t, "exit status 0", s.exitError().Error())
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+	// the default client doesn't authenticate
+	_, err = New(Config{RPCBindPort: 1, RPCLogin: "user:pass"})
+	assert.Error(t, err)
+	_, err = New(Config{RPCBindPort: 1})
+	assert.Error(t, err)
+
+	// a 401 tells the server listens
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer sv.Close()
+	s, err := New(Config{
+		RPCBindPort: 1,
+		RPCLogin:    "user:pass",
+		Client:      walletrpc.New(walletrpc.Config{Address: sv.URL + "/json_rpc"}),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.waitReady(context.Background(), make(chan struct{})))
+}
+
+func TestStopKill(t *testing.T) {
+	cfg, _ := fakeConfig(t, "stubborn")
+	defer os.RemoveAll(cfg.WalletDir)
+	s := newSupervisor(t, cfg)
+	assert.NoError(t, s.Start(context.Background()))
+
+	start := time.Now()
+	assert.NoError(t, s.Stop())
+	assert.True(t, time.Since(start) >= 2*cfg.StopTimeout, "killed after stop_wallet and SIGTERM")
+	assert.Contains(t, s.exitError().Error(), "killed")
+}
+
+func TestStopHung(t *testing.T) {
+	cfg, _ := fakeConfig(t, "hung")
+	defer os.RemoveAll(cfg.WalletDir)
+	s := newSupervisor(t, cfg)
+	assert.NoError(t, s.Start(context.Background()))
+
+	// stop_wallet doesn't hold the SIGTERM
+	start := time.Now()
+	assert.NoError(t, s.Stop())
+	assert.True(t, time.Since(start) < 2*cfg.StopTimeout+time.Second)
+	assert.Contains(t, s.exitError().Error(), "terminated")
+}
+
+func TestWaitReadyHung(t *testing.T) {
+	release := make(chan struct{})
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer sv.Close()
+	defer close(release)
+	s := newSupervisor(t, Config{
+		RPCBindPort:     1,
+		DisableRPCLogin: true,
+		Client:          walletrpc.New(walletrpc.Config{Address: sv.URL + "/json_rpc"}),
+		ReadyTimeout:    100 * time.Millisecond,
+		PollInterval:    10 * time.Millisecond,
+	})
+
+	start := time.Now()
+	err := s.waitReady(context.Background(), make(chan struct{}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not ready after")
+	assert.True(t, time.Since(start) < time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	assert.Equal(t, context.Canceled, s.waitReady(ctx, make(chan struct{})))
+}
+
+func TestStartFail(t *testing.T) {
+	cfg, _ := fakeConfig(t, "fail")
+	defer os.RemoveAll(cfg.WalletDir)
+	err := newSupervisor(t, cfg).Start(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before ready")
+
+	cfg.Binary = filepath.Join(cfg.WalletDir, "missing")
+	assert.Error(t, newSupervisor(t, cfg).Start(context.Background()))
+}
+
+func TestRun(t *testing.T) {
+	cfg, log := fakeConfig(t, "crash")
+	defer os.RemoveAll(cfg.WalletDir)
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var exits []error
+	cfg.OnExit = func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if exits = append(exits, err); len(exits) == 3 {
+			cancel()
+		}
+	}
+	assert.Equal(t, context.Canceled, newSupervisor(t, cfg).Run(ctx))
+	assert.Len(t, exits, 3)
+	assert.Contains(t, exits[0].Error(), "exit status 1")
+	assert.True(t, len(commandLines(log)) >= 3)
+}
@@ -0,0 +1,110 @@
+// Package tracing traces the calls of a walletrpc.Client with
+// OpenTelemetry.
+//
+// The Tracer's interceptor makes a client span of every call, child of the
+// span of the call's context (see walletrpc.Client.WithContext), and
+// passes the trace context to the server in a W3C traceparent header.
+// Spans hold the method, the size of the params, the status and the wallet
+// error code, never the params themselves, which may be passwords or keys.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer of the calls.
+const InstrumentationName = "github.com/ibclabs/go-monero/tracing"
+
+// Span attributes
+const (
+	AttrRPCSystem  = attribute.Key("rpc.system")
+	AttrRPCMethod  = attribute.Key("rpc.method")
+	AttrParamsSize = attribute.Key("rpc.request.size")
+	AttrErrorCode  = attribute.Key("rpc.jsonrpc.error_code")
+	AttrHTTPStatus = attribute.Key("http.status_code")
+	AttrErrorKind  = attribute.Key("error.type")
+)
+
+// Tracer makes the spans of calls.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracer returns a Tracer making its spans with the tracer provider,
+// the global one if nil.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{
+		tracer:     provider.Tracer(InstrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// Interceptor returns the interceptor tracing the calls of a client.
+func (t *Tracer) Interceptor() walletrpc.Interceptor {
+	return func(ctx context.Context, method string, params, result interface{}, next walletrpc.Invoker) error {
+		ctx, span := t.tracer.Start(ctx, "walletrpc "+method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				AttrRPCSystem.String("jsonrpc"),
+				AttrRPCMethod.String(method),
+				AttrParamsSize.Int(paramsSize(params)),
+			),
+		)
+		defer span.End()
+
+		header := make(http.Header)
+		t.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+		for key := range header {
+			ctx = walletrpc.ContextWithHeader(ctx, key, header.Get(key))
+		}
+		err := next(ctx, method, params, result)
+		if err != nil {
+			span.SetAttributes(errorAttributes(err)...)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// paramsSize returns the size of the JSON encoding of the params.
+func paramsSize(params interface{}) int {
+	if params == nil {
+		return 0
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+func errorAttributes(err error) []attribute.KeyValue {
+	var werr *walletrpc.WalletError
+	var herr *walletrpc.HTTPStatusError
+	var terr *walletrpc.TransportError
+	switch {
+	case errors.As(err, &werr):
+		return []attribute.KeyValue{AttrErrorKind.String("wallet"), AttrErrorCode.Int(int(werr.Code))}
+	case errors.As(err, &herr):
+		return []attribute.KeyValue{AttrErrorKind.String("http"), AttrHTTPStatus.Int(herr.StatusCode)}
+	case errors.As(err, &terr):
+		return []attribute.KeyValue{AttrErrorKind.String("transport")}
+	case errors.Is(err, walletrpc.ErrUnsupported):
+		return []attribute.KeyValue{AttrErrorKind.String("unsupported")}
+	}
+	return []attribute.KeyValue{AttrErrorKind.String("other")}
+}
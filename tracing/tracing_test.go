@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func attributes(s tracetest.SpanStub) map[attribute.Key]interface{} {
+	attrs := make(map[attribute.Key]interface{})
+	for _, kv := range s.Attributes {
+		attrs[kv.Key] = kv.Value.AsInterface()
+	}
+	return attrs
+}
+
+func TestTracer(t *testing.T) {
+	var headers []string
+	var bodies []string
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("traceparent"))
+		var req struct {
+			ID     uint64          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		bodies = append(bodies, string(req.Params))
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "getheight":
+			resp["result"] = map[string]uint64{"height": 100}
+		case "open_wallet":
+			resp["error"] = map[string]interface{}{"code": -1, "message": "failed to open wallet"}
+		case "getbalance":
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer sv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	client := walletrpc.New(walletrpc.Config{
+		Address:      sv.URL + "/json_rpc",
+		Interceptors: []walletrpc.Interceptor{NewTracer(provider).Interceptor()},
+	})
+
+	// the calls of a request are part of its trace
+	incoming := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(incoming))
+	parent := trace.SpanContextFromContext(ctx)
+	assert.True(t, parent.IsValid())
+	_, err := client.WithContext(ctx).GetHeight()
+	assert.NoError(t, err)
+	assert.Error(t, client.OpenWallet("w", "hunter2"))
+	_, _, err = client.GetBalance()
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+
+	s := spans[0]
+	assert.Equal(t, "walletrpc getheight", s.Name)
+	assert.Equal(t, trace.SpanKindClient, s.SpanKind)
+	assert.Equal(t, parent.TraceID(), s.SpanContext.TraceID())
+	assert.Equal(t, parent.SpanID(), s.Parent.SpanID())
+	assert.NotEqual(t, parent.SpanID(), s.SpanContext.SpanID())
+	assert.True(t, s.SpanContext.IsSampled())
+	assert.Equal(t, codes.Unset, s.Status.Code)
+	assert.Equal(t, "getheight", attributes(s)[AttrRPCMethod])
+	assert.Equal(t, int64(0), attributes(s)[AttrParamsSize])
+	assert.False(t, s.EndTime.Before(s.StartTime))
+	assert.Equal(t, fmt.Sprintf("00-%v-%v-01", s.SpanContext.TraceID(), s.SpanContext.SpanID()), headers[0])
+
+	s = spans[1]
+	assert.False(t, s.Parent.IsValid())
+	assert.NotEqual(t, parent.TraceID(), s.SpanContext.TraceID())
+	assert.Equal(t, codes.Error, s.Status.Code)
+	assert.Equal(t, int64(-1), attributes(s)[AttrErrorCode])
+	assert.Equal(t, int64(len(bodies[1])), attributes(s)[AttrParamsSize])
+	assert.Equal(t, fmt.Sprintf("00-%v-%v-01", s.SpanContext.TraceID(), s.SpanContext.SpanID()), headers[1])
+	// the params aren't attributes
+	assert.Len(t, s.Attributes, 5)
+	assert.NotContains(t, fmt.Sprintf("%+v", s), "hunter2")
+
+	s = spans[2]
+	assert.Equal(t, "http", attributes(s)[AttrErrorKind])
+	assert.Equal(t, int64(http.StatusServiceUnavailable), attributes(s)[AttrHTTPStatus])
+
+	exporter.Reset()
+	assert.Empty(t, exporter.GetSpans())
+}
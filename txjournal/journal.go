@@ -0,0 +1,132 @@
+// Package txjournal makes transfers idempotent.
+//
+// A transfer is created without being relayed, written to a journal file
+// under a caller supplied idempotency key, and only then relayed. If the
+// process dies at any point, the journal tells whether a transaction was
+// created for the key and holds what's needed to relay it again, so a key
+// never produces two transactions.
+package txjournal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// State of a journal entry.
+type State string
+
+// Entry states. A created transaction may or may not have been relayed
+// before a crash; Submitter.Reconcile finds out.
+const (
+	StateCreated State = "created"
+	StateRelayed State = "relayed"
+	StateFailed  State = "failed"
+)
+
+// Entry is the transaction created for an idempotency key.
+type Entry struct {
+	Key    string `json:"key"`
+	TxHash string `json:"tx_hash"`
+	TxKey  string `json:"tx_key,omitempty"`
+	// TxBlob is the signed transaction, which a daemon accepts as is.
+	TxBlob string `json:"tx_blob,omitempty"`
+	// TxMetadata is what the wallet needs to relay the transaction.
+	TxMetadata string `json:"tx_metadata,omitempty"`
+	Amount     uint64 `json:"amount"`
+	Fee        uint64 `json:"fee"`
+	State      State  `json:"state"`
+	// Error is the reason of a failure.
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Journal is an append-only file of entries, one JSON object per line.
+// Every write is synced to disk before returning, and the last write of a
+// key wins when the file is read back.
+type Journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]Entry
+	order   []string
+}
+
+// Open reads the journal at path, creating it if needed.
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		f:       f,
+		entries: make(map[string]Entry),
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<24)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// a write torn by a crash, its entry wasn't acknowledged
+			continue
+		}
+		j.set(e)
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) set(e Entry) {
+	if _, ok := j.entries[e.Key]; !ok {
+		j.order = append(j.order, e.Key)
+	}
+	j.entries[e.Key] = e
+}
+
+// Get returns the entry of a key.
+func (j *Journal) Get(key string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.entries[key]
+	return e, ok
+}
+
+// Entries returns all the entries, in the order they were first written.
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := make([]Entry, 0, len(j.order))
+	for _, k := range j.order {
+		list = append(list, j.entries[k])
+	}
+	return list
+}
+
+// Write appends an entry and syncs the file.
+func (j *Journal) Write(e Entry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// start on a new line in case the last write was torn
+	if _, err := j.f.Write(append(append([]byte{'\n'}, buf...), '\n')); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.set(e)
+	return nil
+}
+
+// Close closes the file.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
@@ -0,0 +1,172 @@
+package txjournal
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// ErrFailed is returned by Submit for a key whose transaction failed. The
+// key is spent anyway: use a new one to try again.
+var ErrFailed = errors.New("txjournal: transaction failed")
+
+// Wallet is the subset of *walletrpc.Client used by the Submitter.
+type Wallet interface {
+	Transfer(req walletrpc.TransferRequest) (walletrpc.TransferResponse, error)
+	RelayTx(hex string) (string, error)
+	GetTransferByTxID(txid string) (walletrpc.Transfer, error)
+}
+
+// Config holds the configuration of a Submitter.
+type Config struct {
+	Wallet  Wallet
+	Journal *Journal
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Submitter sends transfers at most once per idempotency key.
+type Submitter struct {
+	cfg Config
+	// serializes the submissions, so that a key isn't sent twice
+	mu sync.Mutex
+}
+
+// NewSubmitter returns a Submitter for the configuration.
+func NewSubmitter(cfg Config) *Submitter {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Submitter{cfg: cfg}
+}
+
+// Submit sends a transfer for the key, unless the key already has a
+// transaction: then it returns that one, relaying it first if it wasn't.
+//
+// The transaction is created with DoNotRelay and journaled before being
+// relayed. An error returned after the journal write leaves the entry in
+// the created state, to be resolved by Reconcile or another Submit.
+func (s *Submitter) Submit(key string, req walletrpc.TransferRequest) (Entry, error) {
+	if key == "" {
+		return Entry{}, errors.New("txjournal: empty idempotency key")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.cfg.Journal.Get(key); ok {
+		return s.resolve(e)
+	}
+
+	req.DoNotRelay = true
+	req.GetTxHex = true
+	req.GetTxKey = true
+	req.GetTxMetadata = true
+	resp, err := s.cfg.Wallet.Transfer(req)
+	if err != nil {
+		// nothing left the wallet
+		return Entry{}, err
+	}
+	if resp.TxMetadata == "" {
+		return Entry{}, errors.New("txjournal: the wallet returned no tx_metadata")
+	}
+
+	var amount uint64
+	for _, d := range req.Destinations {
+		amount += d.Amount
+	}
+	now := s.cfg.Now().UTC()
+	e := Entry{
+		Key:        key,
+		TxHash:     resp.TxHash,
+		TxKey:      resp.TxKey,
+		TxBlob:     resp.TxBlob,
+		TxMetadata: resp.TxMetadata,
+		Amount:     amount,
+		Fee:        resp.Fee,
+		State:      StateCreated,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.cfg.Journal.Write(e); err != nil {
+		// the transaction wasn't relayed and the wallet forgets it
+		return Entry{}, err
+	}
+	return s.relay(e)
+}
+
+// resolve brings a journaled entry to a final state if it can.
+func (s *Submitter) resolve(e Entry) (Entry, error) {
+	switch e.State {
+	case StateRelayed:
+		return e, nil
+	case StateFailed:
+		return e, ErrFailed
+	}
+	// find out if the relay happened before a crash
+	tr, err := s.cfg.Wallet.GetTransferByTxID(e.TxHash)
+	if err == nil {
+		if tr.Type == "failed" {
+			return s.update(e, StateFailed, "the wallet marked the transaction failed")
+		}
+		return s.update(e, StateRelayed, "")
+	}
+	if !errors.Is(err, walletrpc.ErrWrongTxID) {
+		return e, err
+	}
+	return s.relay(e)
+}
+
+// relay relays a created entry. Relaying the same transaction again is
+// harmless: it can't be mined twice.
+func (s *Submitter) relay(e Entry) (Entry, error) {
+	_, err := s.cfg.Wallet.RelayTx(e.TxMetadata)
+	if err != nil {
+		if iswerr, _ := walletrpc.GetWalletError(err); iswerr && !walletrpc.IsRetryable(err) {
+			// refused, e.g. the inputs were spent by another transaction
+			e, _ = s.update(e, StateFailed, err.Error())
+			return e, fmt.Errorf("%w: %v", ErrFailed, err)
+		}
+		return e, err
+	}
+	return s.update(e, StateRelayed, "")
+}
+
+func (s *Submitter) update(e Entry, state State, reason string) (Entry, error) {
+	e.State = state
+	e.Error = reason
+	e.UpdatedAt = s.cfg.Now().UTC()
+	if err := s.cfg.Journal.Write(e); err != nil {
+		return e, err
+	}
+	if state == StateFailed {
+		return e, ErrFailed
+	}
+	return e, nil
+}
+
+// Reconcile resolves the entries left in the created state, typically by
+// a crash, at startup. It checks every one against the wallet and relays
+// the transactions the wallet doesn't know. It returns the entries it
+// changed, and the first error it met.
+func (s *Submitter) Reconcile() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var changed []Entry
+	var first error
+	for _, e := range s.cfg.Journal.Entries() {
+		if e.State != StateCreated {
+			continue
+		}
+		e, err := s.resolve(e)
+		if e.State != StateCreated {
+			changed = append(changed, e)
+		}
+		if err != nil && !errors.Is(err, ErrFailed) && first == nil {
+			first = err
+		}
+	}
+	return changed, first
+}
@@ -0,0 +1,155 @@
+package txjournal
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testWallet creates transactions tx1, tx2... and knows them once relayed.
+type testWallet struct {
+	created  int
+	relayed  map[string]bool
+	relayErr error
+}
+
+func (w *testWallet) Transfer(req walletrpc.TransferRequest) (resp walletrpc.TransferResponse, err error) {
+	if !req.DoNotRelay || !req.GetTxMetadata {
+		return resp, errors.New("relayed at once")
+	}
+	w.created++
+	resp.TxHash = fmt.Sprintf("tx%v", w.created)
+	resp.TxMetadata = "meta-" + resp.TxHash
+	resp.Fee = 10
+	return
+}
+
+func (w *testWallet) RelayTx(hex string) (string, error) {
+	if w.relayErr != nil {
+		return "", w.relayErr
+	}
+	if w.relayed == nil {
+		w.relayed = make(map[string]bool)
+	}
+	hash := hex[len("meta-"):]
+	w.relayed[hash] = true
+	return hash, nil
+}
+
+func (w *testWallet) GetTransferByTxID(txid string) (tr walletrpc.Transfer, err error) {
+	if !w.relayed[txid] {
+		return tr, &walletrpc.WalletError{Code: walletrpc.ErrWrongTxID, Message: "Transaction not found."}
+	}
+	return walletrpc.Transfer{TxID: txid, Type: "pending"}, nil
+}
+
+var testRequest = walletrpc.TransferRequest{
+	Destinations: []walletrpc.Destination{{Address: "addr", Amount: 100}},
+}
+
+func TestSubmitter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := Open(path)
+	assert.NoError(t, err)
+	w := &testWallet{}
+	s := NewSubmitter(Config{Wallet: w, Journal: j})
+
+	e, err := s.Submit("k1", testRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, "tx1", e.TxHash)
+	assert.Equal(t, StateRelayed, e.State)
+	assert.Equal(t, uint64(100), e.Amount)
+
+	// same key, same transaction
+	e, err = s.Submit("k1", testRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, "tx1", e.TxHash)
+	assert.Equal(t, 1, w.created)
+
+	// the relay fails without an answer
+	w.relayErr = errors.New("connection refused")
+	e, err = s.Submit("k2", testRequest)
+	assert.Error(t, err)
+	assert.Equal(t, StateCreated, e.State)
+	assert.NoError(t, j.Close())
+
+	// restart
+	j, err = Open(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	s = NewSubmitter(Config{Wallet: w, Journal: j})
+	_, err = s.Reconcile()
+	assert.Error(t, err)
+	w.relayErr = nil
+	changed, err := s.Reconcile()
+	assert.NoError(t, err)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, "tx2", changed[0].TxHash)
+	assert.Equal(t, StateRelayed, changed[0].State)
+	assert.True(t, w.relayed["tx2"])
+
+	e, err = s.Submit("k2", testRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, "tx2", e.TxHash)
+	assert.Equal(t, 2, w.created)
+	assert.Len(t, j.Entries(), 2)
+}
+
+func TestSubmitterRelayedBeforeCrash(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), "journal"))
+	assert.NoError(t, err)
+	defer j.Close()
+	w := &testWallet{relayed: map[string]bool{"tx1": true}}
+	assert.NoError(t, j.Write(Entry{Key: "k1", TxHash: "tx1", TxMetadata: "meta-tx1", State: StateCreated}))
+	w.relayErr = errors.New("must not relay")
+
+	s := NewSubmitter(Config{Wallet: w, Journal: j})
+	changed, err := s.Reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, StateRelayed, changed[0].State)
+}
+
+func TestSubmitterRefused(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), "journal"))
+	assert.NoError(t, err)
+	defer j.Close()
+	w := &testWallet{relayErr: &walletrpc.WalletError{Code: walletrpc.ErrGenericTransferError, Message: "double spend"}}
+	s := NewSubmitter(Config{Wallet: w, Journal: j})
+
+	e, err := s.Submit("k1", testRequest)
+	assert.True(t, errors.Is(err, ErrFailed))
+	assert.Equal(t, StateFailed, e.State)
+	assert.Equal(t, "-4: double spend", e.Error)
+
+	w.relayErr = nil
+	_, err = s.Submit("k1", testRequest)
+	assert.Equal(t, ErrFailed, err)
+	assert.Equal(t, 1, w.created)
+}
+
+func TestJournalTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := Open(path)
+	assert.NoError(t, err)
+	assert.NoError(t, j.Write(Entry{Key: "k1", State: StateCreated}))
+	assert.NoError(t, j.Write(Entry{Key: "k1", State: StateRelayed}))
+	_, err = j.f.WriteString(`{"key":"k2","sta`)
+	assert.NoError(t, err)
+	assert.NoError(t, j.Write(Entry{Key: "k3", State: StateCreated}))
+	assert.NoError(t, j.Close())
+
+	j, err = Open(path)
+	assert.NoError(t, err)
+	defer j.Close()
+	e, ok := j.Get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, StateRelayed, e.State)
+	_, ok = j.Get("k2")
+	assert.False(t, ok)
+	_, ok = j.Get("k3")
+	assert.True(t, ok)
+}
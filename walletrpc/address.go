@@ -0,0 +1,249 @@
+package walletrpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Network is the monero network an address belongs to.
+type Network int
+
+const (
+	// Mainnet - the main monero network
+	Mainnet Network = iota
+	// Testnet - the public test network
+	Testnet
+	// Stagenet - the staging network
+	Stagenet
+)
+
+func (n Network) String() string {
+	switch n {
+	case Mainnet:
+		return "mainnet"
+	case Testnet:
+		return "testnet"
+	case Stagenet:
+		return "stagenet"
+	}
+	return fmt.Sprintf("network(%d)", int(n))
+}
+
+// AddressType is the kind of a monero address.
+type AddressType int
+
+const (
+	// AddressStandard - a primary (account 0, index 0) address
+	AddressStandard AddressType = iota
+	// AddressIntegrated - a standard address with an embedded 64 bit payment id
+	AddressIntegrated
+	// AddressSubaddress - a subaddress
+	AddressSubaddress
+)
+
+func (t AddressType) String() string {
+	switch t {
+	case AddressStandard:
+		return "standard"
+	case AddressIntegrated:
+		return "integrated"
+	case AddressSubaddress:
+		return "subaddress"
+	}
+	return fmt.Sprintf("addresstype(%d)", int(t))
+}
+
+// Address prefixes.
+// Copied from https://github.com/monero-project/monero/blob/master/src/cryptonote_config.h
+var addressPrefixes = map[uint64]struct {
+	Network Network
+	Type    AddressType
+}{
+	18: {Mainnet, AddressStandard},
+	19: {Mainnet, AddressIntegrated},
+	42: {Mainnet, AddressSubaddress},
+	53: {Testnet, AddressStandard},
+	54: {Testnet, AddressIntegrated},
+	63: {Testnet, AddressSubaddress},
+	24: {Stagenet, AddressStandard},
+	25: {Stagenet, AddressIntegrated},
+	36: {Stagenet, AddressSubaddress},
+}
+
+// Address is a decoded monero address.
+type Address struct {
+	Network        Network
+	Type           AddressType
+	PublicSpendKey []byte
+	PublicViewKey  []byte
+	// PaymentID is the hex encoded short payment id of an integrated address.
+	PaymentID string
+}
+
+// DecodeAddress decodes and validates a monero address locally,
+// without calling the wallet.
+func DecodeAddress(addr string) (*Address, error) {
+	raw, err := decodeBase58(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 4 {
+		return nil, errors.New("address too short")
+	}
+	body, checksum := raw[:len(raw)-4], raw[len(raw)-4:]
+	if !bytes.Equal(keccak256(body)[:4], checksum) {
+		return nil, errors.New("invalid address checksum")
+	}
+	tag, n := binary.Uvarint(body)
+	if n <= 0 {
+		return nil, errors.New("invalid address prefix")
+	}
+	prefix, ok := addressPrefixes[tag]
+	if !ok {
+		return nil, fmt.Errorf("unknown address prefix %v", tag)
+	}
+	body = body[n:]
+	want := 64
+	if prefix.Type == AddressIntegrated {
+		want += 8
+	}
+	if len(body) != want {
+		return nil, fmt.Errorf("invalid %v address length", prefix.Type)
+	}
+	a := &Address{
+		Network:        prefix.Network,
+		Type:           prefix.Type,
+		PublicSpendKey: body[:32],
+		PublicViewKey:  body[32:64],
+	}
+	if prefix.Type == AddressIntegrated {
+		a.PaymentID = hex.EncodeToString(body[64:])
+	}
+	return a, nil
+}
+
+// EncodeAddress returns the base58 string form of the address.
+func EncodeAddress(a Address) (string, error) {
+	var tag uint64
+	found := false
+	for k, v := range addressPrefixes {
+		if v.Network == a.Network && v.Type == a.Type {
+			tag, found = k, true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("no prefix for %v %v address", a.Network, a.Type)
+	}
+	if len(a.PublicSpendKey) != 32 || len(a.PublicViewKey) != 32 {
+		return "", errors.New("public keys must be 32 bytes")
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+76)
+	buf = buf[:binary.PutUvarint(buf, tag)]
+	buf = append(buf, a.PublicSpendKey...)
+	buf = append(buf, a.PublicViewKey...)
+	if a.Type == AddressIntegrated {
+		pid, err := hex.DecodeString(a.PaymentID)
+		if err != nil || len(pid) != 8 {
+			return "", errors.New("integrated address needs a 16 character payment id")
+		}
+		buf = append(buf, pid...)
+	}
+	buf = append(buf, keccak256(buf)[:4]...)
+	return encodeBase58(buf), nil
+}
+
+// ValidateAddress checks the encoding and checksum of a monero address.
+func ValidateAddress(addr string) error {
+	_, err := DecodeAddress(addr)
+	return err
+}
+
+// Monero base58 encodes 8 byte blocks into 11 characters each, so
+// (unlike bitcoin base58) the output length only depends on the input length.
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+const (
+	base58FullBlock        = 8
+	base58FullEncodedBlock = 11
+)
+
+var base58EncodedBlockSizes = [...]int{0, 2, 3, 5, 6, 7, 9, 10, 11}
+
+func encodeBase58(data []byte) string {
+	out := make([]byte, 0, len(data)/base58FullBlock*base58FullEncodedBlock+base58FullEncodedBlock)
+	for len(data) > 0 {
+		n := base58FullBlock
+		if len(data) < n {
+			n = len(data)
+		}
+		out = append(out, encodeBase58Block(data[:n])...)
+		data = data[n:]
+	}
+	return string(out)
+}
+
+func encodeBase58Block(block []byte) []byte {
+	var num uint64
+	for _, b := range block {
+		num = num<<8 | uint64(b)
+	}
+	size := base58EncodedBlockSizes[len(block)]
+	out := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		out[i] = base58Alphabet[num%58]
+		num /= 58
+	}
+	return out
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s)/base58FullEncodedBlock*base58FullBlock+base58FullBlock)
+	for len(s) > 0 {
+		n := base58FullEncodedBlock
+		if len(s) < n {
+			n = len(s)
+		}
+		block, err := decodeBase58Block(s[:n])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+		s = s[n:]
+	}
+	return out, nil
+}
+
+func decodeBase58Block(s string) ([]byte, error) {
+	size := -1
+	for i, v := range base58EncodedBlockSizes {
+		if v == len(s) {
+			size = i
+			break
+		}
+	}
+	if size <= 0 {
+		return nil, errors.New("invalid base58 length")
+	}
+	num := new(big.Int)
+	b58 := big.NewInt(58)
+	for i := 0; i < len(s); i++ {
+		d := bytes.IndexByte([]byte(base58Alphabet), s[i])
+		if d < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", s[i])
+		}
+		num.Mul(num, b58)
+		num.Add(num, big.NewInt(int64(d)))
+	}
+	if num.BitLen() > size*8 {
+		return nil, errors.New("base58 block overflow")
+	}
+	out := make([]byte, size)
+	num.FillBytes(out)
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package walletrpc
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAddress = "45eoXYNHC4LcL2Hh42T9FMPTmZHyDEwDbgfBEuNj3RZUek8A4og4KiCfVL6ZmvHBfCALnggWtHH7QHF8426yRayLQq7MLf5"
+
+func TestKeccak256(t *testing.T) {
+	assert.Equal(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", hex.EncodeToString(keccak256(nil)))
+	assert.Equal(t, "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45", hex.EncodeToString(keccak256([]byte("abc"))))
+}
+
+func TestDecodeAddress(t *testing.T) {
+	a, err := DecodeAddress(testAddress)
+	assert.NoError(t, err)
+	assert.Equal(t, Mainnet, a.Network)
+	assert.Equal(t, AddressStandard, a.Type)
+
+	enc, err := EncodeAddress(*a)
+	assert.NoError(t, err)
+	assert.Equal(t, testAddress, enc)
+
+	a.Type = AddressIntegrated
+	a.PaymentID = "0123456789abcdef"
+	integrated, err := EncodeAddress(*a)
+	assert.NoError(t, err)
+	assert.Len(t, integrated, 106)
+	b, err := DecodeAddress(integrated)
+	assert.NoError(t, err)
+	assert.Equal(t, AddressIntegrated, b.Type)
+	assert.Equal(t, "0123456789abcdef", b.PaymentID)
+
+	// flip the last character: bad checksum
+	assert.Error(t, ValidateAddress(testAddress[:94]+"6"))
+	assert.Error(t, ValidateAddress("not an address"))
+}
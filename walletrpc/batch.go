@@ -0,0 +1,178 @@
+package walletrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// BatchMethod is the method the interceptors see for a batch request, with
+// the []*BatchCall as params.
+const BatchMethod = "batch"
+
+// errNoBatch is returned by a batch request the server rejected.
+var errNoBatch = errors.New("walletrpc: batch requests unsupported by the server")
+
+// BatchCall is a call of a batch request.
+type BatchCall struct {
+	Method string
+	Params interface{}
+	// Result (optional) receives the result of the call.
+	Result interface{}
+	// Err is set once the batch is done, to the error of the call.
+	Err error
+}
+
+// rpcRequest and rpcResponse are the JSON-RPC 2.0 request and response
+// objects of a batch.
+type rpcRequest struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      uint64      `json:"id"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Batch makes the calls in a single JSON-RPC batch request, setting the
+// Err of every call. The error returned is for the request as a whole, e.g.
+// a transport error, in which case the calls' Err are set to it too.
+//
+// monero-wallet-rpc doesn't handle batches: when the server rejects one,
+// the calls are made one by one, and so are the following batches.
+func (c *Client) Batch(calls []*BatchCall) error {
+	var send []*BatchCall
+	for _, bc := range calls {
+		bc.Err = nil
+		if !c.supported(bc.Method) {
+			bc.Err = &UnsupportedError{Method: bc.Method}
+			continue
+		}
+		send = append(send, bc)
+	}
+	if len(send) == 0 {
+		return nil
+	}
+	if c.batchSupported() {
+		ctx := c.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		err := c.invoke(ctx, BatchMethod, send, nil)
+		if !errors.Is(err, errNoBatch) {
+			if err != nil {
+				for _, bc := range send {
+					bc.Err = err
+				}
+			}
+			return err
+		}
+		c.capsMu.Lock()
+		c.noBatch = true
+		c.capsMu.Unlock()
+	}
+	for _, bc := range send {
+		bc.Err = c.do(bc.Method, bc.Params, bc.Result)
+	}
+	return nil
+}
+
+func (c *Client) batchSupported() bool {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	return !c.noBatch
+}
+
+// callBatch makes a single attempt of a batch request.
+func (c *Client) callBatch(ctx context.Context, calls []*BatchCall) error {
+	reqs := make([]rpcRequest, len(calls))
+	for i, bc := range calls {
+		reqs[i] = rpcRequest{Version: "2.0", Method: bc.Method, Params: bc.Params, ID: uint64(i + 1)}
+	}
+	payload, err := json.Marshal(reqs)
+	if err != nil {
+		return err
+	}
+	body, err := c.post(ctx, BatchMethod, "", payload)
+	if err != nil {
+		var herr *HTTPStatusError
+		if errors.As(err, &herr) && (herr.StatusCode == http.StatusBadRequest ||
+			herr.StatusCode == http.StatusNotImplemented) {
+			return errNoBatch
+		}
+		return err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return &TransportError{Method: BatchMethod, Err: err}
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		// a single error, or nothing
+		return errNoBatch
+	}
+	var resps []rpcResponse
+	if err := json.Unmarshal(data, &resps); err != nil {
+		return err
+	}
+	answered := make([]bool, len(calls))
+	for _, r := range resps {
+		if r.ID < 1 || r.ID > uint64(len(calls)) {
+			continue
+		}
+		i := r.ID - 1
+		bc := calls[i]
+		answered[i] = true
+		switch {
+		case r.Error != nil:
+			bc.Err = c.callError(bc.Method, r.Error.Code, r.Error.Message)
+		case bc.Result != nil && len(r.Result) > 0:
+			bc.Err = json.Unmarshal(r.Result, bc.Result)
+		}
+	}
+	for i, bc := range calls {
+		if !answered[i] {
+			bc.Err = fmt.Errorf("walletrpc: %v: no response in the batch", bc.Method)
+		}
+	}
+	return nil
+}
+
+// GetTransfersByTxID looks up transactions in a single batch request,
+// returning the transfers and the errors in the order of the txids.
+func (c *Client) GetTransfersByTxID(txids []string) ([]Transfer, []error, error) {
+	results := make([]struct {
+		Transfer Transfer `json:"transfer"`
+	}, len(txids))
+	calls := make([]*BatchCall, len(txids))
+	for i, txid := range txids {
+		calls[i] = &BatchCall{
+			Method: "get_transfer_by_txid",
+			Params: struct {
+				TxID string `json:"txid"`
+			}{txid},
+			Result: &results[i],
+		}
+	}
+	err := c.Batch(calls)
+	transfers := make([]Transfer, len(txids))
+	errs := make([]error, len(txids))
+	for i := range calls {
+		transfers[i] = results[i].Transfer
+		errs[i] = calls[i].Err
+	}
+	return transfers, errs, err
+}
@@ -0,0 +1,112 @@
+package walletrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	requests := 0
+	sv0 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var reqs []struct {
+			ID     uint64 `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				TxID string `json:"txid"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var resps []interface{}
+		for i := len(reqs) - 1; i >= 0; i-- {
+			req := reqs[i]
+			resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+			switch req.Params.TxID {
+			case "aa", "bb":
+				resp["result"] = map[string]interface{}{
+					"transfer": Transfer{TxID: req.Params.TxID, Amount: 1},
+				}
+			case "lost":
+				continue
+			default:
+				resp["error"] = map[string]interface{}{"code": int(ErrWrongTxID), "message": "invalid txid"}
+			}
+			resps = append(resps, resp)
+		}
+		json.NewEncoder(w).Encode(resps)
+	}))
+	defer sv0.Close()
+	rpccl := New(Config{Address: sv0.URL + "/json_rpc"})
+
+	transfers, errs, err := rpccl.GetTransfersByTxID([]string{"aa", "zz", "bb", "lost"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, "aa", transfers[0].TxID)
+	assert.Equal(t, "bb", transfers[2].TxID)
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], ErrWrongTxID))
+	assert.NoError(t, errs[2])
+	assert.Error(t, errs[3])
+
+	sv0.Close()
+	_, errs, err = rpccl.GetTransfersByTxID([]string{"aa"})
+	var te *TransportError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, err, errs[0])
+}
+
+func TestBatchFallback(t *testing.T) {
+	calls := make(map[string]int)
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			calls[method]++
+			switch method {
+			case "get_transfer_by_txid":
+				p0 := struct {
+					TxID string `json:"txid"`
+				}{}
+				json.Unmarshal(*params, &p0)
+				if p0.TxID != "aa" {
+					writerpcResponseError(ErrWrongTxID, "invalid txid", w)
+					return true
+				}
+				writerpcResponseOK(map[string]interface{}{"transfer": Transfer{TxID: "aa"}}, w)
+			case "getheight":
+				writerpcResponseOK(map[string]uint64{"height": 5}, w)
+			default:
+				return false
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+	rpccl := New(Config{Address: sv0.URL + "/json_rpc"})
+
+	transfers, errs, err := rpccl.GetTransfersByTxID([]string{"aa", "zz"})
+	assert.NoError(t, err)
+	assert.Equal(t, "aa", transfers[0].TxID)
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], ErrWrongTxID))
+	assert.Equal(t, 2, calls["get_transfer_by_txid"])
+
+	var height struct {
+		Height uint64 `json:"height"`
+	}
+	batch := []*BatchCall{
+		{Method: "getheight", Result: &height},
+		{Method: "get_transfer_by_txid", Params: map[string]string{"txid": "zz"}},
+	}
+	assert.NoError(t, rpccl.Batch(batch))
+	assert.Equal(t, uint64(5), height.Height)
+	assert.NoError(t, batch[0].Err)
+	assert.Error(t, batch[1].Err)
+	assert.True(t, rpccl.noBatch)
+}
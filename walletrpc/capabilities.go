@@ -0,0 +1,156 @@
+package walletrpc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrUnsupported is matched by errors.Is for the calls the server doesn't
+// support, see UnsupportedError.
+var ErrUnsupported = errors.New("walletrpc: unsupported by the server")
+
+// UnsupportedError is returned for a method the server doesn't know, or a
+// request field its version would ignore.
+type UnsupportedError struct {
+	Method string
+	// Field and Version are set for an unsupported request field.
+	Field   string
+	Version Version
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("walletrpc: %v needs wallet rpc %v, the server is %v", e.Field, fieldVersions[e.Field], e.Version)
+	}
+	return fmt.Sprintf("walletrpc: method %v unsupported by the server", e.Method)
+}
+
+// Is makes errors.Is(err, ErrUnsupported) true.
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// fieldVersions are the versions request fields appeared in.
+var fieldVersions = map[string]Version{
+	"subtract_fee_from_outputs": VersionSubtractFee,
+}
+
+// Capabilities describes what the wallet behind a client supports.
+type Capabilities struct {
+	Version Version
+	// ViewOnly wallets can't sign transactions. It isn't probed, which
+	// would take the spend key over the wire, but set once the wallet
+	// refused a call with ErrWatchOnly.
+	ViewOnly bool
+	// Multisig wallets need the other signers to send.
+	Multisig bool
+	// Unsupported are the methods the server answered "method not found"
+	// to so far.
+	Unsupported []string
+}
+
+// SupportsMethod reports whether a method wasn't found unsupported.
+func (c *Capabilities) SupportsMethod(method string) bool {
+	for _, m := range c.Unsupported {
+		if m == method {
+			return false
+		}
+	}
+	return true
+}
+
+// SupportsField reports whether the wallet version knows a request field.
+func (c *Capabilities) SupportsField(field string) bool {
+	v, ok := fieldVersions[field]
+	return !ok || c.Version.AtLeast(v)
+}
+
+// Capabilities returns the capabilities of the wallet, detecting them on
+// the first call. They are cached until ResetCapabilities, which OpenWallet
+// and CreateWallet call, unless no wallet was open (ErrNotOpen).
+func (c *Client) Capabilities() (*Capabilities, error) {
+	c.detectMu.Lock()
+	defer c.detectMu.Unlock()
+
+	c.capsMu.Lock()
+	caps := c.caps
+	c.capsMu.Unlock()
+	if caps == nil {
+		var err error
+		if caps, err = c.detectCapabilities(); err != nil {
+			return nil, err
+		}
+		c.capsMu.Lock()
+		c.caps = caps
+		c.capsMu.Unlock()
+	}
+
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	cp := *caps
+	cp.ViewOnly = c.watchOnly
+	cp.Unsupported = nil
+	for m := range c.missing {
+		cp.Unsupported = append(cp.Unsupported, m)
+	}
+	sort.Strings(cp.Unsupported)
+	return &cp, nil
+}
+
+// ResetCapabilities forgets the capabilities, e.g. after the wallet
+// changed.
+func (c *Client) ResetCapabilities() {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	c.caps = nil
+	c.version = nil
+	c.missing = nil
+	c.watchOnly = false
+}
+
+func (c *Client) detectCapabilities() (*Capabilities, error) {
+	caps := &Capabilities{}
+	var err error
+	if caps.Version, err = c.walletVersion(); err != nil {
+		return nil, err
+	}
+
+	jd := struct {
+		Multisig bool `json:"multisig"`
+	}{}
+	err = c.do("is_multisig", nil, &jd)
+	if errors.Is(err, ErrNotOpen) {
+		return nil, err
+	}
+	if err != nil {
+		if iswerr, _ := GetWalletError(err); !iswerr && !errors.Is(err, ErrUnsupported) {
+			return nil, err
+		}
+	}
+	caps.Multisig = jd.Multisig
+	return caps, nil
+}
+
+// supported reports whether method wasn't found unsupported.
+func (c *Client) supported(method string) bool {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	return !c.missing[method]
+}
+
+// viewOnly records that the wallet refused a call for being view-only.
+func (c *Client) viewOnly() {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	c.watchOnly = true
+}
+
+func (c *Client) unsupported(method string) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.missing == nil {
+		c.missing = make(map[string]bool)
+	}
+	c.missing[method] = true
+}
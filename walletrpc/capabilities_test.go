@@ -0,0 +1,99 @@
+package walletrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/rpc/v2/json2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities(t *testing.T) {
+	calls := make(map[string]int)
+	open := false
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			calls[method]++
+			switch method {
+			case "get_version":
+				writerpcResponseOK(&H{"version": 1<<16 | 26, "release": true}, w)
+			case "is_multisig":
+				if !open {
+					writerpcResponseError(ErrNotOpen, "No wallet file", w)
+					break
+				}
+				writerpcResponseOK(&H{"multisig": true}, w)
+			case "transfer":
+				writerpcResponseError(ErrWatchOnly, "command not supported by watch-only wallet", w)
+			case "get_address":
+				writerpcResponseOK(&H{"address": "aa"}, w)
+			default:
+				r0 := &clientResponse{
+					Version: "2.0",
+					Error:   &json2.Error{Code: json2.E_NO_METHOD, Message: "Method not found"},
+				}
+				v, _ := json.Marshal(r0)
+				w.Write(v)
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+
+	// not cached while no wallet is open
+	rpccl := New(Config{Address: sv0.URL + "/json_rpc"})
+	_, err := rpccl.Capabilities()
+	assert.True(t, errors.Is(err, ErrNotOpen))
+	open = true
+	caps, err := rpccl.Capabilities()
+	assert.NoError(t, err)
+	assert.Equal(t, Version{Major: 1, Minor: 26, Release: true}, caps.Version)
+	assert.False(t, caps.ViewOnly)
+	assert.True(t, caps.Multisig)
+	assert.True(t, caps.SupportsField("subtract_fee_from_outputs"))
+	assert.True(t, caps.SupportsMethod("freeze"))
+	assert.Equal(t, 2, calls["is_multisig"])
+
+	// the server doesn't know freeze: the second call isn't sent
+	err = rpccl.Freeze("k1")
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	err = rpccl.Freeze("k1")
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	assert.Equal(t, 1, calls["freeze"])
+	caps, err = rpccl.Capabilities()
+	assert.NoError(t, err)
+	assert.False(t, caps.SupportsMethod("freeze"))
+	assert.Equal(t, []string{"freeze"}, caps.Unsupported)
+	assert.Equal(t, 1, calls["get_version"])
+
+	// a view-only wallet is known by its refusal to transfer, the spend
+	// key is never asked for
+	_, err = rpccl.Transfer(TransferRequest{Destinations: []Destination{{Amount: 1, Address: "bb"}}})
+	assert.True(t, errors.Is(err, ErrWatchOnly))
+	caps, err = rpccl.Capabilities()
+	assert.NoError(t, err)
+	assert.True(t, caps.ViewOnly)
+	assert.Equal(t, 0, calls["query_key"])
+
+	// cached until the wallet changes
+	rpccl.ResetCapabilities()
+	caps, err = rpccl.Capabilities()
+	assert.NoError(t, err)
+	assert.False(t, caps.ViewOnly)
+	assert.Empty(t, caps.Unsupported)
+	assert.Equal(t, 2, calls["get_version"])
+
+	// a transfer only needs the version
+	rpccl = New(Config{Address: sv0.URL + "/json_rpc"})
+	rpccl.Transfer(TransferRequest{Destinations: []Destination{{Amount: 1, Address: "bb"}}})
+	assert.Equal(t, 3, calls["get_version"])
+	assert.Equal(t, 3, calls["is_multisig"])
+}
+
+func TestUnsupportedField(t *testing.T) {
+	err := error(&UnsupportedError{Field: "subtract_fee_from_outputs", Version: Version{Major: 1, Minor: 20}})
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	assert.Equal(t, "walletrpc: subtract_fee_from_outputs needs wallet rpc 1.26, the server is 1.20", err.Error())
+}
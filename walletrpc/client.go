@@ -2,18 +2,26 @@ package walletrpc
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/rpc/v2/json2"
 )
 
 func New(cfg Config) *Client {
 	cl := &Client{
-		addr:    cfg.Address,
-		headers: cfg.CustomHeaders,
-		httpcl:  http.DefaultClient,
+		addr:        cfg.Address,
+		headers:     cfg.CustomHeaders,
+		httpcl:      http.DefaultClient,
+		retry:       newRetryPolicy(cfg.Retry),
+		walletState: &walletState{},
 	}
+	cl.invoke = chain(cfg.Interceptors, cl.invokeOnce)
 
 	if cfg.Transport != nil {
 		cl.httpcl = &http.Client{Transport: cfg.Transport}
@@ -26,36 +34,121 @@ type Client struct {
 	httpcl  *http.Client
 	addr    string
 	headers map[string]string
+	retry   *retryPolicy
+	invoke  Invoker
+	// ctx of the calls, see WithContext
+	ctx context.Context
+
+	*walletState
+}
+
+// walletState is shared by a client and its copies from WithContext.
+type walletState struct {
+	// capabilities of the wallet, once detected, its version, the methods
+	// found unsupported and whether it refused a call for being view-only
+	detectMu  sync.Mutex
+	capsMu    sync.Mutex
+	caps      *Capabilities
+	version   *Version
+	missing   map[string]bool
+	watchOnly bool
+	// noBatch is set once the server rejected a batch request
+	noBatch bool
+}
+
+// WithContext returns a copy of the client making its calls with ctx,
+// which cancels them and is passed to the interceptors, e.g. to trace the
+// calls as part of a request.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	cp := *c
+	cp.ctx = ctx
+	return &cp
 }
 
 func (c *Client) do(method string, in, out interface{}) error {
+	if !c.supported(method) {
+		return &UnsupportedError{Method: method}
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.invoke(ctx, method, in, out)
+}
+
+// invokeOnce is the invoker behind the interceptors, making a call with
+// its retries.
+func (c *Client) invokeOnce(ctx context.Context, method string, in, out interface{}) error {
+	return c.withRetries(ctx, method, in, func() error {
+		if calls, ok := in.([]*BatchCall); ok && method == BatchMethod {
+			return c.callBatch(ctx, calls)
+		}
+		return c.call(ctx, method, in, out)
+	})
+}
+
+// call makes a single attempt of a call.
+func (c *Client) call(ctx context.Context, method string, in, out interface{}) error {
 	payload, err := json2.EncodeClientRequest(method, in)
 	if err != nil {
 		return err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, c.addr, bytes.NewBuffer(payload))
+	body, err := c.post(ctx, method, idempotencyKey(in), payload)
 	if err != nil {
 		return err
 	}
+	defer body.Close()
+
+	if out == nil {
+		out = new(json2.EmptyResponse)
+	}
+	err = json2.DecodeClientResponse(body, out)
+	gerr, ok := err.(*json2.Error)
+	if !ok {
+		return err
+	}
+	return c.callError(method, int(gerr.Code), gerr.Message)
+}
+
+// post sends a JSON-RPC payload and returns the body of the response.
+func (c *Client) post(ctx context.Context, method, idempotencyKey string, payload []byte) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.addr, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, err
+	}
 
 	for k, v := range c.headers {
 		req.Header.Set(k, v)
 	}
+	for k, vs := range headersFromContext(ctx) {
+		req.Header[k] = vs
+	}
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
 
 	resp, err := c.httpcl.Do(req)
 	if err != nil {
-		return err
+		return nil, &TransportError{Method: method, Err: err}
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("http status %v", resp.StatusCode)
+		defer resp.Body.Close()
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &HTTPStatusError{Method: method, StatusCode: resp.StatusCode, Body: string(snippet)}
 	}
+	return resp.Body, nil
+}
 
-	if out == nil {
-		return json2.DecodeClientResponse(resp.Body, new(json2.EmptyResponse))
+// callError returns the error of a JSON-RPC error response.
+func (c *Client) callError(method string, code int, message string) error {
+	if code == int(json2.E_NO_METHOD) {
+		c.unsupported(method)
+		return &UnsupportedError{Method: method}
+	}
+	if ErrorCode(code) == ErrWatchOnly {
+		c.viewOnly()
 	}
-	return json2.DecodeClientResponse(resp.Body, out)
+	return &WalletError{Code: ErrorCode(code), Message: message}
 }
 
 func (c *Client) GetBalance() (uint64, uint64, error) {
@@ -75,6 +168,49 @@ func (c *Client) GetAddress() (string, error) {
 	return jd.Address, err
 }
 
+// GetAccountAddress returns the primary address of an account.
+func (c *Client) GetAccountAddress(accountIndex uint64) (string, error) {
+	jin := struct {
+		AccountIndex uint64 `json:"account_index"`
+	}{
+		accountIndex,
+	}
+	jd := struct {
+		Address string `json:"address"`
+	}{}
+	err := c.do("getaddress", &jin, &jd)
+	return jd.Address, err
+}
+
+func (c *Client) GetAccounts(tag string) (resp GetAccountsResponse, err error) {
+	jin := struct {
+		Tag string `json:"tag,omitempty"`
+	}{
+		tag,
+	}
+	err = c.do("get_accounts", &jin, &resp)
+	return
+}
+
+func (c *Client) CreateAddress(accountIndex uint64, label string) (address string, addressIndex uint64, err error) {
+	jin := struct {
+		AccountIndex uint64 `json:"account_index"`
+		Label        string `json:"label,omitempty"`
+	}{
+		accountIndex,
+		label,
+	}
+	jd := struct {
+		Address      string `json:"address"`
+		AddressIndex uint64 `json:"address_index"`
+	}{}
+	err = c.do("create_address", &jin, &jd)
+	if err != nil {
+		return "", 0, err
+	}
+	return jd.Address, jd.AddressIndex, nil
+}
+
 func (c *Client) GetHeight() (uint64, error) {
 	jd := struct {
 		Height uint64 `json:"height"`
@@ -84,11 +220,17 @@ func (c *Client) GetHeight() (uint64, error) {
 }
 
 func (c *Client) Transfer(req TransferRequest) (resp TransferResponse, err error) {
+	if err = c.adaptTransfer(&req); err != nil {
+		return
+	}
 	err = c.do("transfer", &req, &resp)
 	return
 }
 
 func (c *Client) TransferSplit(req TransferRequest) (resp TransferSplitResponse, err error) {
+	if err = c.adaptTransfer(&req); err != nil {
+		return
+	}
 	err = c.do("transfer_split", &req, &resp)
 	return
 }
@@ -102,10 +244,31 @@ func (c *Client) SweepDust() ([]string, error) {
 }
 
 func (c *Client) SweepAll(req SweepAllRequest) (resp SweepAllResponse, err error) {
+	if err = c.adaptSweepAll(&req); err != nil {
+		return
+	}
 	err = c.do("sweep_all", &req, &resp)
 	return
 }
 
+func (c *Client) SweepSingle(req SweepSingleRequest) (resp SweepSingleResponse, err error) {
+	err = c.do("sweep_single", &req, &resp)
+	return
+}
+
+func (c *Client) RelayTx(hex string) (txHash string, err error) {
+	jin := struct {
+		Hex string `json:"hex"`
+	}{
+		hex,
+	}
+	jd := struct {
+		TxHash string `json:"tx_hash"`
+	}{}
+	err = c.do("relay_tx", &jin, &jd)
+	return jd.TxHash, err
+}
+
 func (c *Client) Store() error {
 	return c.do("store", nil, nil)
 }
@@ -175,20 +338,96 @@ func (c *Client) IncomingTransfers(transfer GetTransferType) ([]IncTransfer, err
 	return jd.Transfers, err
 }
 
-func (c *Client) QueryKey(keytype QueryKeyType) (key string, err error) {
+// GetIncomingTransfers returns the incoming transfers of an account, or of
+// some of its subaddresses. IncomingTransfers only returns those of the
+// account 0.
+func (c *Client) GetIncomingTransfers(req IncomingTransfersRequest) ([]IncTransfer, error) {
+	jd := struct {
+		Transfers []IncTransfer `json:"transfers"`
+	}{}
+	err := c.do("incoming_transfers", &req, &jd)
+	return jd.Transfers, err
+}
+
+func (c *Client) Freeze(keyImage string) error {
+	jin := struct {
+		KeyImage string `json:"key_image"`
+	}{
+		keyImage,
+	}
+	return c.do("freeze", &jin, nil)
+}
+
+func (c *Client) Thaw(keyImage string) error {
+	jin := struct {
+		KeyImage string `json:"key_image"`
+	}{
+		keyImage,
+	}
+	return c.do("thaw", &jin, nil)
+}
+
+func (c *Client) Frozen(keyImage string) (bool, error) {
+	jin := struct {
+		KeyImage string `json:"key_image"`
+	}{
+		keyImage,
+	}
+	jd := struct {
+		Frozen bool `json:"frozen"`
+	}{}
+	err := c.do("frozen", &jin, &jd)
+	return jd.Frozen, err
+}
+
+// ErrNoOutputs is returned by FreezeTxOutputs when the account has no
+// unspent output of the transaction, e.g. while it's in the pool.
+var ErrNoOutputs = errors.New("walletrpc: no unspent output of the transaction")
+
+// FreezeTxOutputs freezes the unspent outputs received by a transaction in
+// an account, e.g. to quarantine a tainted deposit, and returns their key
+// images. Use Thaw on each to release them. It fails with ErrNoOutputs if
+// there is none to freeze.
+func (c *Client) FreezeTxOutputs(accountIndex uint64, txHash string) (keyImages []string, err error) {
+	transfers, err := c.GetIncomingTransfers(IncomingTransfersRequest{
+		TransferType: TransferAvailable,
+		AccountIndex: accountIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range transfers {
+		if in.TxHash != txHash || in.Spent || in.SubaddrIndex.Major != accountIndex {
+			continue
+		}
+		if in.KeyImage == "" {
+			return keyImages, fmt.Errorf("output %v of %v has no key image", in.GlobalIndex, txHash)
+		}
+		if err = c.Freeze(in.KeyImage); err != nil {
+			return keyImages, err
+		}
+		keyImages = append(keyImages, in.KeyImage)
+	}
+	if len(keyImages) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrNoOutputs, txHash)
+	}
+	return keyImages, nil
+}
+
+func (c *Client) QueryKey(keytype QueryKeyType) (key Secret, err error) {
 	jin := struct {
 		KeyType QueryKeyType `json:"key_type"`
 	}{
 		keytype,
 	}
 	jd := struct {
-		Key string `json:"key"`
+		Key wireSecret `json:"key"`
 	}{}
 	err = c.do("query_key", &jin, &jd)
 	if err != nil {
 		return
 	}
-	key = jd.Key
+	key = Secret(jd.Key)
 	return
 }
 
@@ -413,26 +652,114 @@ func (c *Client) GetLanguages() ([]string, error) {
 	return jd.Languages, err
 }
 
-func (c *Client) CreateWallet(filename, password, language string) error {
+func (c *Client) CreateWallet(filename string, password Secret, language string) error {
 	jin := struct {
-		Filename string `json:"filename"`
-		Password string `json:"password"`
-		Language string `json:"language"`
+		Filename string     `json:"filename"`
+		Password wireSecret `json:"password"`
+		Language string     `json:"language"`
 	}{
 		filename,
-		password,
+		wireSecret(password),
 		language,
 	}
+	defer c.ResetCapabilities()
 	return c.do("create_wallet", &jin, nil)
 }
 
-func (c *Client) OpenWallet(filename, password string) error {
+func (c *Client) OpenWallet(filename string, password Secret) error {
 	jin := struct {
-		Filename string `json:"filename"`
-		Password string `json:"password"`
+		Filename string     `json:"filename"`
+		Password wireSecret `json:"password"`
 	}{
 		filename,
-		password,
+		wireSecret(password),
 	}
+	defer c.ResetCapabilities()
 	return c.do("open_wallet", &jin, nil)
 }
+
+func (c *Client) CloseWallet() error {
+	defer c.ResetCapabilities()
+	return c.do("close_wallet", nil, nil)
+}
+
+func (c *Client) SetDaemon(req SetDaemonRequest) error {
+	jin := struct {
+		Address    string     `json:"address"`
+		Trusted    bool       `json:"trusted"`
+		SSLSupport string     `json:"ssl_support,omitempty"`
+		Username   string     `json:"username,omitempty"`
+		Password   wireSecret `json:"password,omitempty"`
+	}{
+		req.Address,
+		req.Trusted,
+		req.SSLSupport,
+		req.Username,
+		wireSecret(req.Password),
+	}
+	return c.do("set_daemon", &jin, nil)
+}
+
+func (c *Client) RestoreDeterministicWallet(req RestoreDeterministicWalletRequest) (resp RestoreDeterministicWalletResponse, err error) {
+	jin := struct {
+		Filename        string     `json:"filename"`
+		Password        wireSecret `json:"password"`
+		Seed            wireSecret `json:"seed"`
+		SeedOffset      wireSecret `json:"seed_offset,omitempty"`
+		RestoreHeight   uint64     `json:"restore_height,omitempty"`
+		Language        string     `json:"language,omitempty"`
+		AutosaveCurrent bool       `json:"autosave_current"`
+	}{
+		req.Filename,
+		wireSecret(req.Password),
+		wireSecret(req.Seed),
+		wireSecret(req.SeedOffset),
+		req.RestoreHeight,
+		req.Language,
+		req.AutosaveCurrent,
+	}
+	jd := struct {
+		Address       string     `json:"address"`
+		Info          string     `json:"info"`
+		Seed          wireSecret `json:"seed"`
+		WasDeprecated bool       `json:"was_deprecated"`
+	}{}
+	defer c.ResetCapabilities()
+	err = c.do("restore_deterministic_wallet", &jin, &jd)
+	if err != nil {
+		return
+	}
+	resp = RestoreDeterministicWalletResponse{
+		Address:       jd.Address,
+		Info:          jd.Info,
+		Seed:          Secret(jd.Seed),
+		WasDeprecated: jd.WasDeprecated,
+	}
+	return
+}
+
+func (c *Client) GenerateFromKeys(req GenerateFromKeysRequest) (address string, err error) {
+	jin := struct {
+		Filename        string     `json:"filename"`
+		Address         string     `json:"address"`
+		SpendKey        wireSecret `json:"spendkey,omitempty"`
+		ViewKey         wireSecret `json:"viewkey"`
+		Password        wireSecret `json:"password"`
+		RestoreHeight   uint64     `json:"restore_height,omitempty"`
+		AutosaveCurrent bool       `json:"autosave_current"`
+	}{
+		req.Filename,
+		req.Address,
+		wireSecret(req.SpendKey),
+		wireSecret(req.ViewKey),
+		wireSecret(req.Password),
+		req.RestoreHeight,
+		req.AutosaveCurrent,
+	}
+	jd := struct {
+		Address string `json:"address"`
+	}{}
+	defer c.ResetCapabilities()
+	err = c.do("generate_from_keys", &jin, &jd)
+	return jd.Address, err
+}
@@ -2,6 +2,7 @@ package walletrpc
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,6 +14,9 @@ func TestClient(t *testing.T) {
 
 	testClientGetAddress(t)
 	testClientGetBalance(t)
+	testClientRelayTx(t)
+	testClientFreezeTxOutputs(t)
+	testClientGetAccounts(t)
 }
 
 func testClientGetAddress(t *testing.T) {
@@ -76,6 +80,128 @@ func testClientGetBalance(t *testing.T) {
 	assert.Equal(t, uint64(10000000000000), unlocked)
 }
 
+func testClientRelayTx(t *testing.T) {
+	//
+	// server setup
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			if method == "relay_tx" {
+				p0 := struct {
+					Hex string `json:"hex"`
+				}{}
+				json.Unmarshal(*params, &p0)
+				if p0.Hex != "0201" {
+					writerpcResponseError(ErrWrongTxID, "Failed to parse hex.", w)
+					return true
+				}
+				r0 := struct {
+					TxHash string `json:"tx_hash"`
+				}{
+					"c3a4b1",
+				}
+				writerpcResponseOK(&r0, w)
+				return true
+			}
+			return false
+		},
+	})
+	defer sv0.Close()
+	//
+	// test starts here
+	rpccl := New(Config{
+		Address: sv0.URL + "/json_rpc",
+	})
+	hash, err := rpccl.RelayTx("0201")
+	assert.NoError(t, err)
+	assert.Equal(t, "c3a4b1", hash)
+	_, err = rpccl.RelayTx("zz")
+	iswerr, werr := GetWalletError(err)
+	assert.True(t, iswerr)
+	assert.Equal(t, ErrWrongTxID, werr.Code)
+}
+
+func testClientFreezeTxOutputs(t *testing.T) {
+	//
+	// server setup
+	frozen := make(map[string]bool)
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			if method == "incoming_transfers" {
+				p0 := struct {
+					AccountIndex uint64 `json:"account_index"`
+				}{}
+				json.Unmarshal(*params, &p0)
+				r0 := struct {
+					Transfers []IncTransfer `json:"transfers"`
+				}{}
+				for _, in := range []IncTransfer{
+					{Amount: 1, TxHash: "aa", KeyImage: "k1"},
+					{Amount: 2, TxHash: "bb", KeyImage: "k2"},
+					{Amount: 3, TxHash: "aa", KeyImage: "k3", SubaddrIndex: SubaddressIndex{1, 2}},
+				} {
+					if in.SubaddrIndex.Major == p0.AccountIndex {
+						r0.Transfers = append(r0.Transfers, in)
+					}
+				}
+				writerpcResponseOK(&r0, w)
+				return true
+			}
+			p0 := struct {
+				KeyImage string `json:"key_image"`
+			}{}
+			switch method {
+			case "freeze":
+				json.Unmarshal(*params, &p0)
+				frozen[p0.KeyImage] = true
+				writerpcResponseOK(&struct{}{}, w)
+				return true
+			case "thaw":
+				json.Unmarshal(*params, &p0)
+				delete(frozen, p0.KeyImage)
+				writerpcResponseOK(&struct{}{}, w)
+				return true
+			case "frozen":
+				json.Unmarshal(*params, &p0)
+				r0 := struct {
+					Frozen bool `json:"frozen"`
+				}{
+					frozen[p0.KeyImage],
+				}
+				writerpcResponseOK(&r0, w)
+				return true
+			}
+			return false
+		},
+	})
+	defer sv0.Close()
+	//
+	// test starts here
+	rpccl := New(Config{
+		Address: sv0.URL + "/json_rpc",
+	})
+	keyImages, err := rpccl.FreezeTxOutputs(0, "aa")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k1"}, keyImages)
+	_, err = rpccl.FreezeTxOutputs(0, "cc")
+	assert.True(t, errors.Is(err, ErrNoOutputs))
+	isFrozen, err := rpccl.Frozen("k1")
+	assert.NoError(t, err)
+	assert.True(t, isFrozen)
+	isFrozen, err = rpccl.Frozen("k3")
+	assert.NoError(t, err)
+	assert.False(t, isFrozen, "other account")
+	keyImages, err = rpccl.FreezeTxOutputs(1, "aa")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k3"}, keyImages)
+	assert.NoError(t, rpccl.Thaw("k3"))
+	isFrozen, err = rpccl.Frozen("k3")
+	assert.NoError(t, err)
+	assert.False(t, isFrozen)
+	isFrozen, err = rpccl.Frozen("k2")
+	assert.NoError(t, err)
+	assert.False(t, isFrozen)
+}
+
 type testfn = func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool
 
 func basicTestServer(tests []testfn) *httptest.Server {
@@ -152,3 +278,43 @@ type clientResponse struct {
 	Result  interface{} `json:"result"`
 	Error   interface{} `json:"error"`
 }
+
+func testClientGetAccounts(t *testing.T) {
+	//
+	// server setup
+	var tag string
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			if method == "get_accounts" {
+				p0 := struct {
+					Tag string `json:"tag"`
+				}{}
+				json.Unmarshal(*params, &p0)
+				tag = p0.Tag
+				r0 := GetAccountsResponse{
+					SubaddressAccounts: []Account{
+						{AccountIndex: 0, Balance: 10, UnlockedBalance: 5},
+						{AccountIndex: 1, Balance: 20, UnlockedBalance: 20, Label: "savings"},
+					},
+					TotalBalance:         30,
+					TotalUnlockedBalance: 25,
+				}
+				writerpcResponseOK(&r0, w)
+				return true
+			}
+			return false
+		},
+	})
+	defer sv0.Close()
+	//
+	// test starts here
+	rpccl := New(Config{
+		Address: sv0.URL + "/json_rpc",
+	})
+	resp, err := rpccl.GetAccounts("shop")
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", tag)
+	assert.Len(t, resp.SubaddressAccounts, 2)
+	assert.Equal(t, "savings", resp.SubaddressAccounts[1].Label)
+	assert.Equal(t, uint64(25), resp.TotalUnlockedBalance)
+}
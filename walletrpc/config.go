@@ -9,4 +9,9 @@ type Config struct {
 	Address       string
 	CustomHeaders map[string]string
 	Transport     http.RoundTripper
+	// Retry (optional) retries the calls failing with a transient error,
+	// no call is retried when nil.
+	Retry *RetryPolicy
+	// Interceptors (optional) run in order around every call.
+	Interceptors []Interceptor
 }
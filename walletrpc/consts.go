@@ -1,6 +1,7 @@
 package walletrpc
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gorilla/rpc/v2/json2"
@@ -10,7 +11,11 @@ import (
 type H map[string]interface{}
 
 // ErrorCode is a monero-wallet-rpc error code.
-// Copied from https://github.com/monero-project/monero/blob/release-v0.11.0.0/src/wallet/wallet_rpc_server_error_codes.h
+// Copied from https://github.com/monero-project/monero/blob/master/src/wallet/wallet_rpc_server_error_codes.h
+// (the E_ names are the v0.11 ones).
+//
+// Codes are errors, so a call failing with one of them can be tested with
+// errors.Is(err, ErrNotEnoughMoney).
 type ErrorCode int
 
 const (
@@ -40,8 +45,148 @@ const (
 	ErrWrongIndex ErrorCode = -12
 	// ErrNotOpen - E_NOT_OPEN
 	ErrNotOpen ErrorCode = -13
+	// ErrAccountIndexOutOfBounds - WALLET_RPC_ERROR_CODE_ACCOUNT_INDEX_OUT_OF_BOUNDS
+	ErrAccountIndexOutOfBounds ErrorCode = -14
+	// ErrAddressIndexOutOfBounds - WALLET_RPC_ERROR_CODE_ADDRESS_INDEX_OUT_OF_BOUNDS
+	ErrAddressIndexOutOfBounds ErrorCode = -15
+	// ErrTxNotPossible - WALLET_RPC_ERROR_CODE_TX_NOT_POSSIBLE
+	ErrTxNotPossible ErrorCode = -16
+	// ErrNotEnoughMoney - WALLET_RPC_ERROR_CODE_NOT_ENOUGH_MONEY
+	ErrNotEnoughMoney ErrorCode = -17
+	// ErrTxTooLarge - WALLET_RPC_ERROR_CODE_TX_TOO_LARGE
+	ErrTxTooLarge ErrorCode = -18
+	// ErrNotEnoughOutsToMix - WALLET_RPC_ERROR_CODE_NOT_ENOUGH_OUTS_TO_MIX
+	ErrNotEnoughOutsToMix ErrorCode = -19
+	// ErrZeroDestination - WALLET_RPC_ERROR_CODE_ZERO_DESTINATION
+	ErrZeroDestination ErrorCode = -20
+	// ErrWalletAlreadyExists - WALLET_RPC_ERROR_CODE_WALLET_ALREADY_EXISTS
+	ErrWalletAlreadyExists ErrorCode = -21
+	// ErrInvalidPassword - WALLET_RPC_ERROR_CODE_INVALID_PASSWORD
+	ErrInvalidPassword ErrorCode = -22
+	// ErrNoWalletDir - WALLET_RPC_ERROR_CODE_NO_WALLET_DIR
+	ErrNoWalletDir ErrorCode = -23
+	// ErrNoTxKey - WALLET_RPC_ERROR_CODE_NO_TXKEY
+	ErrNoTxKey ErrorCode = -24
+	// ErrWrongKey - WALLET_RPC_ERROR_CODE_WRONG_KEY
+	ErrWrongKey ErrorCode = -25
+	// ErrBadHex - WALLET_RPC_ERROR_CODE_BAD_HEX
+	ErrBadHex ErrorCode = -26
+	// ErrBadTxMetadata - WALLET_RPC_ERROR_CODE_BAD_TX_METADATA
+	ErrBadTxMetadata ErrorCode = -27
+	// ErrAlreadyMultisig - WALLET_RPC_ERROR_CODE_ALREADY_MULTISIG
+	ErrAlreadyMultisig ErrorCode = -28
+	// ErrWatchOnly - WALLET_RPC_ERROR_CODE_WATCH_ONLY
+	ErrWatchOnly ErrorCode = -29
+	// ErrBadMultisigInfo - WALLET_RPC_ERROR_CODE_BAD_MULTISIG_INFO
+	ErrBadMultisigInfo ErrorCode = -30
+	// ErrNotMultisig - WALLET_RPC_ERROR_CODE_NOT_MULTISIG
+	ErrNotMultisig ErrorCode = -31
+	// ErrWrongLR - WALLET_RPC_ERROR_CODE_WRONG_LR
+	ErrWrongLR ErrorCode = -32
+	// ErrThresholdNotReached - WALLET_RPC_ERROR_CODE_THRESHOLD_NOT_REACHED
+	ErrThresholdNotReached ErrorCode = -33
+	// ErrBadMultisigTxData - WALLET_RPC_ERROR_CODE_BAD_MULTISIG_TX_DATA
+	ErrBadMultisigTxData ErrorCode = -34
+	// ErrMultisigSignature - WALLET_RPC_ERROR_CODE_MULTISIG_SIGNATURE
+	ErrMultisigSignature ErrorCode = -35
+	// ErrMultisigSubmission - WALLET_RPC_ERROR_CODE_MULTISIG_SUBMISSION
+	ErrMultisigSubmission ErrorCode = -36
+	// ErrNotEnoughUnlockedMoney - WALLET_RPC_ERROR_CODE_NOT_ENOUGH_UNLOCKED_MONEY
+	ErrNotEnoughUnlockedMoney ErrorCode = -37
+	// ErrNoDaemonConnection - WALLET_RPC_ERROR_CODE_NO_DAEMON_CONNECTION
+	ErrNoDaemonConnection ErrorCode = -38
+	// ErrBadUnsignedTxData - WALLET_RPC_ERROR_CODE_BAD_UNSIGNED_TX_DATA
+	ErrBadUnsignedTxData ErrorCode = -39
+	// ErrBadSignedTxData - WALLET_RPC_ERROR_CODE_BAD_SIGNED_TX_DATA
+	ErrBadSignedTxData ErrorCode = -40
+	// ErrSignedSubmission - WALLET_RPC_ERROR_CODE_SIGNED_SUBMISSION
+	ErrSignedSubmission ErrorCode = -41
+	// ErrSignUnsigned - WALLET_RPC_ERROR_CODE_SIGN_UNSIGNED
+	ErrSignUnsigned ErrorCode = -42
+	// ErrNonDeterministic - WALLET_RPC_ERROR_CODE_NON_DETERMINISTIC
+	ErrNonDeterministic ErrorCode = -43
+	// ErrInvalidLogLevel - WALLET_RPC_ERROR_CODE_INVALID_LOG_LEVEL
+	ErrInvalidLogLevel ErrorCode = -44
+	// ErrAttributeNotFound - WALLET_RPC_ERROR_CODE_ATTRIBUTE_NOT_FOUND
+	ErrAttributeNotFound ErrorCode = -45
+	// ErrZeroAmount - WALLET_RPC_ERROR_CODE_ZERO_AMOUNT
+	ErrZeroAmount ErrorCode = -46
+	// ErrInvalidSignatureType - WALLET_RPC_ERROR_CODE_INVALID_SIGNATURE_TYPE
+	ErrInvalidSignatureType ErrorCode = -47
+	// ErrDisabled - WALLET_RPC_ERROR_CODE_DISABLED
+	ErrDisabled ErrorCode = -48
+	// ErrProxyAlreadyDefined - WALLET_RPC_ERROR_CODE_PROXY_ALREADY_DEFINED
+	ErrProxyAlreadyDefined ErrorCode = -49
+	// ErrNonzeroUnlockTime - WALLET_RPC_ERROR_CODE_NONZERO_UNLOCK_TIME
+	ErrNonzeroUnlockTime ErrorCode = -50
+
+	// ErrMethodNotFound is the JSON-RPC code of an unknown method, see
+	// ErrUnsupported.
+	ErrMethodNotFound ErrorCode = -32601
 )
 
+var errorCodeNames = map[ErrorCode]string{
+	ErrUnknown:                 "UNKNOWN_ERROR",
+	ErrWrongAddress:            "WRONG_ADDRESS",
+	ErrDaemonIsBusy:            "DAEMON_IS_BUSY",
+	ErrGenericTransferError:    "GENERIC_TRANSFER_ERROR",
+	ErrWrongPaymentID:          "WRONG_PAYMENT_ID",
+	ErrTransferType:            "TRANSFER_TYPE",
+	ErrDenied:                  "DENIED",
+	ErrWrongTxID:               "WRONG_TXID",
+	ErrWrongSignature:          "WRONG_SIGNATURE",
+	ErrWrongKeyImage:           "WRONG_KEY_IMAGE",
+	ErrWrongURI:                "WRONG_URI",
+	ErrWrongIndex:              "WRONG_INDEX",
+	ErrNotOpen:                 "NOT_OPEN",
+	ErrAccountIndexOutOfBounds: "ACCOUNT_INDEX_OUT_OF_BOUNDS",
+	ErrAddressIndexOutOfBounds: "ADDRESS_INDEX_OUT_OF_BOUNDS",
+	ErrTxNotPossible:           "TX_NOT_POSSIBLE",
+	ErrNotEnoughMoney:          "NOT_ENOUGH_MONEY",
+	ErrTxTooLarge:              "TX_TOO_LARGE",
+	ErrNotEnoughOutsToMix:      "NOT_ENOUGH_OUTS_TO_MIX",
+	ErrZeroDestination:         "ZERO_DESTINATION",
+	ErrWalletAlreadyExists:     "WALLET_ALREADY_EXISTS",
+	ErrInvalidPassword:         "INVALID_PASSWORD",
+	ErrNoWalletDir:             "NO_WALLET_DIR",
+	ErrNoTxKey:                 "NO_TXKEY",
+	ErrWrongKey:                "WRONG_KEY",
+	ErrBadHex:                  "BAD_HEX",
+	ErrBadTxMetadata:           "BAD_TX_METADATA",
+	ErrAlreadyMultisig:         "ALREADY_MULTISIG",
+	ErrWatchOnly:               "WATCH_ONLY",
+	ErrBadMultisigInfo:         "BAD_MULTISIG_INFO",
+	ErrNotMultisig:             "NOT_MULTISIG",
+	ErrWrongLR:                 "WRONG_LR",
+	ErrThresholdNotReached:     "THRESHOLD_NOT_REACHED",
+	ErrBadMultisigTxData:       "BAD_MULTISIG_TX_DATA",
+	ErrMultisigSignature:       "MULTISIG_SIGNATURE",
+	ErrMultisigSubmission:      "MULTISIG_SUBMISSION",
+	ErrNotEnoughUnlockedMoney:  "NOT_ENOUGH_UNLOCKED_MONEY",
+	ErrNoDaemonConnection:      "NO_DAEMON_CONNECTION",
+	ErrBadUnsignedTxData:       "BAD_UNSIGNED_TX_DATA",
+	ErrBadSignedTxData:         "BAD_SIGNED_TX_DATA",
+	ErrSignedSubmission:        "SIGNED_SUBMISSION",
+	ErrSignUnsigned:            "SIGN_UNSIGNED",
+	ErrNonDeterministic:        "NON_DETERMINISTIC",
+	ErrInvalidLogLevel:         "INVALID_LOG_LEVEL",
+	ErrAttributeNotFound:       "ATTRIBUTE_NOT_FOUND",
+	ErrZeroAmount:              "ZERO_AMOUNT",
+	ErrInvalidSignatureType:    "INVALID_SIGNATURE_TYPE",
+	ErrDisabled:                "DISABLED",
+	ErrProxyAlreadyDefined:     "PROXY_ALREADY_DEFINED",
+	ErrNonzeroUnlockTime:       "NONZERO_UNLOCK_TIME",
+	ErrMethodNotFound:          "METHOD_NOT_FOUND",
+}
+
+// Error returns the name of the code.
+func (c ErrorCode) Error() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return fmt.Sprintf("wallet rpc error %d (%v)", int(c), name)
+	}
+	return fmt.Sprintf("wallet rpc error %d", int(c))
+}
+
 // WalletError is the error structured returned by the monero-wallet-rpc
 type WalletError struct {
 	Code    ErrorCode `json:"code"`
@@ -49,7 +194,13 @@ type WalletError struct {
 }
 
 func (we *WalletError) Error() string {
-	return fmt.Sprintf("%v: %v", we.Code, we.Message)
+	return fmt.Sprintf("%d: %v", int(we.Code), we.Message)
+}
+
+// Is makes errors.Is(err, code) true for the ErrorCode of the error.
+func (we *WalletError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code == we.Code
 }
 
 // GetWalletError checks if an erro interface is a wallet-rpc error.
@@ -57,8 +208,11 @@ func GetWalletError(err error) (isWalletError bool, werr *WalletError) {
 	if err == nil {
 		return false, nil
 	}
-	gerr, ok := err.(*json2.Error)
-	if !ok {
+	if errors.As(err, &werr) {
+		return true, werr
+	}
+	var gerr *json2.Error
+	if !errors.As(err, &gerr) {
 		return false, nil
 	}
 	werr = &WalletError{
@@ -24,6 +24,30 @@ func (c *Client) GetLastBlockHeader() (res BlockHeaderResponse, err error) {
 	return
 }
 
+// DaemonInfo is the response of get_info, the state of monerod.
+type DaemonInfo struct {
+	Height                   uint64 `json:"height"`
+	TargetHeight             uint64 `json:"target_height"`
+	TopBlockHash             string `json:"top_block_hash"`
+	Difficulty               uint64 `json:"difficulty"`
+	TxPoolSize               uint64 `json:"tx_pool_size"`
+	IncomingConnectionsCount uint64 `json:"incoming_connections_count"`
+	OutgoingConnectionsCount uint64 `json:"outgoing_connections_count"`
+	Nettype                  string `json:"nettype"`
+	Offline                  bool   `json:"offline"`
+	BusySyncing              bool   `json:"busy_syncing"`
+	Synchronized             bool   `json:"synchronized"`
+	Version                  string `json:"version"`
+	Status                   string `json:"status"`
+}
+
+// GetInfo returns the state of monerod, its height in particular, which is
+// the number of blocks: one more than the height of the last block.
+func (c *Client) GetInfo() (res DaemonInfo, err error) {
+	err = c.do("get_info", nil, &res)
+	return
+}
+
 type Block struct {
 	Blob        string      `json:"blob"`
 	BlockHeader BlockHeader `json:"block_header"`
@@ -46,3 +70,10 @@ func (c *Client) GetBlockByHash(hash string) (res Block, err error) {
 	err = c.do("getblock", req, &res)
 	return
 }
+
+// GetDaemonVersion returns the RPC version of monerod (CORE_RPC_VERSION),
+// for a client pointed at a daemon. It's GetVersion under another name, the
+// method being the same.
+func (c *Client) GetDaemonVersion() (Version, error) {
+	return c.GetVersion()
+}
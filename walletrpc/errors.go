@@ -0,0 +1,71 @@
+package walletrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// TransportError is returned when a call didn't get an HTTP response. The
+// call may or may not have reached the server.
+type TransportError struct {
+	Method string
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("walletrpc: %v: %v", e.Method, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError is returned when the server answers a call with a non
+// 200 status, e.g. 401 for a wrong rpc login.
+type HTTPStatusError struct {
+	Method     string
+	StatusCode int
+	// Body is the beginning of the response body.
+	Body string
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("walletrpc: %v: http status %v", e.Method, e.StatusCode)
+	}
+	return fmt.Sprintf("walletrpc: %v: http status %v: %v", e.Method, e.StatusCode, e.Body)
+}
+
+// IsRetryable reports whether a failed call may succeed if made again:
+// transport errors, 5xx, 408 and 429 statuses, and a busy or disconnected
+// daemon. Whether it's safe to make a call again is another matter: a
+// transfer whose response was lost may have been sent.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var te *TransportError
+	if errors.As(err, &te) {
+		return true
+	}
+	var he *HTTPStatusError
+	if errors.As(err, &he) {
+		return he.StatusCode >= 500 || he.StatusCode == http.StatusTooManyRequests ||
+			he.StatusCode == http.StatusRequestTimeout
+	}
+	return errors.Is(err, ErrDaemonIsBusy) || errors.Is(err, ErrNoDaemonConnection)
+}
+
+// IsNotSent reports whether a call failed before the wallet acted on it:
+// the connection couldn't be made, or the wallet found the daemon busy.
+// Such a call, a transfer included, can safely be made again.
+func IsNotSent(err error) bool {
+	var oe *net.OpError
+	if errors.As(err, &oe) && oe.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, ErrDaemonIsBusy)
+}
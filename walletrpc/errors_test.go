@@ -0,0 +1,66 @@
+package walletrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			switch method {
+			case "getbalance":
+				writerpcResponseError(ErrNotEnoughUnlockedMoney, "not enough unlocked money", w)
+			case "getheight":
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+			case "getaddress":
+				http.Error(w, "login", http.StatusUnauthorized)
+			default:
+				return false
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+	rpccl := New(Config{Address: sv0.URL + "/json_rpc"})
+
+	_, _, err := rpccl.GetBalance()
+	var werr *WalletError
+	assert.True(t, errors.As(err, &werr))
+	assert.True(t, errors.Is(err, ErrNotEnoughUnlockedMoney))
+	assert.False(t, errors.Is(err, ErrNotEnoughMoney))
+	assert.True(t, errors.Is(fmt.Errorf("wrapped: %w", err), ErrNotEnoughUnlockedMoney))
+	assert.Equal(t, "-37: not enough unlocked money", err.Error())
+	assert.False(t, IsRetryable(err))
+
+	_, err = rpccl.GetHeight()
+	var he *HTTPStatusError
+	assert.True(t, errors.As(err, &he))
+	assert.Equal(t, http.StatusServiceUnavailable, he.StatusCode)
+	assert.Equal(t, "busy\n", he.Body)
+	assert.True(t, IsRetryable(err))
+
+	_, err = rpccl.GetAddress()
+	assert.False(t, IsRetryable(err))
+
+	sv0.Close()
+	_, err = rpccl.GetHeight()
+	var te *TransportError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "getheight", te.Method)
+	assert.True(t, IsRetryable(err))
+	assert.True(t, IsNotSent(err), "the server is closed, the dial fails")
+
+	assert.True(t, IsRetryable(&WalletError{Code: ErrDaemonIsBusy}))
+	assert.True(t, IsNotSent(&WalletError{Code: ErrDaemonIsBusy}))
+	assert.False(t, IsNotSent(&TransportError{Err: errors.New("connection reset")}))
+	assert.False(t, IsRetryable(&TransportError{Err: context.Canceled}))
+	assert.Equal(t, "wallet rpc error -17 (NOT_ENOUGH_MONEY)", ErrNotEnoughMoney.Error())
+	assert.Equal(t, "wallet rpc error -1000", ErrorCode(-1000).Error())
+}
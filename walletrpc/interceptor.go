@@ -0,0 +1,126 @@
+package walletrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Invoker makes a JSON-RPC call, decoding its result in result.
+type Invoker func(ctx context.Context, method string, params, result interface{}) error
+
+// Interceptor runs around the JSON-RPC calls of a client, and calls next
+// to carry on with the call. It may change the params, the context (see
+// ContextWithHeader) or the error, or not call next at all.
+type Interceptor func(ctx context.Context, method string, params, result interface{}, next Invoker) error
+
+// chain returns the invoker running the interceptors in order around
+// invoke, the first one being the outermost.
+func chain(interceptors []Interceptor, invoke Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		icpt, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, method string, params, result interface{}) error {
+			return icpt(ctx, method, params, result, next)
+		}
+	}
+	return invoke
+}
+
+type headerKey struct{}
+
+// ContextWithHeader returns a context adding an HTTP header to the request
+// of a call, for the interceptors, e.g. to set a refreshed auth token.
+func ContextWithHeader(ctx context.Context, key, value string) context.Context {
+	h := make(http.Header)
+	for k, vs := range headersFromContext(ctx) {
+		h[k] = vs
+	}
+	h.Set(key, value)
+	return context.WithValue(ctx, headerKey{}, h)
+}
+
+func headersFromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headerKey{}).(http.Header)
+	return h
+}
+
+// LoggingInterceptor logs every call with log, whose signature matches the
+// methods of log/slog.Logger: the method, its params and result with their
+// secrets redacted, the duration and the error.
+func LoggingInterceptor(log func(msg string, keyvals ...interface{})) Interceptor {
+	return func(ctx context.Context, method string, params, result interface{}, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, method, params, result)
+		keyvals := []interface{}{
+			"method", method,
+			"params", redact(params),
+			"duration", time.Since(start),
+		}
+		if err != nil {
+			log("wallet rpc call failed", append(keyvals, "error", err.Error())...)
+			return err
+		}
+		log("wallet rpc call", append(keyvals, "result", redact(result))...)
+		return nil
+	}
+}
+
+// TimingInterceptor passes the duration and error of every call to observe.
+func TimingInterceptor(observe func(method string, d time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, method string, params, result interface{}, next Invoker) error {
+		start := time.Now()
+		err := next(ctx, method, params, result)
+		observe(method, time.Since(start), err)
+		return err
+	}
+}
+
+// redactedFields are the params and result fields holding secrets.
+var redactedFields = map[string]bool{
+	"password":     true,
+	"old_password": true,
+	"new_password": true,
+	"seed":         true,
+	"seed_offset":  true,
+	"mnemonic":     true,
+	"spendkey":     true,
+	"viewkey":      true,
+	// query_key
+	"key": true,
+}
+
+// redact returns the JSON encoding of v with the secret fields redacted.
+func redact(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	var tree interface{}
+	if err := json.Unmarshal(b, &tree); err != nil {
+		return ""
+	}
+	b, _ = json.Marshal(redactTree(tree))
+	return string(b)
+}
+
+func redactTree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if redactedFields[k] {
+				v[k] = "[redacted]"
+			} else {
+				v[k] = redactTree(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redactTree(e)
+		}
+	}
+	return v
+}
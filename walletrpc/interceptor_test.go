@@ -0,0 +1,110 @@
+package walletrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterceptors(t *testing.T) {
+	var tokens []string
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			switch method {
+			case "getheight":
+				tokens = append(tokens, r.Header.Get("Authorization"))
+				if r.Header.Get("Authorization") != "Bearer fresh" {
+					http.Error(w, "expired", http.StatusUnauthorized)
+					return true
+				}
+				writerpcResponseOK(map[string]uint64{"height": 7}, w)
+			case "query_key":
+				writerpcResponseOK(map[string]string{"key": "s3cr3t"}, w)
+			case "open_wallet":
+				writerpcResponseError(ErrInvalidPassword, "invalid password", w)
+			default:
+				return false
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+
+	var order []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, method string, params, result interface{}, next Invoker) error {
+			order = append(order, name+" "+method)
+			return next(ctx, method, params, result)
+		}
+	}
+	refresh := func(ctx context.Context, method string, params, result interface{}, next Invoker) error {
+		err := next(ctx, method, params, result)
+		var he *HTTPStatusError
+		if errors.As(err, &he) && he.StatusCode == http.StatusUnauthorized {
+			return next(ContextWithHeader(ctx, "Authorization", "Bearer fresh"), method, params, result)
+		}
+		return err
+	}
+	var logs []string
+	logger := func(msg string, keyvals ...interface{}) {
+		logs = append(logs, fmt.Sprint(append([]interface{}{msg}, keyvals...)...))
+	}
+	timings := make(map[string]error)
+	rpccl := New(Config{
+		Address: sv0.URL + "/json_rpc",
+		Interceptors: []Interceptor{
+			trace("first"),
+			trace("second"),
+			LoggingInterceptor(logger),
+			TimingInterceptor(func(method string, d time.Duration, err error) {
+				assert.True(t, d > 0)
+				timings[method] = err
+			}),
+			refresh,
+		},
+	})
+
+	height, err := rpccl.GetHeight()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), height)
+	assert.Equal(t, []string{"", "Bearer fresh"}, tokens)
+	assert.Equal(t, []string{"first getheight", "second getheight"}, order)
+	assert.Contains(t, timings, "getheight")
+
+	key, err := rpccl.QueryKey(QueryKeySpend)
+	assert.NoError(t, err)
+	assert.Equal(t, Secret("s3cr3t"), key)
+
+	err = rpccl.OpenWallet("wallet", "hunter2")
+	assert.Error(t, err)
+	assert.Equal(t, err, timings["open_wallet"])
+
+	if assert.Len(t, logs, 3) {
+		assert.True(t, strings.HasPrefix(logs[0], "wallet rpc call"))
+		assert.Contains(t, logs[1], `{"key":"[redacted]"}`)
+		assert.Contains(t, logs[2], "wallet rpc call failed")
+		assert.Contains(t, logs[2], `"password":"[redacted]"`)
+	}
+	for _, l := range logs {
+		assert.NotContains(t, l, "s3cr3t")
+		assert.NotContains(t, l, "hunter2")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "", redact(nil))
+	assert.Equal(t,
+		`{"filename":"w","password":"[redacted]","restore":[{"seed":"[redacted]"}]}`,
+		redact(map[string]interface{}{
+			"filename": "w",
+			"password": "p",
+			"restore":  []interface{}{map[string]string{"seed": "abandon"}},
+		}))
+}
@@ -0,0 +1,209 @@
+package walletrpc
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// IdempotencyKeyHeader carries the idempotency key of a call, see
+// TransferRequest.IdempotencyKey.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// RetryPolicy configures the retries of the calls failing with a
+// retryable error (see IsRetryable).
+type RetryPolicy struct {
+	// MaxAttempts per call, first one included. Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled every
+	// attempt up to MaxBackoff. Default to 200ms and 5s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of a delay picked at random, to spread the
+	// retries of concurrent calls. Defaults to 0.5, negative disables it.
+	Jitter float64
+	// Methods are the JSON-RPC methods that may be retried. Defaults to
+	// DefaultRetryMethods. Non-idempotent methods, like transfer, are
+	// only retried when the call has an idempotency key, and then only
+	// when it failed to connect or the daemon was busy, unless
+	// Deduplicated.
+	Methods []string
+	// Deduplicated tells that the calls go through a proxy deduplicating
+	// them by their Idempotency-Key header, which monero-wallet-rpc
+	// ignores: non-idempotent calls with a key are then retried on any
+	// retryable error. Without such a proxy, a transfer whose response
+	// was lost would be sent twice.
+	Deduplicated bool
+	// OnRetry (optional) is called before every retry.
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a retry, for RetryPolicy.OnRetry.
+type RetryAttempt struct {
+	Method string
+	// Attempt is the number of the attempt about to be made, from 2.
+	Attempt int
+	Delay   time.Duration
+	// Err is the error of the previous attempt.
+	Err error
+}
+
+// DefaultRetryMethods are the read-only methods retried by default.
+var DefaultRetryMethods = []string{
+	"getbalance", "getaddress", "get_accounts", "getheight", "get_version", "is_multisig",
+	"get_payments", "get_bulk_payments", "get_transfers", "get_transfer_by_txid",
+	"incoming_transfers", "query_key", "frozen", "get_tx_notes",
+	"get_address_book", "get_languages", "make_integrated_address",
+	"split_integrated_address", "make_uri", "parse_uri", "verify",
+	"getlastblockheader", "getblock", "get_info",
+}
+
+// nonIdempotent are the methods that must not run twice by accident.
+var nonIdempotent = map[string]bool{
+	"transfer":                     true,
+	"transfer_split":               true,
+	"sweep_all":                    true,
+	"sweep_dust":                   true,
+	"sweep_single":                 true,
+	"relay_tx":                     true,
+	"submit_transfer":              true,
+	"create_address":               true,
+	"create_account":               true,
+	"create_wallet":                true,
+	"restore_deterministic_wallet": true,
+	"generate_from_keys":           true,
+	"add_address_book":             true,
+}
+
+// idempotencyKeyer is implemented by the requests carrying an idempotency key.
+type idempotencyKeyer interface {
+	idempotencyKey() string
+}
+
+func (req TransferRequest) idempotencyKey() string    { return req.IdempotencyKey }
+func (req SweepAllRequest) idempotencyKey() string    { return req.IdempotencyKey }
+func (req SweepSingleRequest) idempotencyKey() string { return req.IdempotencyKey }
+
+func idempotencyKey(in interface{}) string {
+	if k, ok := in.(idempotencyKeyer); ok {
+		return k.idempotencyKey()
+	}
+	return ""
+}
+
+// retryPolicy is a RetryPolicy with the defaults applied.
+type retryPolicy struct {
+	RetryPolicy
+	methods map[string]bool
+}
+
+func newRetryPolicy(p *RetryPolicy) *retryPolicy {
+	if p == nil {
+		return nil
+	}
+	rp := &retryPolicy{RetryPolicy: *p, methods: make(map[string]bool)}
+	if rp.MaxAttempts <= 0 {
+		rp.MaxAttempts = 3
+	}
+	if rp.InitialBackoff <= 0 {
+		rp.InitialBackoff = 200 * time.Millisecond
+	}
+	if rp.MaxBackoff <= 0 {
+		rp.MaxBackoff = 5 * time.Second
+	}
+	if rp.Jitter == 0 {
+		rp.Jitter = 0.5
+	}
+	if rp.Methods == nil {
+		rp.Methods = DefaultRetryMethods
+	}
+	for _, m := range rp.Methods {
+		rp.methods[m] = true
+	}
+	return rp
+}
+
+// allows reports whether a call may be retried.
+func (rp *retryPolicy) allows(method, key string) bool {
+	if nonIdempotent[method] {
+		return key != ""
+	}
+	return rp.methods[method]
+}
+
+// allowsCall reports whether a call may be retried, a batch request when
+// all its calls may.
+func (rp *retryPolicy) allowsCall(method string, in interface{}) bool {
+	calls, ok := in.([]*BatchCall)
+	if !ok || method != BatchMethod {
+		return rp.allows(method, idempotencyKey(in))
+	}
+	for _, bc := range calls {
+		if !rp.allows(bc.Method, idempotencyKey(bc.Params)) {
+			return false
+		}
+	}
+	return true
+}
+
+// retryable reports whether a failed call may be made again.
+func (rp *retryPolicy) retryable(method string, in interface{}, err error) bool {
+	if !IsRetryable(err) {
+		return false
+	}
+	return rp.Deduplicated || !sendsOnce(method, in) || IsNotSent(err)
+}
+
+// sendsOnce reports whether a call, or one of a batch, is of a
+// non-idempotent method.
+func sendsOnce(method string, in interface{}) bool {
+	calls, ok := in.([]*BatchCall)
+	if !ok || method != BatchMethod {
+		return nonIdempotent[method]
+	}
+	for _, bc := range calls {
+		if nonIdempotent[bc.Method] {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the given attempt.
+func (rp *retryPolicy) delay(attempt int) time.Duration {
+	d := rp.InitialBackoff
+	for i := 2; i < attempt && d < rp.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > rp.MaxBackoff {
+		d = rp.MaxBackoff
+	}
+	if rp.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * rp.Jitter * float64(d))
+	}
+	return d
+}
+
+// withRetries makes a call, retrying it as the policy allows.
+func (c *Client) withRetries(ctx context.Context, method string, in interface{}, call func() error) error {
+	err := call()
+	rp := c.retry
+	if rp == nil || !rp.allowsCall(method, in) {
+		return err
+	}
+	for attempt := 2; attempt <= rp.MaxAttempts && rp.retryable(method, in, err); attempt++ {
+		d := rp.delay(attempt)
+		if rp.OnRetry != nil {
+			rp.OnRetry(RetryAttempt{Method: method, Attempt: attempt, Delay: d, Err: err})
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		err = call()
+	}
+	return err
+}
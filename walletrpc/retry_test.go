@@ -0,0 +1,175 @@
+package walletrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	calls := make(map[string]int)
+	keys := make(map[string]string)
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			calls[method]++
+			switch method {
+			case "getheight":
+				if calls[method] < 3 {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return true
+				}
+				writerpcResponseOK(map[string]uint64{"height": 42}, w)
+			case "getbalance":
+				writerpcResponseError(ErrDaemonIsBusy, "daemon is busy", w)
+			case "getaddress":
+				writerpcResponseError(ErrWrongAddress, "wrong address", w)
+			case "transfer":
+				keys[method] = r.Header.Get(IdempotencyKeyHeader)
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			case "sweep_all":
+				writerpcResponseError(ErrDaemonIsBusy, "daemon is busy", w)
+			default:
+				return false
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+
+	var attempts []RetryAttempt
+	rpccl := New(Config{
+		Address: sv0.URL + "/json_rpc",
+		Retry: &RetryPolicy{
+			MaxAttempts:    4,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+			OnRetry:        func(a RetryAttempt) { attempts = append(attempts, a) },
+		},
+	})
+
+	height, err := rpccl.GetHeight()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), height)
+	assert.Equal(t, 3, calls["getheight"])
+	if assert.Len(t, attempts, 2) {
+		assert.Equal(t, "getheight", attempts[0].Method)
+		assert.Equal(t, 2, attempts[0].Attempt)
+		assert.Equal(t, 3, attempts[1].Attempt)
+		assert.IsType(t, &HTTPStatusError{}, attempts[1].Err)
+	}
+
+	// retryable wallet error, up to MaxAttempts
+	_, _, err = rpccl.GetBalance()
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 4, calls["getbalance"])
+
+	// not retryable
+	_, err = rpccl.GetAddress()
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls["getaddress"])
+
+	// non-idempotent without a key
+	_, err = rpccl.Transfer(TransferRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls["transfer"])
+	assert.Equal(t, "", keys["transfer"])
+
+	// with a key, the wallet may have sent it before the proxy failed
+	_, err = rpccl.Transfer(TransferRequest{IdempotencyKey: "withdrawal-1"})
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls["transfer"])
+	assert.Equal(t, "withdrawal-1", keys["transfer"])
+
+	// but not with a busy daemon
+	_, err = rpccl.SweepAll(SweepAllRequest{IdempotencyKey: "sweep-1"})
+	assert.True(t, errors.Is(err, ErrDaemonIsBusy))
+	assert.Equal(t, 4, calls["sweep_all"])
+
+	// behind a deduplicating proxy
+	rpccl = New(Config{
+		Address: sv0.URL + "/json_rpc",
+		Retry:   &RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, Deduplicated: true},
+	})
+	_, err = rpccl.Transfer(TransferRequest{IdempotencyKey: "withdrawal-2"})
+	assert.Error(t, err)
+	assert.Equal(t, 6, calls["transfer"])
+
+	// nothing was sent
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	attempts = nil
+	rpccl = New(Config{
+		Address: down.URL + "/json_rpc",
+		Retry: &RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			OnRetry:        func(a RetryAttempt) { attempts = append(attempts, a) },
+		},
+	})
+	_, err = rpccl.Transfer(TransferRequest{IdempotencyKey: "withdrawal-3"})
+	assert.IsType(t, &TransportError{}, err)
+	assert.Len(t, attempts, 2)
+
+	// no policy
+	calls = make(map[string]int)
+	rpccl = New(Config{Address: sv0.URL + "/json_rpc"})
+	_, _, err = rpccl.GetBalance()
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls["getbalance"])
+}
+
+func TestRetryDelay(t *testing.T) {
+	rp := newRetryPolicy(&RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         -1,
+	})
+	assert.Equal(t, 100*time.Millisecond, rp.delay(2))
+	assert.Equal(t, 200*time.Millisecond, rp.delay(3))
+	assert.Equal(t, 800*time.Millisecond, rp.delay(5))
+	assert.Equal(t, time.Second, rp.delay(6))
+	assert.Equal(t, time.Second, rp.delay(60))
+
+	rp = newRetryPolicy(&RetryPolicy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5})
+	for i := 0; i < 100; i++ {
+		d := rp.delay(2)
+		assert.True(t, d > 50*time.Millisecond && d <= 100*time.Millisecond, d)
+	}
+
+	assert.True(t, rp.allows("getbalance", ""))
+	assert.False(t, rp.allows("transfer", ""))
+	assert.True(t, rp.allows("transfer", "key"))
+	assert.False(t, rp.allows("store", ""))
+}
+
+func TestRetryContext(t *testing.T) {
+	calls := 0
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			calls++
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return true
+		},
+	})
+	defer sv0.Close()
+	rpccl := New(Config{
+		Address: sv0.URL + "/json_rpc",
+		Retry:   &RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := rpccl.WithContext(ctx).GetHeight()
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, calls)
+
+	_, err = rpccl.WithContext(ctx).GetHeight()
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, 1, calls)
+}
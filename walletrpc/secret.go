@@ -0,0 +1,54 @@
+package walletrpc
+
+import (
+	"fmt"
+	"io"
+)
+
+const redacted = "[redacted]"
+
+// Secret is a password, seed or private key. It's redacted when printed,
+// with any verb of the fmt package, and when marshalled to JSON, so it
+// doesn't end up in logs or errors. Reveal returns the secret itself.
+type Secret string
+
+// Reveal returns the secret.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString redacts %#v.
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Format redacts every verb, %x and %q included.
+func (s Secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
+
+// MarshalJSON redacts the secret, the client sends it to the wallet as
+// is.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// wireSecret is a secret in a request or response: marshalled as is, for
+// the wallet, but still redacted when printed, e.g. by an interceptor.
+type wireSecret string
+
+func (s wireSecret) String() string {
+	return redacted
+}
+
+func (s wireSecret) GoString() string {
+	return redacted
+}
+
+func (s wireSecret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
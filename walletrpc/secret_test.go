@@ -0,0 +1,94 @@
+package walletrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	s := Secret("hunter2")
+	assert.Equal(t, "hunter2", s.Reveal())
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x", "%10s"} {
+		assert.Equal(t, "[redacted]", fmt.Sprintf(format, s), format)
+	}
+	req := GenerateFromKeysRequest{Filename: "w", ViewKey: "viewkey", Password: s}
+	for _, format := range []string{"%v", "%+v", "%#v"} {
+		assert.NotContains(t, fmt.Sprintf(format, req), "hunter2", format)
+		assert.NotContains(t, fmt.Sprintf(format, &req), "viewkey", format)
+	}
+	b, err := json.Marshal(req)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "hunter2")
+	assert.Contains(t, string(b), `"Password":"[redacted]"`)
+	assert.Equal(t, "[redacted]", fmt.Sprint(wireSecret("hunter2")))
+
+	var resp RestoreDeterministicWalletResponse
+	assert.NoError(t, json.Unmarshal([]byte(`{"seed":"abandon"}`), &resp))
+	assert.Equal(t, "abandon", resp.Seed.Reveal())
+}
+
+func TestSecretRequests(t *testing.T) {
+	params := make(map[string]map[string]interface{})
+	sv0 := basicTestServer([]testfn{
+		func(method string, p *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			m := make(map[string]interface{})
+			json.Unmarshal(*p, &m)
+			params[method] = m
+			switch method {
+			case "restore_deterministic_wallet":
+				writerpcResponseOK(map[string]interface{}{
+					"address": "4A",
+					"seed":    "abandon abandon",
+				}, w)
+			case "generate_from_keys":
+				writerpcResponseOK(map[string]string{"address": "4B"}, w)
+			case "query_key":
+				writerpcResponseOK(map[string]string{"key": "abandon abandon"}, w)
+			case "open_wallet":
+				writerpcResponseError(ErrInvalidPassword, "invalid password", w)
+			default:
+				return false
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+	rpccl := New(Config{Address: sv0.URL + "/json_rpc"})
+
+	resp, err := rpccl.RestoreDeterministicWallet(RestoreDeterministicWalletRequest{
+		Filename:      "restored",
+		Password:      "pw",
+		Seed:          "abandon abandon",
+		RestoreHeight: 100,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "4A", resp.Address)
+	assert.Equal(t, Secret("abandon abandon"), resp.Seed)
+	assert.Equal(t, "pw", params["restore_deterministic_wallet"]["password"])
+	assert.Equal(t, "abandon abandon", params["restore_deterministic_wallet"]["seed"])
+	assert.NotContains(t, params["restore_deterministic_wallet"], "seed_offset")
+
+	address, err := rpccl.GenerateFromKeys(GenerateFromKeysRequest{
+		Filename: "viewonly",
+		Address:  "4B",
+		ViewKey:  "vk",
+		Password: "pw",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "4B", address)
+	assert.Equal(t, "vk", params["generate_from_keys"]["viewkey"])
+	assert.NotContains(t, params["generate_from_keys"], "spendkey")
+
+	seed, err := rpccl.QueryKey(QueryKeyMnemonic)
+	assert.NoError(t, err)
+	assert.Equal(t, "abandon abandon", seed.Reveal())
+	assert.Equal(t, "[redacted]", fmt.Sprint(seed))
+
+	err = rpccl.OpenWallet("w", "hunter2")
+	assert.Equal(t, "hunter2", params["open_wallet"]["password"])
+	assert.NotContains(t, fmt.Sprintf("%+v", err), "hunter2")
+}
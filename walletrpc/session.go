@@ -0,0 +1,103 @@
+package walletrpc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+)
+
+// Session owns the wallet open in a monero-wallet-rpc server, which serves
+// a single wallet at a time: OpenWallet from one goroutine would switch the
+// wallet under the calls of another.
+//
+// The calls to the server must all go through the session. WithWallet
+// gives exclusive access to a wallet, and WithWalletRead access shared with
+// the other readers of the same wallet. Switching wallets waits for all of
+// them to return. Calls for the open wallet with another password than the
+// one it was opened with fail with ErrInvalidPassword.
+type Session struct {
+	client *Client
+
+	// mu is held for writing to switch wallets or by WithWallet, and for
+	// reading by WithWalletRead
+	mu      sync.RWMutex
+	current string
+	// digest of the password of the current wallet
+	digest [sha256.Size]byte
+}
+
+// NewSession returns a session for the server of client, which has no
+// wallet open.
+func NewSession(client *Client) *Session {
+	return &Session{client: client}
+}
+
+// WithWallet opens the wallet if it isn't already, and calls fn with
+// exclusive access to it. fn must not open or close wallets itself.
+func (s *Session) WithWallet(name string, password Secret, fn func(*Client) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.open(name, password); err != nil {
+		return err
+	}
+	return fn(s.client)
+}
+
+// WithWalletRead opens the wallet if it isn't already, and calls fn with
+// access shared with the other readers of the wallet. fn must only make
+// read-only calls.
+func (s *Session) WithWalletRead(name string, password Secret, fn func(*Client) error) error {
+	for {
+		s.mu.RLock()
+		if s.current == name {
+			defer s.mu.RUnlock()
+			if err := s.checkPassword(password); err != nil {
+				return err
+			}
+			return fn(s.client)
+		}
+		s.mu.RUnlock()
+
+		// switch, then check another writer didn't switch again before
+		// the read lock is held
+		s.mu.Lock()
+		err := s.open(name, password)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Current returns the name of the wallet open, empty if none.
+func (s *Session) Current() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// open opens the wallet if it isn't the current one, s.mu being held.
+func (s *Session) open(name string, password Secret) error {
+	if s.current == name {
+		return s.checkPassword(password)
+	}
+	// the server closes the current wallet before opening another, even
+	// if it fails to
+	s.current = ""
+	if err := s.client.OpenWallet(name, password); err != nil {
+		return err
+	}
+	s.current = name
+	s.digest = sha256.Sum256([]byte(password.Reveal()))
+	return nil
+}
+
+// checkPassword fails unless password is the one the current wallet was
+// opened with, s.mu being held.
+func (s *Session) checkPassword(password Secret) error {
+	digest := sha256.Sum256([]byte(password.Reveal()))
+	if subtle.ConstantTimeCompare(digest[:], s.digest[:]) != 1 {
+		return &WalletError{Code: ErrInvalidPassword, Message: "invalid password"}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package walletrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	var mu sync.Mutex
+	open := ""
+	opens := 0
+	reading, maxReading := 0, 0
+	balances := map[string]uint64{"alice": 1, "bob": 2}
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			switch method {
+			case "open_wallet":
+				p0 := struct {
+					Filename string `json:"filename"`
+					Password string `json:"password"`
+				}{}
+				json.Unmarshal(*params, &p0)
+				mu.Lock()
+				opens++
+				open = ""
+				if p0.Password == "pw" {
+					open = p0.Filename
+				}
+				opened := open != ""
+				mu.Unlock()
+				if !opened {
+					writerpcResponseError(ErrInvalidPassword, "invalid password", w)
+					return true
+				}
+				writerpcResponseOK(&struct{}{}, w)
+			case "getbalance":
+				mu.Lock()
+				reading++
+				if reading > maxReading {
+					maxReading = reading
+				}
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				reading--
+				balance := balances[open]
+				mu.Unlock()
+				writerpcResponseOK(map[string]uint64{"balance": balance}, w)
+			default:
+				return false
+			}
+			return true
+		},
+	})
+	defer sv0.Close()
+	s := NewSession(New(Config{Address: sv0.URL + "/json_rpc"}))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		name := []string{"alice", "bob"}[i%2]
+		with := s.WithWalletRead
+		if i%4 == 0 {
+			with = s.WithWallet
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- with(name, "pw", func(c *Client) error {
+				balance, _, err := c.GetBalance()
+				if err == nil && balance != balances[name] {
+					err = fmt.Errorf("%v got the balance of another wallet", name)
+				}
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.True(t, maxReading > 1, "readers share the wallet")
+	assert.True(t, opens <= 40)
+
+	err := s.WithWallet("carol", "wrong", func(*Client) error {
+		t.Error("called without the wallet open")
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "", s.Current())
+
+	opens = 0
+	assert.NoError(t, s.WithWallet("bob", "pw", func(*Client) error { return nil }))
+	assert.NoError(t, s.WithWalletRead("bob", "pw", func(*Client) error { return nil }))
+	assert.Equal(t, 1, opens)
+	assert.Equal(t, "bob", s.Current())
+
+	// the open wallet isn't given away without its password
+	for _, with := range []func(string, Secret, func(*Client) error) error{s.WithWallet, s.WithWalletRead} {
+		err = with("bob", "wrong", func(*Client) error {
+			t.Error("called with a wrong password")
+			return nil
+		})
+		assert.True(t, errors.Is(err, ErrInvalidPassword))
+	}
+	assert.Equal(t, 1, opens)
+	assert.Equal(t, "bob", s.Current())
+}
@@ -13,7 +13,10 @@ type TransferRequest struct {
 	// Fee - unsigned int; Ignored, will be automatically calculated.
 	Fee uint64 `json:"fee,omitempty"`
 	// Mixin - unsigned int; Number of outpouts from the blockchain to mix with (0 means no mixing).
-	Mixin uint64 `json:"mixin"`
+	//
+	// Deprecated: use RingSize. Mixin is only sent to legacy wallets, which
+	// get RingSize - 1 when it's zero.
+	Mixin uint64 `json:"mixin,omitempty"`
 	// unlock_time - unsigned int; Number of blocks before the monero can be spent (0 to not add a lock).
 	UnlockTime uint64 `json:"unlock_time"`
 	// priority - unsigned int; Set a priority for the transaction.
@@ -25,6 +28,18 @@ type TransferRequest struct {
 	DoNotRelay bool `json:"do_not_relay,omitempty"`
 	// get_tx_hex - boolean; Return the transaction as hex string after sending
 	GetTxHex bool `json:"get_tx_hex,omitempty"`
+	// get_tx_metadata - boolean; Return the metadata needed to relay the transaction with Client.RelayTx.
+	GetTxMetadata bool `json:"get_tx_metadata,omitempty"`
+	// subaddr_indices - array of unsigned int; (Optional) Transfer from this set of subaddresses.
+	SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
+	// subtract_fee_from_outputs - array of unsigned int; (Optional) Choose which destinations to fund the tx fee from instead of the change output.
+	// The fee is subtracted evenly from the destinations at these indexes.
+	SubtractFeeFromOutputs []uint64 `json:"subtract_fee_from_outputs,omitempty"`
+	// IdempotencyKey (optional) identifies the transfer across retries. It's
+	// sent as the Idempotency-Key header, which monero-wallet-rpc ignores, for
+	// a proxy deduplicating calls, and allows the client's RetryPolicy to
+	// retry the call (see RetryPolicy.Deduplicated). Not sent in the body.
+	IdempotencyKey string `json:"-"`
 }
 
 // Destination to receive XMR
@@ -45,6 +60,23 @@ type TransferResponse struct {
 	TxKey string `json:"tx_key,omitempty"`
 	// tx_blob - Transaction as hex string if get_tx_hex is true
 	TxBlob string `json:"tx_blob,omitempty"`
+	// tx_metadata - Set of transaction metadata needed to relay this transfer later, if get_tx_metadata is true.
+	TxMetadata string `json:"tx_metadata,omitempty"`
+	// amount - Amount transferred for the transaction.
+	Amount uint64 `json:"amount"`
+	// weight - The transaction weight.
+	Weight uint64 `json:"weight"`
+	// multisig_txset - The set of signing keys used in a multisig transaction (empty for non-multisig).
+	MultisigTxset string `json:"multisig_txset,omitempty"`
+	// unsigned_txset - The unsigned transaction, for a view-only wallet.
+	UnsignedTxset string `json:"unsigned_txset,omitempty"`
+	// spent_key_images - The key images spent by the transaction.
+	SpentKeyImages KeyImageList `json:"spent_key_images"`
+}
+
+// KeyImageList is a list of key images.
+type KeyImageList struct {
+	KeyImages []string `json:"key_images"`
 }
 
 // TransferSplitResponse is the successful output of a Client.TransferSplit()
@@ -59,18 +91,40 @@ type TransferSplitResponse struct {
 	AmountList []uint64 `json:"amount_list"`
 	// tx_key_list - array of: string. The transaction keys for every transaction.
 	TxKeyList []string `json:"tx_key_list"`
+	// weight_list - array of: integer. The weight of every transaction.
+	WeightList []uint64 `json:"weight_list"`
+	// tx_metadata_list - array of: string. The metadata of every transaction, if get_tx_metadata is true.
+	TxMetadataList []string `json:"tx_metadata_list,omitempty"`
+	// multisig_txset - The set of signing keys used in a multisig transaction (empty for non-multisig).
+	MultisigTxset string `json:"multisig_txset,omitempty"`
+	// unsigned_txset - The unsigned transactions, for a view-only wallet.
+	UnsignedTxset string `json:"unsigned_txset,omitempty"`
+	// spent_key_images_list - The key images spent by every transaction.
+	SpentKeyImagesList []KeyImageList `json:"spent_key_images_list"`
 }
 
 // SweepAllRequest is the struct to send all unlocked balance to an address.
 type SweepAllRequest struct {
 	// address - string; Destination public address.
 	Address string `json:"address"`
+	// account_index - unsigned int; Sweep transactions from this account.
+	AccountIndex uint64 `json:"account_index"`
+	// subaddr_indices - array of unsigned int; (Optional) Sweep from this set of subaddresses in the account.
+	SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
+	// subaddr_indices_all - boolean; (Optional) Sweep from all the subaddresses in the account.
+	SubaddrIndicesAll bool `json:"subaddr_indices_all,omitempty"`
+	// ring_size - unsigned int; Sets ringsize to n (mixin + 1).
+	RingSize uint64 `json:"ring_size,omitempty"`
+	// outputs - unsigned int; (Optional) Number of outputs to split the sweep in.
+	Outputs uint64 `json:"outputs,omitempty"`
 	// payment_id - string; (Optional) Random 32-byte/64-character hex string to identify a transaction.
 	PaymentID string `json:"payment_id,omitempty"`
 	// priority - unsigned int; (Optional)
 	Priority Priority `json:"priority,omitempty"`
 	// mixin - unsigned int; Number of outpouts from the blockchain to mix with (0 means no mixing).
-	Mixin uint64 `json:"mixin"`
+	//
+	// Deprecated: use RingSize, see TransferRequest.Mixin.
+	Mixin uint64 `json:"mixin,omitempty"`
 	// unlock_time - unsigned int; Number of blocks before the monero can be spent (0 to not add a lock).
 	UnlockTime uint64 `json:"unlock_time"`
 	// below_amount - unsigned int; (Optional)
@@ -81,6 +135,10 @@ type SweepAllRequest struct {
 	DoNotRelay bool `json:"do_not_relay,omitempty"`
 	// get_tx_hex - boolean; (Optional) return the transactions as hex encoded string.
 	GetTxHex bool `json:"get_tx_hex,omitempty"`
+	// get_tx_metadata - boolean; (Optional) return the metadata needed to relay the transactions with Client.RelayTx.
+	GetTxMetadata bool `json:"get_tx_metadata,omitempty"`
+	// IdempotencyKey (optional), see TransferRequest.IdempotencyKey.
+	IdempotencyKey string `json:"-"`
 }
 
 // SweepAllResponse is a tipical response of a SweepAllRequest
@@ -91,6 +149,73 @@ type SweepAllResponse struct {
 	TxBlobList []string `json:"tx_blob_list"`
 	// tx_key_list - array of: string. The transaction keys for every transaction.
 	TxKeyList []string `json:"tx_key_list"`
+	// amount_list - array of: integer. The amount transferred for every transaction.
+	AmountList []uint64 `json:"amount_list"`
+	// fee_list - array of: integer. The amount of fees paid for every transaction.
+	FeeList []uint64 `json:"fee_list"`
+	// tx_metadata_list - array of: string. The metadata of every transaction, if get_tx_metadata is true.
+	TxMetadataList []string `json:"tx_metadata_list,omitempty"`
+	// weight_list - array of: integer. The weight of every transaction.
+	WeightList []uint64 `json:"weight_list"`
+	// multisig_txset - The set of signing keys used in a multisig transaction (empty for non-multisig).
+	MultisigTxset string `json:"multisig_txset,omitempty"`
+	// unsigned_txset - The unsigned transactions, for a view-only wallet.
+	UnsignedTxset string `json:"unsigned_txset,omitempty"`
+	// spent_key_images_list - The key images spent by every transaction.
+	SpentKeyImagesList []KeyImageList `json:"spent_key_images_list"`
+}
+
+// SweepSingleRequest is the struct to send a single output, by key image,
+// to an address.
+type SweepSingleRequest struct {
+	// address - string; Destination public address.
+	Address string `json:"address"`
+	// key_image - string; Key image of the output to spend.
+	KeyImage string `json:"key_image"`
+	// priority - unsigned int; (Optional)
+	Priority Priority `json:"priority,omitempty"`
+	// ring_size - unsigned int; Sets ringsize to n (mixin + 1).
+	RingSize uint64 `json:"ring_size,omitempty"`
+	// outputs - unsigned int; (Optional) Number of outputs to split the sweep in.
+	Outputs uint64 `json:"outputs,omitempty"`
+	// unlock_time - unsigned int; Number of blocks before the monero can be spent (0 to not add a lock).
+	UnlockTime uint64 `json:"unlock_time"`
+	// payment_id - string; (Optional) Random 32-byte/64-character hex string to identify a transaction.
+	PaymentID string `json:"payment_id,omitempty"`
+	// get_tx_key - boolean; (Optional) Return the transaction key after sending.
+	GetTxKey bool `json:"get_tx_key,omitempty"`
+	// do_not_relay - boolean; (Optional)
+	DoNotRelay bool `json:"do_not_relay,omitempty"`
+	// get_tx_hex - boolean; (Optional) return the transaction as hex encoded string.
+	GetTxHex bool `json:"get_tx_hex,omitempty"`
+	// get_tx_metadata - boolean; (Optional) return the metadata needed to relay the transaction with Client.RelayTx.
+	GetTxMetadata bool `json:"get_tx_metadata,omitempty"`
+	// IdempotencyKey (optional), see TransferRequest.IdempotencyKey.
+	IdempotencyKey string `json:"-"`
+}
+
+// SweepSingleResponse is the successful output of a Client.SweepSingle()
+type SweepSingleResponse struct {
+	// tx_hash - string; The tx hash of the transaction.
+	TxHash string `json:"tx_hash"`
+	// tx_key - string; The transaction key if get_tx_key is true.
+	TxKey string `json:"tx_key,omitempty"`
+	// amount - unsigned int; The amount transferred, fee excluded.
+	Amount uint64 `json:"amount"`
+	// fee - unsigned int; The fee paid.
+	Fee uint64 `json:"fee"`
+	// tx_blob - string; The transaction as hex string if get_tx_hex is true.
+	TxBlob string `json:"tx_blob,omitempty"`
+	// tx_metadata - string; The metadata of the transaction if get_tx_metadata is true.
+	TxMetadata string `json:"tx_metadata,omitempty"`
+	// weight - unsigned int; The transaction weight.
+	Weight uint64 `json:"weight"`
+	// multisig_txset - The set of signing keys used in a multisig transaction (empty for non-multisig).
+	MultisigTxset string `json:"multisig_txset,omitempty"`
+	// unsigned_txset - The unsigned transaction, for a view-only wallet.
+	UnsignedTxset string `json:"unsigned_txset,omitempty"`
+	// spent_key_images - The key images spent by the transaction.
+	SpentKeyImages KeyImageList `json:"spent_key_images"`
 }
 
 // Payment ...
@@ -112,6 +237,12 @@ type GetTransfersRequest struct {
 	FilterByHeight bool   `json:"filter_by_height"`
 	MinHeight      uint64 `json:"min_height"`
 	MaxHeight      uint64 `json:"max_height"`
+	// AccountIndex - (Optional) return transfers for this account
+	AccountIndex uint64 `json:"account_index"`
+	// SubaddrIndices - (Optional) only return transfers for these subaddresses
+	SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
+	// AllAccounts - (Optional) return transfers for all the accounts, ignoring AccountIndex
+	AllAccounts bool `json:"all_accounts,omitempty"`
 }
 
 // GetTransfersResponse = GetTransfers output
@@ -136,9 +267,30 @@ type Transfer struct {
 	Type          string        `json:"type"`
 	Address       string        `json:"address"`
 	Confirmations uint64        `json:"confirmations"`
+	UnlockTime    uint64        `json:"unlock_time"`
+	// SubaddrIndex is the account (major) and subaddress (minor) index
+	// the transfer was received by or sent from.
+	SubaddrIndex SubaddressIndex `json:"subaddr_index"`
+}
+
+// SubaddressIndex is the position of a subaddress in the wallet.
+type SubaddressIndex struct {
+	// Major is the account index
+	Major uint64 `json:"major"`
+	// Minor is the subaddress index inside the account
+	Minor uint64 `json:"minor"`
+}
+
+// IncomingTransfersRequest = GetIncomingTransfers input
+type IncomingTransfersRequest struct {
+	TransferType GetTransferType `json:"transfer_type"`
+	// AccountIndex - (Optional) return transfers for this account, defaults to 0
+	AccountIndex uint64 `json:"account_index"`
+	// SubaddrIndices - (Optional) only return transfers for these subaddresses
+	SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
 }
 
-// IncTransfer is returned by IncomingTransfers
+// IncTransfer is returned by IncomingTransfers and GetIncomingTransfers
 type IncTransfer struct {
 	Amount uint64 `json:"amount"`
 	Spent  bool   `json:"spent"`
@@ -148,6 +300,17 @@ type IncTransfer struct {
 	// if they were in the same transaction.
 	TxHash string `json:"tx_hash"`
 	TxSize uint64 `json:"tx_size"`
+	// KeyImage of the output, used to spend or freeze it.
+	KeyImage string `json:"key_image,omitempty"`
+	// SubaddrIndex is the account (major) and subaddress (minor) index
+	// the output was received by.
+	SubaddrIndex SubaddressIndex `json:"subaddr_index"`
+	// Frozen - whether the output is excluded from spending, see Client.Freeze.
+	Frozen bool `json:"frozen"`
+	// BlockHeight of the transaction.
+	BlockHeight uint64 `json:"block_height"`
+	// Unlocked - whether the output can be spent. Not set by wallets older than v0.15.
+	Unlocked bool `json:"unlocked"`
 }
 
 // URIDef is the skeleton of the MakeURI()
@@ -186,3 +349,90 @@ type AddressBookEntry struct {
 	Index       uint64 `json:"index,omitempty"`
 	PaymentID   string `json:"payment_id,omitempty"`
 }
+
+// RestoreDeterministicWalletRequest is the request of
+// Client.RestoreDeterministicWallet, restoring a wallet from its mnemonic
+// seed.
+type RestoreDeterministicWalletRequest struct {
+	// filename - string; Name of the wallet.
+	Filename string
+	// password - string; Password of the wallet.
+	Password Secret
+	// seed - string; Mnemonic phrase of the wallet to restore.
+	Seed Secret
+	// seed_offset - string; (Optional) Offset used to derive a new seed from the given mnemonic.
+	SeedOffset Secret
+	// restore_height - unsigned int; (Optional) Height to start scanning the blockchain from.
+	RestoreHeight uint64
+	// language - string; Language of the mnemonic phrase, in case the old language is invalid.
+	Language string
+	// autosave_current - boolean; (Optional) Save the current wallet before opening the new one.
+	AutosaveCurrent bool
+}
+
+// RestoreDeterministicWalletResponse is the response of
+// Client.RestoreDeterministicWallet.
+type RestoreDeterministicWalletResponse struct {
+	// address - string; Primary address of the wallet.
+	Address string `json:"address"`
+	// info - string; Message about the restoration.
+	Info string `json:"info"`
+	// seed - string; Mnemonic phrase of the wallet, in the new language if it was deprecated.
+	Seed Secret `json:"seed"`
+	// was_deprecated - boolean; Whether the seed was in a deprecated language.
+	WasDeprecated bool `json:"was_deprecated"`
+}
+
+// GenerateFromKeysRequest is the request of Client.GenerateFromKeys,
+// restoring a wallet from its keys.
+type GenerateFromKeysRequest struct {
+	// filename - string; Name of the wallet.
+	Filename string
+	// address - string; Primary address of the wallet.
+	Address string
+	// spendkey - string; (Optional) Private spend key, omitted for a view-only wallet.
+	SpendKey Secret
+	// viewkey - string; Private view key.
+	ViewKey Secret
+	// password - string; Password of the wallet.
+	Password Secret
+	// restore_height - unsigned int; (Optional) Height to start scanning the blockchain from.
+	RestoreHeight uint64
+	// autosave_current - boolean; (Optional) Save the current wallet before opening the new one.
+	AutosaveCurrent bool
+}
+
+// GetAccountsResponse is the response of Client.GetAccounts.
+type GetAccountsResponse struct {
+	// subaddress_accounts - array of accounts.
+	SubaddressAccounts []Account `json:"subaddress_accounts"`
+	// total_balance - unsigned int; Total balance of the selected accounts (locked or unlocked).
+	TotalBalance uint64 `json:"total_balance"`
+	// total_unlocked_balance - unsigned int; Total unlocked balance of the selected accounts.
+	TotalUnlockedBalance uint64 `json:"total_unlocked_balance"`
+}
+
+// Account is an account of the wallet, with its balance.
+type Account struct {
+	AccountIndex    uint64 `json:"account_index"`
+	BaseAddress     string `json:"base_address"`
+	Balance         uint64 `json:"balance"`
+	UnlockedBalance uint64 `json:"unlocked_balance"`
+	Label           string `json:"label"`
+	Tag             string `json:"tag"`
+}
+
+// SetDaemonRequest is the request of Client.SetDaemon, switching the
+// daemon the wallet connects to.
+type SetDaemonRequest struct {
+	// address - string; (Optional) host:port of the daemon, empty to disconnect.
+	Address string
+	// trusted - boolean; (Optional) Whether the daemon is trusted.
+	Trusted bool
+	// ssl_support - string; (Optional) "autodetect", "enabled" or "disabled".
+	SSLSupport string
+	// username - string; (Optional) RPC login of the daemon.
+	Username string
+	// password - string; (Optional) RPC password of the daemon.
+	Password Secret
+}
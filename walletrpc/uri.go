@@ -0,0 +1,295 @@
+package walletrpc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URIScheme is the scheme of monero payment URIs.
+const URIScheme = "monero"
+
+// URIRecipient is a single payee of a monero: URI.
+type URIRecipient struct {
+	// Address - wallet address string
+	Address string
+	// Amount (optional) - the amount to receive, in atomic units
+	Amount uint64
+	// RecipientName (optional) - name of the payment recipient
+	RecipientName string
+}
+
+// PaymentURI is a monero: URI that may carry several recipients,
+// e.g. monero:addr1;addr2?tx_amount=1;2&recipient_name=a;b
+// A PaymentURI with a single recipient is equivalent to a URIDef.
+type PaymentURI struct {
+	Recipients []URIRecipient
+	// PaymentID (optional) - 16 or 64 character hexadecimal payment id string
+	PaymentID string
+	// TxDescription (optional) - string describing the reason for the tx
+	TxDescription string
+	// UnknownParameters holds the parameters (as "key=value") that
+	// ParsePaymentURI did not recognise. They are ignored by Encode.
+	UnknownParameters []string
+}
+
+// EncodeURI builds a monero: URI locally, without the round trip of
+// Client.MakeURI. Amounts are written without trailing zeros, which keeps
+// the URI short but is otherwise understood by every wallet.
+func EncodeURI(def URIDef) (string, error) {
+	return NewPaymentURI(def).Encode()
+}
+
+// DecodeURI parses a monero: URI locally, the equivalent of Client.ParseURI.
+// It fails if the URI has more than one recipient. Parameters that aren't
+// part of the scheme are returned in unknown.
+func DecodeURI(uri string) (parsed *URIDef, unknown []string, err error) {
+	p, err := ParsePaymentURI(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	def, err := p.URIDef()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &def, p.UnknownParameters, nil
+}
+
+// NewPaymentURI converts a URIDef into a single recipient PaymentURI.
+func NewPaymentURI(def URIDef) PaymentURI {
+	return PaymentURI{
+		Recipients: []URIRecipient{
+			{
+				Address:       def.Address,
+				Amount:        def.Amount,
+				RecipientName: def.RecipientName,
+			},
+		},
+		PaymentID:     def.PaymentID,
+		TxDescription: def.TxDescription,
+	}
+}
+
+// URIDef converts a single recipient PaymentURI into a URIDef.
+func (p PaymentURI) URIDef() (URIDef, error) {
+	if len(p.Recipients) != 1 {
+		return URIDef{}, uriError("expected a single recipient, got %v", len(p.Recipients))
+	}
+	r := p.Recipients[0]
+	return URIDef{
+		Address:       r.Address,
+		Amount:        r.Amount,
+		PaymentID:     p.PaymentID,
+		RecipientName: r.RecipientName,
+		TxDescription: p.TxDescription,
+	}, nil
+}
+
+// Encode validates the payment request and returns its monero: URI.
+func (p PaymentURI) Encode() (string, error) {
+	if err := p.validate(); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(URIScheme)
+	sb.WriteByte(':')
+	var hasAmount, hasName bool
+	for i, r := range p.Recipients {
+		if i > 0 {
+			sb.WriteByte(';')
+		}
+		sb.WriteString(r.Address)
+		hasAmount = hasAmount || r.Amount > 0
+		hasName = hasName || r.RecipientName != ""
+	}
+
+	sep := byte('?')
+	param := func(key string, values []string) {
+		sb.WriteByte(sep)
+		sep = '&'
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(strings.Join(values, ";"))
+	}
+	if p.PaymentID != "" {
+		param("tx_payment_id", []string{p.PaymentID})
+	}
+	if hasAmount {
+		amounts := make([]string, len(p.Recipients))
+		for i, r := range p.Recipients {
+			if r.Amount > 0 {
+				amounts[i] = trimDecimal(XMRToDecimal(r.Amount))
+			}
+		}
+		param("tx_amount", amounts)
+	}
+	if hasName {
+		names := make([]string, len(p.Recipients))
+		for i, r := range p.Recipients {
+			names[i] = uriEscape(r.RecipientName)
+		}
+		param("recipient_name", names)
+	}
+	if p.TxDescription != "" {
+		param("tx_description", []string{uriEscape(p.TxDescription)})
+	}
+	return sb.String(), nil
+}
+
+// ParsePaymentURI parses and validates a monero: URI locally.
+func ParsePaymentURI(uri string) (*PaymentURI, error) {
+	if len(uri) <= len(URIScheme) || !strings.EqualFold(uri[:len(URIScheme)+1], URIScheme+":") {
+		return nil, uriError("URI has wrong scheme (expected %q): %v", URIScheme+":", uri)
+	}
+	rest := uri[len(URIScheme)+1:]
+	query := ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+	if rest == "" {
+		return nil, uriError("URI has no address")
+	}
+
+	p := &PaymentURI{}
+	for _, addr := range strings.Split(rest, ";") {
+		p.Recipients = append(p.Recipients, URIRecipient{Address: addr})
+	}
+
+	seen := make(map[string]bool)
+	for _, kv := range strings.Split(query, "&") {
+		if kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return nil, uriError("bad parameter: %v", kv)
+		}
+		key, value := kv[:i], kv[i+1:]
+		switch key {
+		case "tx_amount", "tx_payment_id", "recipient_name", "tx_description":
+		default:
+			p.UnknownParameters = append(p.UnknownParameters, kv)
+			continue
+		}
+		if seen[key] {
+			return nil, uriError("duplicate parameter: %v", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "tx_amount":
+			values, err := p.splitValues(key, value)
+			if err != nil {
+				return nil, err
+			}
+			for i, v := range values {
+				if v == "" {
+					continue
+				}
+				amount, err := DecimalToXMR(v)
+				if err != nil {
+					return nil, uriError("%v", err)
+				}
+				p.Recipients[i].Amount = amount
+			}
+		case "recipient_name":
+			values, err := p.splitValues(key, value)
+			if err != nil {
+				return nil, err
+			}
+			for i, v := range values {
+				name, err := url.PathUnescape(v)
+				if err != nil {
+					return nil, uriError("bad recipient_name: %v", err)
+				}
+				p.Recipients[i].RecipientName = name
+			}
+		case "tx_payment_id":
+			p.PaymentID = value
+		case "tx_description":
+			desc, err := url.PathUnescape(value)
+			if err != nil {
+				return nil, uriError("bad tx_description: %v", err)
+			}
+			p.TxDescription = desc
+		}
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PaymentURI) splitValues(key, value string) ([]string, error) {
+	values := strings.Split(value, ";")
+	if len(values) != len(p.Recipients) {
+		return nil, uriError("%v has %v values for %v recipients", key, len(values), len(p.Recipients))
+	}
+	return values, nil
+}
+
+func (p PaymentURI) validate() error {
+	if len(p.Recipients) == 0 {
+		return uriError("URI has no address")
+	}
+	integrated := false
+	for _, r := range p.Recipients {
+		a, err := DecodeAddress(r.Address)
+		if err != nil {
+			return uriError("wrong address %v: %v", r.Address, err)
+		}
+		integrated = integrated || a.Type == AddressIntegrated
+	}
+	if p.PaymentID != "" {
+		if integrated {
+			return uriError("a payment id can't be used with an integrated address")
+		}
+		if !isPaymentID(p.PaymentID) {
+			return uriError("invalid payment id: %v", p.PaymentID)
+		}
+	}
+	return nil
+}
+
+func isPaymentID(pid string) bool {
+	if len(pid) != 16 && len(pid) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(pid)
+	return err == nil
+}
+
+// trimDecimal drops the trailing zeros of an XMRToDecimal string.
+func trimDecimal(s string) string {
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// uriEscape percent-encodes everything but RFC 3986 unreserved characters,
+// so that '&', '=' and ';' inside names can't break the parameter list.
+func uriEscape(s string) string {
+	const hexdigits = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hexdigits[c>>4])
+		sb.WriteByte(hexdigits[c&15])
+	}
+	return sb.String()
+}
+
+func uriError(format string, args ...interface{}) error {
+	return &WalletError{
+		Code:    ErrWrongURI,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,81 @@
+package walletrpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeURI(t *testing.T) {
+	uri, err := EncodeURI(URIDef{
+		Address:       testAddress,
+		Amount:        10000000000,
+		PaymentID:     "0123456789abcdef",
+		RecipientName: "Joe & Co",
+		TxDescription: "order #42",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "monero:"+testAddress+"?tx_payment_id=0123456789abcdef&tx_amount=0.01&recipient_name=Joe%20%26%20Co&tx_description=order%20%2342", uri)
+
+	_, err = EncodeURI(URIDef{Address: "bogus"})
+	iswerr, werr := GetWalletError(err)
+	assert.True(t, iswerr)
+	assert.Equal(t, ErrWrongURI, werr.Code)
+
+	_, err = EncodeURI(URIDef{Address: testAddress, PaymentID: "xyz"})
+	assert.Error(t, err)
+}
+
+func TestDecodeURI(t *testing.T) {
+	def := URIDef{
+		Address:       testAddress,
+		Amount:        1500000000000,
+		PaymentID:     "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		RecipientName: "a;b=c",
+		TxDescription: "50% off",
+	}
+	uri, err := EncodeURI(def)
+	assert.NoError(t, err)
+	parsed, unknown, err := DecodeURI(uri + "&foo=bar")
+	assert.NoError(t, err)
+	assert.Equal(t, def, *parsed)
+	assert.Equal(t, []string{"foo=bar"}, unknown)
+
+	// the zero padded amounts of monero-wallet-rpc make_uri
+	parsed, _, err = DecodeURI("monero:" + testAddress + "?tx_amount=0.010000000000")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10000000000), parsed.Amount)
+
+	for _, bad := range []string{
+		"bitcoin:" + testAddress,
+		"monero:",
+		"monero:" + testAddress + "?tx_amount=1&tx_amount=2",
+		"monero:" + testAddress + "?tx_amount=abc",
+		"monero:" + testAddress + "?tx_amount=0.0000000000001",
+		"monero:" + testAddress + "?novalue",
+		"monero:" + testAddress + ";" + testAddress,
+	} {
+		_, _, err := DecodeURI(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPaymentURIMultipleRecipients(t *testing.T) {
+	p := PaymentURI{
+		Recipients: []URIRecipient{
+			{Address: testAddress, Amount: 1e12, RecipientName: "one"},
+			{Address: testAddress},
+		},
+		TxDescription: "split",
+	}
+	uri, err := p.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, "monero:"+testAddress+";"+testAddress+"?tx_amount=1;&recipient_name=one;&tx_description=split", uri)
+
+	parsed, err := ParsePaymentURI(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, p, *parsed)
+
+	_, err = ParsePaymentURI("monero:" + testAddress + ";" + testAddress + "?tx_amount=1")
+	assert.Error(t, err)
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // NewPaymentID64 generates a 64 bit payment ID (hex encoded).
@@ -44,3 +46,29 @@ func XMRToDecimal(xmr uint64) string {
 func XMRToFloat64(xmr uint64) float64 {
 	return float64(xmr) / 1e12
 }
+
+// DecimalToXMR parses a human readable XMR amount (e.g. "0.01") into
+// atomic units. It is the inverse of XMRToDecimal.
+func DecimalToXMR(s string) (uint64, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], strings.TrimRight(s[i+1:], "0")
+	}
+	if s == "" || s == "." {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > 12 {
+		return 0, fmt.Errorf("invalid amount %q: too many decimal places", s)
+	}
+	digits := whole + frac + strings.Repeat("0", 12-len(frac))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	v, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %v", s, err)
+	}
+	return v, nil
+}
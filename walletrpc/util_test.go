@@ -15,3 +15,21 @@ func TestXMRToFloat64(t *testing.T) {
 	assert.Equal(t, float64(0.02), XMRToFloat64(20000000000))
 	assert.Equal(t, float64(3.14), XMRToFloat64(314e10))
 }
+
+func TestDecimalToXMR(t *testing.T) {
+	for in, want := range map[string]uint64{
+		"0.034000200000": 34000200000,
+		"15":             15e12,
+		"15.":            15e12,
+		".5":             5e11,
+		"1.000000000001": 1000000000001,
+	} {
+		v, err := DecimalToXMR(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, v, in)
+	}
+	for _, bad := range []string{"", ".", "-1", "1e3", "1.2.3", "99999999999999"} {
+		_, err := DecimalToXMR(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,104 @@
+package walletrpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Version is the version of the monero-wallet-rpc API (WALLET_RPC_VERSION),
+// which changes with the parameters it accepts.
+type Version struct {
+	Major uint32
+	Minor uint32
+	// Release is false for wallets built from a development branch.
+	Release bool
+}
+
+// Wallet RPC versions of the transfer API changes.
+var (
+	// VersionLegacy is assumed for wallets without get_version (older
+	// than v0.12), which may still expect mixin instead of ring_size.
+	VersionLegacy = Version{Major: 0, Minor: 0}
+	// VersionSubtractFee added subtract_fee_from_outputs (v0.18.2).
+	VersionSubtractFee = Version{Major: 1, Minor: 26}
+)
+
+// AtLeast reports whether v is the same as or newer than o.
+func (v Version) AtLeast(o Version) bool {
+	return v.Major > o.Major || v.Major == o.Major && v.Minor >= o.Minor
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%v.%v", v.Major, v.Minor)
+}
+
+func (c *Client) GetVersion() (Version, error) {
+	jd := struct {
+		Version uint32 `json:"version"`
+		Release bool   `json:"release"`
+	}{}
+	err := c.do("get_version", nil, &jd)
+	return Version{
+		Major:   jd.Version >> 16,
+		Minor:   jd.Version & 0xffff,
+		Release: jd.Release,
+	}, err
+}
+
+// walletVersion returns the version of the wallet, asking for it with
+// get_version on the first call only.
+func (c *Client) walletVersion() (Version, error) {
+	c.capsMu.Lock()
+	cached := c.version
+	c.capsMu.Unlock()
+	if cached != nil {
+		return *cached, nil
+	}
+	v, err := c.GetVersion()
+	if err != nil {
+		if iswerr, _ := GetWalletError(err); !iswerr && !errors.Is(err, ErrUnsupported) {
+			return Version{}, err
+		}
+		// no get_version
+		v = VersionLegacy
+	}
+	c.capsMu.Lock()
+	c.version = &v
+	c.capsMu.Unlock()
+	return v, nil
+}
+
+// adaptTransfer fits a transfer request to the version of the wallet.
+func (c *Client) adaptTransfer(req *TransferRequest) error {
+	v, err := c.walletVersion()
+	if err != nil {
+		return err
+	}
+	if len(req.SubtractFeeFromOutputs) > 0 && !v.AtLeast(VersionSubtractFee) {
+		return &UnsupportedError{Field: "subtract_fee_from_outputs", Version: v}
+	}
+	req.Mixin = legacyMixin(v, req.Mixin, req.RingSize)
+	return nil
+}
+
+// adaptSweepAll fits a sweep_all request to the version of the wallet.
+func (c *Client) adaptSweepAll(req *SweepAllRequest) error {
+	v, err := c.walletVersion()
+	if err != nil {
+		return err
+	}
+	req.Mixin = legacyMixin(v, req.Mixin, req.RingSize)
+	return nil
+}
+
+// legacyMixin returns the mixin to send: none to current wallets, which
+// ignore it, and one matching the ring size to legacy ones.
+func legacyMixin(v Version, mixin, ringSize uint64) uint64 {
+	if v.AtLeast(Version{Major: 1}) {
+		return 0
+	}
+	if mixin == 0 && ringSize > 0 {
+		return ringSize - 1
+	}
+	return mixin
+}
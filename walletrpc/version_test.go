@@ -0,0 +1,82 @@
+package walletrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferVersionSwitch(t *testing.T) {
+	var version uint32
+	var sent map[string]interface{}
+	versionCalls := 0
+	sv0 := basicTestServer([]testfn{
+		func(method string, params *json.RawMessage, w http.ResponseWriter, r *http.Request) bool {
+			switch method {
+			case "get_version":
+				versionCalls++
+				if version == 0 {
+					// legacy wallets don't know the method
+					return false
+				}
+				r0 := struct {
+					Version uint32 `json:"version"`
+				}{version}
+				writerpcResponseOK(&r0, w)
+				return true
+			case "transfer":
+				sent = nil
+				json.Unmarshal(*params, &sent)
+				r0 := TransferResponse{
+					TxHash:         "aa",
+					Weight:         1500,
+					SpentKeyImages: KeyImageList{KeyImages: []string{"k1"}},
+				}
+				writerpcResponseOK(&r0, w)
+				return true
+			}
+			return false
+		},
+	})
+	defer sv0.Close()
+
+	req := TransferRequest{
+		RingSize:     16,
+		Destinations: []Destination{{Amount: 1, Address: "addr"}},
+	}
+
+	// legacy: mixin matches the ring size
+	rpccl := New(Config{Address: sv0.URL + "/json_rpc"})
+	resp, err := rpccl.Transfer(req)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(15), sent["mixin"])
+	assert.Equal(t, float64(16), sent["ring_size"])
+	assert.Equal(t, uint64(1500), resp.Weight)
+	assert.Equal(t, []string{"k1"}, resp.SpentKeyImages.KeyImages)
+	req.SubtractFeeFromOutputs = []uint64{0}
+	_, err = rpccl.Transfer(req)
+	assert.Error(t, err)
+	assert.Equal(t, 1, versionCalls)
+
+	// current: no mixin
+	version = 1<<16 | 26
+	rpccl = New(Config{Address: sv0.URL + "/json_rpc"})
+	req.Mixin = 7
+	_, err = rpccl.Transfer(req)
+	assert.NoError(t, err)
+	_, ok := sent["mixin"]
+	assert.False(t, ok)
+	assert.Equal(t, []interface{}{float64(0)}, sent["subtract_fee_from_outputs"])
+
+	// before subtract_fee_from_outputs
+	version = 1<<16 | 25
+	rpccl = New(Config{Address: sv0.URL + "/json_rpc"})
+	_, err = rpccl.Transfer(req)
+	assert.Error(t, err)
+	v, err := rpccl.GetVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.25", v.String())
+	assert.False(t, v.AtLeast(VersionSubtractFee))
+}
@@ -0,0 +1,805 @@
+package walletrpctest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// version is the wallet rpc version of the server, v0.18.2.
+var version = walletrpc.VersionSubtractFee
+
+type method struct {
+	fn          func(s *Server, params json.RawMessage) (interface{}, error)
+	needsWallet bool
+}
+
+// methods are the methods simulated, called with net.mu held.
+var methods = map[string]method{
+	"create_wallet":            {(*Server).createWallet, false},
+	"open_wallet":              {(*Server).openWallet, false},
+	"close_wallet":             {(*Server).closeWallet, true},
+	"stop_wallet":              {(*Server).stopWallet, false},
+	"get_version":              {(*Server).getVersion, false},
+	"store":                    {(*Server).store, true},
+	"is_multisig":              {(*Server).isMultisig, true},
+	"query_key":                {(*Server).queryKey, true},
+	"getheight":                {(*Server).getHeight, true},
+	"getaddress":               {(*Server).getAddress, true},
+	"getbalance":               {(*Server).getBalance, true},
+	"get_accounts":             {(*Server).getAccounts, true},
+	"create_account":           {(*Server).createAccount, true},
+	"create_address":           {(*Server).createAddress, true},
+	"make_integrated_address":  {(*Server).makeIntegratedAddress, true},
+	"split_integrated_address": {(*Server).splitIntegratedAddress, true},
+	"transfer":                 {(*Server).transfer, true},
+	"transfer_split":           {(*Server).transferSplit, true},
+	"sweep_all":                {(*Server).sweepAll, true},
+	"sweep_single":             {(*Server).sweepSingle, true},
+	"relay_tx":                 {(*Server).relayTx, true},
+	"get_transfers":            {(*Server).getTransfers, true},
+	"get_transfer_by_txid":     {(*Server).getTransferByTxID, true},
+	"incoming_transfers":       {(*Server).incomingTransfers, true},
+	"get_payments":             {(*Server).getPayments, true},
+	"get_bulk_payments":        {(*Server).getBulkPayments, true},
+	"freeze":                   {(*Server).freeze, true},
+	"thaw":                     {(*Server).thaw, true},
+	"frozen":                   {(*Server).frozen, true},
+}
+
+func (s *Server) createWallet(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Filename string `json:"filename"`
+		Password string `json:"password"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w, err := s.net.createWallet(req.Filename, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	s.wallet = w
+	return nil, nil
+}
+
+func (s *Server) openWallet(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Filename string `json:"filename"`
+		Password string `json:"password"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	s.wallet = nil
+	w, ok := s.net.wallets[req.Filename]
+	if !ok {
+		return nil, werr(walletrpc.ErrUnknown, "Failed to open wallet")
+	}
+	if w.password != req.Password {
+		return nil, werr(walletrpc.ErrInvalidPassword, "Invalid password.")
+	}
+	s.wallet = w
+	return nil, nil
+}
+
+func (s *Server) closeWallet(json.RawMessage) (interface{}, error) {
+	s.wallet = nil
+	return nil, nil
+}
+
+func (s *Server) stopWallet(json.RawMessage) (interface{}, error) {
+	s.wallet = nil
+	return nil, nil
+}
+
+func (s *Server) getVersion(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"version": version.Major<<16 | version.Minor,
+		"release": true,
+	}, nil
+}
+
+func (s *Server) store(json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+func (s *Server) isMultisig(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{"multisig": false, "ready": false, "threshold": 0, "total": 0}, nil
+}
+
+func (s *Server) queryKey(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		KeyType walletrpc.QueryKeyType `json:"key_type"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	var key string
+	switch req.KeyType {
+	case walletrpc.QueryKeyView:
+		key = s.wallet.viewKey
+	case walletrpc.QueryKeySpend:
+		key = s.wallet.spendKey
+	case walletrpc.QueryKeyMnemonic:
+		key = s.wallet.mnemonic
+	default:
+		return nil, werr(walletrpc.ErrUnknown, "key_type "+string(req.KeyType)+" not found")
+	}
+	return map[string]string{"key": key}, nil
+}
+
+func (s *Server) getHeight(json.RawMessage) (interface{}, error) {
+	return map[string]uint64{"height": s.net.height}, nil
+}
+
+func (s *Server) getAddress(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		AccountIndex uint64   `json:"account_index"`
+		AddressIndex []uint64 `json:"address_index"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w := s.wallet
+	if err := w.checkIndexes(req.AccountIndex, req.AddressIndex); err != nil {
+		return nil, err
+	}
+	type address struct {
+		Address      string `json:"address"`
+		Label        string `json:"label"`
+		AddressIndex uint64 `json:"address_index"`
+		Used         bool   `json:"used"`
+	}
+	var addresses []address
+	for i, sub := range w.accounts[req.AccountIndex].subaddresses {
+		if !inMinors(uint64(i), req.AddressIndex) {
+			continue
+		}
+		used := false
+		for _, o := range w.outputs {
+			used = used || o.index == walletrpc.SubaddressIndex{Major: req.AccountIndex, Minor: uint64(i)}
+		}
+		addresses = append(addresses, address{sub.address, sub.label, uint64(i), used})
+	}
+	return map[string]interface{}{
+		"address":   w.address(walletrpc.SubaddressIndex{Major: req.AccountIndex}),
+		"addresses": addresses,
+	}, nil
+}
+
+func (s *Server) getBalance(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		AccountIndex   uint64   `json:"account_index"`
+		AddressIndices []uint64 `json:"address_indices"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w := s.wallet
+	if err := w.checkIndexes(req.AccountIndex, req.AddressIndices); err != nil {
+		return nil, err
+	}
+	type subaddressBalance struct {
+		AccountIndex    uint64 `json:"account_index"`
+		AddressIndex    uint64 `json:"address_index"`
+		Address         string `json:"address"`
+		Balance         uint64 `json:"balance"`
+		UnlockedBalance uint64 `json:"unlocked_balance"`
+		Label           string `json:"label"`
+	}
+	var perSubaddress []subaddressBalance
+	for i, sub := range w.accounts[req.AccountIndex].subaddresses {
+		if !inMinors(uint64(i), req.AddressIndices) {
+			continue
+		}
+		balance, unlocked := w.balance(req.AccountIndex, []uint64{uint64(i)})
+		if balance > 0 {
+			perSubaddress = append(perSubaddress, subaddressBalance{
+				req.AccountIndex, uint64(i), sub.address, balance, unlocked, sub.label,
+			})
+		}
+	}
+	balance, unlocked := w.balance(req.AccountIndex, req.AddressIndices)
+	return map[string]interface{}{
+		"balance":          balance,
+		"unlocked_balance": unlocked,
+		"per_subaddress":   perSubaddress,
+	}, nil
+}
+
+func (s *Server) getAccounts(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Tag string `json:"tag"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	resp := walletrpc.GetAccountsResponse{SubaddressAccounts: []walletrpc.Account{}}
+	for i, acc := range s.wallet.accounts {
+		if req.Tag != "" && acc.tag != req.Tag {
+			continue
+		}
+		balance, unlocked := s.wallet.balance(uint64(i), nil)
+		resp.SubaddressAccounts = append(resp.SubaddressAccounts, walletrpc.Account{
+			AccountIndex:    uint64(i),
+			BaseAddress:     acc.subaddresses[0].address,
+			Balance:         balance,
+			UnlockedBalance: unlocked,
+			Label:           acc.label,
+			Tag:             acc.tag,
+		})
+		resp.TotalBalance += balance
+		resp.TotalUnlockedBalance += unlocked
+	}
+	return resp, nil
+}
+
+func (s *Server) createAccount(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	index, address := s.wallet.createAccount(req.Label)
+	return map[string]interface{}{"account_index": index, "address": address}, nil
+}
+
+func (s *Server) createAddress(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		AccountIndex uint64 `json:"account_index"`
+		Label        string `json:"label"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	address, index, err := s.wallet.createAddress(req.AccountIndex, req.Label)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"address": address, "address_index": index}, nil
+}
+
+func (s *Server) makeIntegratedAddress(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		StandardAddress string `json:"standard_address"`
+		PaymentID       string `json:"payment_id"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	if req.StandardAddress == "" {
+		req.StandardAddress = s.wallet.address(walletrpc.SubaddressIndex{})
+	}
+	if req.PaymentID == "" {
+		req.PaymentID = randomHex(8)
+	}
+	a, err := walletrpc.DecodeAddress(req.StandardAddress)
+	if err != nil || a.Type != walletrpc.AddressStandard {
+		return nil, werr(walletrpc.ErrWrongAddress, "Invalid address")
+	}
+	if pid, err := hex.DecodeString(req.PaymentID); err != nil || len(pid) != 8 {
+		return nil, werr(walletrpc.ErrWrongPaymentID, "Invalid payment ID")
+	}
+	a.Type, a.PaymentID = walletrpc.AddressIntegrated, req.PaymentID
+	integrated, err := walletrpc.EncodeAddress(*a)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"integrated_address": integrated, "payment_id": req.PaymentID}, nil
+}
+
+func (s *Server) splitIntegratedAddress(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		IntegratedAddress string `json:"integrated_address"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	a, err := walletrpc.DecodeAddress(req.IntegratedAddress)
+	if err != nil {
+		return nil, werr(walletrpc.ErrWrongAddress, "Invalid address")
+	}
+	if a.Type != walletrpc.AddressIntegrated {
+		return nil, werr(walletrpc.ErrWrongAddress, "Address is not an integrated address")
+	}
+	paymentID := a.PaymentID
+	a.Type, a.PaymentID = walletrpc.AddressStandard, ""
+	standard, err := walletrpc.EncodeAddress(*a)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"standard_address": standard, "payment_id": paymentID, "is_subaddress": false}, nil
+}
+
+// newTransfer returns the transaction of a transfer, not relayed.
+func (s *Server) newTransfer(req walletrpc.TransferRequest) (*tx, error) {
+	w, n := s.wallet, s.net
+	if err := w.checkIndexes(req.AccountIndex, req.SubaddrIndices); err != nil {
+		return nil, err
+	}
+	if len(req.Destinations) == 0 {
+		return nil, werr(walletrpc.ErrZeroDestination, "No destinations for this transfer")
+	}
+	if req.PaymentID != "" {
+		return nil, werr(walletrpc.ErrWrongPaymentID,
+			"Standalone payment IDs are obsolete. Use subaddresses or integrated addresses instead")
+	}
+	dests := append([]walletrpc.Destination(nil), req.Destinations...)
+	owners := make([]owner, len(dests))
+	paymentID := ""
+	var total uint64
+	for i, d := range dests {
+		o, pid, err := n.resolve(d.Address)
+		if err != nil {
+			return nil, err
+		}
+		if pid != "" && paymentID != "" && pid != paymentID {
+			return nil, werr(walletrpc.ErrWrongPaymentID, "A single payment id is allowed per transaction")
+		}
+		if pid != "" {
+			paymentID = pid
+		}
+		if d.Amount == 0 {
+			return nil, werr(walletrpc.ErrZeroAmount, "Amount must be greater than zero")
+		}
+		owners[i] = o
+		total += d.Amount
+	}
+
+	fee := n.cfg.Fee
+	needed := total + fee
+	if len(req.SubtractFeeFromOutputs) > 0 {
+		// the fee is split evenly, the first destination paying the rest
+		k := uint64(len(req.SubtractFeeFromOutputs))
+		for i, index := range req.SubtractFeeFromOutputs {
+			if index >= uint64(len(dests)) {
+				return nil, werr(walletrpc.ErrGenericTransferError, "subtract_fee_from_outputs: index out of range")
+			}
+			share := fee / k
+			if i == 0 {
+				share += fee % k
+			}
+			if dests[index].Amount <= share {
+				return nil, werr(walletrpc.ErrGenericTransferError, "the fee exceeds the amount of a destination")
+			}
+			dests[index].Amount -= share
+		}
+		needed = total
+	}
+	inputs, err := w.selectOutputs(req.AccountIndex, req.SubaddrIndices, needed)
+	if err != nil {
+		return nil, err
+	}
+	from := walletrpc.SubaddressIndex{Major: req.AccountIndex, Minor: inputs[0].index.Minor}
+	return w.newTx(from, inputs, dests, owners, paymentID, req.UnlockTime, fee), nil
+}
+
+// send relays a transaction, or holds it with do_not_relay, and returns its
+// metadata.
+func (s *Server) send(t *tx, doNotRelay bool) (string, error) {
+	metadata := hex.EncodeToString([]byte("tx:" + t.hash))
+	if doNotRelay {
+		s.net.held[metadata] = t
+		return metadata, nil
+	}
+	return metadata, s.net.relay(t)
+}
+
+func keyImages(t *tx) walletrpc.KeyImageList {
+	list := walletrpc.KeyImageList{KeyImages: []string{}}
+	for _, o := range t.inputs {
+		list.KeyImages = append(list.KeyImages, o.keyImage)
+	}
+	return list
+}
+
+func (s *Server) transfer(params json.RawMessage) (interface{}, error) {
+	var req walletrpc.TransferRequest
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	t, err := s.newTransfer(req)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := s.send(t, req.DoNotRelay)
+	if err != nil {
+		return nil, err
+	}
+	resp := walletrpc.TransferResponse{
+		Fee:            t.fee,
+		TxHash:         t.hash,
+		Amount:         t.amount,
+		Weight:         1500,
+		SpentKeyImages: keyImages(t),
+	}
+	if req.GetTxKey {
+		resp.TxKey = randomHex(32)
+	}
+	if req.GetTxHex {
+		resp.TxBlob = randomHex(1500)
+	}
+	if req.GetTxMetadata || req.DoNotRelay {
+		resp.TxMetadata = metadata
+	}
+	return resp, nil
+}
+
+func (s *Server) transferSplit(params json.RawMessage) (interface{}, error) {
+	var req walletrpc.TransferRequest
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	t, err := s.newTransfer(req)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := s.send(t, req.DoNotRelay)
+	if err != nil {
+		return nil, err
+	}
+	return splitResponse(t, metadata, req.GetTxKey, req.GetTxHex, req.GetTxMetadata || req.DoNotRelay), nil
+}
+
+// splitResponse is the response of transfer_split and sweep_all, which
+// create a transaction here.
+func splitResponse(t *tx, metadata string, txKey, txHex, txMetadata bool) walletrpc.TransferSplitResponse {
+	resp := walletrpc.TransferSplitResponse{
+		FeeList:            []uint64{t.fee},
+		TxHashList:         []string{t.hash},
+		AmountList:         []uint64{t.amount},
+		WeightList:         []uint64{1500},
+		SpentKeyImagesList: []walletrpc.KeyImageList{keyImages(t)},
+	}
+	if txKey {
+		resp.TxKeyList = []string{randomHex(32)}
+	}
+	if txHex {
+		resp.TxBlobList = []string{randomHex(1500)}
+	}
+	if txMetadata {
+		resp.TxMetadataList = []string{metadata}
+	}
+	return resp
+}
+
+func (s *Server) sweepAll(params json.RawMessage) (interface{}, error) {
+	var req walletrpc.SweepAllRequest
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w, n := s.wallet, s.net
+	minors := req.SubaddrIndices
+	if req.SubaddrIndicesAll {
+		minors = nil
+	}
+	if err := w.checkIndexes(req.AccountIndex, minors); err != nil {
+		return nil, err
+	}
+	o, paymentID, err := n.resolve(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []*output
+	var sum uint64
+	for _, out := range w.outputs {
+		if out.index.Major == req.AccountIndex && inMinors(out.index.Minor, minors) &&
+			!out.tx.failed && !out.spent() && !out.frozen && n.unlocked(out) &&
+			(req.BelowAmount == 0 || out.amount < req.BelowAmount) {
+			inputs = append(inputs, out)
+			sum += out.amount
+		}
+	}
+	if sum <= n.cfg.Fee {
+		return nil, werr(walletrpc.ErrTxNotPossible, "No transaction created")
+	}
+	dests := []walletrpc.Destination{{Amount: sum - n.cfg.Fee, Address: req.Address}}
+	from := walletrpc.SubaddressIndex{Major: req.AccountIndex, Minor: inputs[0].index.Minor}
+	t := w.newTx(from, inputs, dests, []owner{o}, paymentID, req.UnlockTime, n.cfg.Fee)
+	metadata, err := s.send(t, req.DoNotRelay)
+	if err != nil {
+		return nil, err
+	}
+	resp := splitResponse(t, metadata, req.GetTxKeys, req.GetTxHex, req.GetTxMetadata || req.DoNotRelay)
+	return walletrpc.SweepAllResponse{
+		TxHashList:         resp.TxHashList,
+		TxBlobList:         resp.TxBlobList,
+		TxKeyList:          resp.TxKeyList,
+		AmountList:         resp.AmountList,
+		FeeList:            resp.FeeList,
+		TxMetadataList:     resp.TxMetadataList,
+		WeightList:         resp.WeightList,
+		SpentKeyImagesList: resp.SpentKeyImagesList,
+	}, nil
+}
+
+// output returns the output of the wallet open with the key image.
+func (s *Server) output(keyImage string) (*output, error) {
+	for _, o := range s.wallet.outputs {
+		if o.keyImage == keyImage && !o.tx.failed {
+			return o, nil
+		}
+	}
+	return nil, werr(walletrpc.ErrWrongKeyImage, "Failed to parse key image")
+}
+
+func (s *Server) sweepSingle(params json.RawMessage) (interface{}, error) {
+	var req walletrpc.SweepSingleRequest
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w, n := s.wallet, s.net
+	in, err := s.output(req.KeyImage)
+	if err != nil {
+		return nil, err
+	}
+	if in.spent() {
+		return nil, werr(walletrpc.ErrWrongKeyImage, "The output was spent")
+	}
+	if in.frozen || !n.unlocked(in) {
+		return nil, werr(walletrpc.ErrNotEnoughUnlockedMoney, "not enough unlocked money")
+	}
+	if in.amount <= n.cfg.Fee {
+		return nil, werr(walletrpc.ErrTxNotPossible, "No transaction created")
+	}
+	o, paymentID, err := n.resolve(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	dests := []walletrpc.Destination{{Amount: in.amount - n.cfg.Fee, Address: req.Address}}
+	t := w.newTx(in.index, []*output{in}, dests, []owner{o}, paymentID, req.UnlockTime, n.cfg.Fee)
+	metadata, err := s.send(t, req.DoNotRelay)
+	if err != nil {
+		return nil, err
+	}
+	resp := walletrpc.SweepSingleResponse{
+		TxHash:         t.hash,
+		Amount:         t.amount,
+		Fee:            t.fee,
+		Weight:         1500,
+		SpentKeyImages: keyImages(t),
+	}
+	if req.GetTxKey {
+		resp.TxKey = randomHex(32)
+	}
+	if req.GetTxHex {
+		resp.TxBlob = randomHex(1500)
+	}
+	if req.GetTxMetadata || req.DoNotRelay {
+		resp.TxMetadata = metadata
+	}
+	return resp, nil
+}
+
+func (s *Server) relayTx(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Hex string `json:"hex"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	t, ok := s.net.held[req.Hex]
+	if !ok {
+		return nil, werr(walletrpc.ErrBadTxMetadata, "Failed to parse tx metadata.")
+	}
+	if err := s.net.relay(t); err != nil {
+		return nil, err
+	}
+	delete(s.net.held, req.Hex)
+	return map[string]string{"tx_hash": t.hash}, nil
+}
+
+func (s *Server) getTransfers(params json.RawMessage) (interface{}, error) {
+	var req walletrpc.GetTransfersRequest
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w := s.wallet
+	if !req.AllAccounts {
+		if err := w.checkIndexes(req.AccountIndex, req.SubaddrIndices); err != nil {
+			return nil, err
+		}
+	}
+	all := !req.In && !req.Out && !req.Pending && !req.Failed && !req.Pool
+	wanted := map[string]bool{
+		"in":      all || req.In,
+		"out":     all || req.Out,
+		"pending": all || req.Pending,
+		"failed":  all || req.Failed,
+		"pool":    all || req.Pool,
+	}
+	lists := map[string][]walletrpc.Transfer{}
+	for _, t := range s.net.txs {
+		for _, tr := range w.transfers(t) {
+			if !wanted[tr.Type] {
+				continue
+			}
+			if !req.AllAccounts && (tr.SubaddrIndex.Major != req.AccountIndex ||
+				!inMinors(tr.SubaddrIndex.Minor, req.SubaddrIndices)) {
+				continue
+			}
+			if req.FilterByHeight && (tr.Type == "in" || tr.Type == "out") &&
+				(tr.Height <= req.MinHeight || req.MaxHeight > 0 && tr.Height > req.MaxHeight) {
+				continue
+			}
+			lists[tr.Type] = append(lists[tr.Type], tr)
+		}
+	}
+	return lists, nil
+}
+
+func (s *Server) getTransferByTxID(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		TxID         string `json:"txid"`
+		AccountIndex uint64 `json:"account_index"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	if b, err := hex.DecodeString(req.TxID); err != nil || len(b) != 32 {
+		return nil, werr(walletrpc.ErrWrongTxID, "Transaction ID has invalid format")
+	}
+	var transfers []walletrpc.Transfer
+	if t, ok := s.net.byHash[req.TxID]; ok {
+		for _, tr := range s.wallet.transfers(t) {
+			if tr.SubaddrIndex.Major == req.AccountIndex {
+				transfers = append(transfers, tr)
+			}
+		}
+	}
+	if len(transfers) == 0 {
+		return nil, werr(walletrpc.ErrWrongTxID, "Transaction not found.")
+	}
+	return map[string]interface{}{"transfer": transfers[0], "transfers": transfers}, nil
+}
+
+func (s *Server) incomingTransfers(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		TransferType   walletrpc.GetTransferType `json:"transfer_type"`
+		AccountIndex   uint64                    `json:"account_index"`
+		SubaddrIndices []uint64                  `json:"subaddr_indices"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	w := s.wallet
+	if err := w.checkIndexes(req.AccountIndex, req.SubaddrIndices); err != nil {
+		return nil, err
+	}
+	switch req.TransferType {
+	case walletrpc.TransferAll, walletrpc.TransferAvailable, walletrpc.TransferUnavailable:
+	default:
+		return nil, werr(walletrpc.ErrTransferType, "Transfer type must be one of: all, available, or unavailable")
+	}
+	transfers := []walletrpc.IncTransfer{}
+	for _, o := range w.outputs {
+		if o.tx.height == 0 || o.tx.failed || o.index.Major != req.AccountIndex ||
+			!inMinors(o.index.Minor, req.SubaddrIndices) {
+			continue
+		}
+		spent := o.spent()
+		if req.TransferType == walletrpc.TransferAvailable && spent ||
+			req.TransferType == walletrpc.TransferUnavailable && !spent {
+			continue
+		}
+		transfers = append(transfers, walletrpc.IncTransfer{
+			Amount:       o.amount,
+			Spent:        spent,
+			GlobalIndex:  o.globalIndex,
+			TxHash:       o.tx.hash,
+			TxSize:       1500,
+			KeyImage:     o.keyImage,
+			SubaddrIndex: o.index,
+			Frozen:       o.frozen,
+			BlockHeight:  o.tx.height,
+			Unlocked:     s.net.unlocked(o),
+		})
+	}
+	if len(transfers) == 0 {
+		// no transfers field, as monero-wallet-rpc
+		return nil, nil
+	}
+	return map[string]interface{}{"transfers": transfers}, nil
+}
+
+// payments returns the payments to the wallet open with the payment ids,
+// in blocks above a height.
+func (s *Server) payments(paymentIDs []string, minHeight uint64) ([]walletrpc.Payment, error) {
+	ids := map[string]bool{}
+	for _, id := range paymentIDs {
+		if b, err := hex.DecodeString(id); err != nil || len(b) != 8 && len(b) != 32 {
+			return nil, werr(walletrpc.ErrWrongPaymentID, "Payment ID has invalid format")
+		}
+		ids[id] = true
+	}
+	payments := []walletrpc.Payment{}
+	for _, t := range s.net.txs {
+		if t.height <= minHeight || !ids[t.paymentID] {
+			continue
+		}
+		for _, tr := range s.wallet.transfers(t) {
+			if tr.Type == "in" {
+				payments = append(payments, walletrpc.Payment{
+					PaymentID:   t.paymentID,
+					TxHash:      t.hash,
+					Amount:      tr.Amount,
+					BlockHeight: t.height,
+					UnlockTime:  t.unlockTime,
+				})
+			}
+		}
+	}
+	sort.SliceStable(payments, func(i, j int) bool {
+		return payments[i].BlockHeight < payments[j].BlockHeight
+	})
+	return payments, nil
+}
+
+func (s *Server) getPayments(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		PaymentID string `json:"payment_id"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	payments, err := s.payments([]string{req.PaymentID}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"payments": payments}, nil
+}
+
+func (s *Server) getBulkPayments(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		PaymentIDs     []string `json:"payment_ids"`
+		MinBlockHeight uint64   `json:"min_block_height"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	payments, err := s.payments(req.PaymentIDs, req.MinBlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"payments": payments}, nil
+}
+
+func (s *Server) keyImageOutput(params json.RawMessage) (*output, error) {
+	var req struct {
+		KeyImage string `json:"key_image"`
+	}
+	if err := decode(params, &req); err != nil {
+		return nil, err
+	}
+	return s.output(req.KeyImage)
+}
+
+func (s *Server) freeze(params json.RawMessage) (interface{}, error) {
+	o, err := s.keyImageOutput(params)
+	if err != nil {
+		return nil, err
+	}
+	o.frozen = true
+	return nil, nil
+}
+
+func (s *Server) thaw(params json.RawMessage) (interface{}, error) {
+	o, err := s.keyImageOutput(params)
+	if err != nil {
+		return nil, err
+	}
+	o.frozen = false
+	return nil, nil
+}
+
+func (s *Server) frozen(params json.RawMessage) (interface{}, error) {
+	o, err := s.keyImageOutput(params)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"frozen": o.frozen}, nil
+}
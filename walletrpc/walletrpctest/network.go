@@ -0,0 +1,610 @@
+// Package walletrpctest provides an in-memory monero-wallet-rpc, to test
+// code using walletrpc without monerod.
+//
+// A Network simulates the blockchain: its wallets, their outputs, the
+// mempool and the blocks, which are only mined on demand. A Server is a
+// monero-wallet-rpc server of the network with a wallet open at a time,
+// served over HTTP by httptest:
+//
+//	net := walletrpctest.NewNetwork(walletrpctest.Config{})
+//	alice, _ := net.CreateWallet("alice", "pw")
+//	net.Credit(alice.Address(), 5000000000000, 0)
+//	net.Mine(10)
+//
+//	srv := net.NewServer()
+//	defer srv.Close()
+//	client := srv.Client()
+//	err := client.OpenWallet("alice", "pw")
+//
+// Transfers between the wallets of the network move their funds: the
+// transaction waits in the mempool until the next block, and its outputs
+// are spendable once SpendableAge blocks deep and past their unlock time.
+// Calls fail as monero-wallet-rpc's do, with its ErrorCode values, and
+// errors can be injected with Server.Fail and Server.FailNext.
+package walletrpctest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Config holds the configuration of a Network.
+type Config struct {
+	// Network of the addresses. Defaults to walletrpc.Mainnet.
+	Network walletrpc.Network
+	// Fee of every transaction. Defaults to 30000000 (0.00003 XMR).
+	Fee uint64
+	// SpendableAge is the number of blocks before an output can be spent.
+	// Defaults to 10, as in monero.
+	SpendableAge uint64
+	// Now is the time of the transactions and blocks. Defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+// unlockTimeMax is the first unlock time that is a timestamp rather than a
+// block height (CRYPTONOTE_MAX_BLOCK_NUMBER).
+const unlockTimeMax = 500000000
+
+// noPaymentID is the payment id of the transfers without one.
+const noPaymentID = "0000000000000000"
+
+// Network is a simulated blockchain with its wallets.
+type Network struct {
+	cfg Config
+
+	mu sync.Mutex
+	// height is the number of blocks, the genesis block included
+	height  uint64
+	wallets map[string]*Wallet
+	// owners are the wallets and indexes of the addresses
+	owners map[string]owner
+	// txs are the transactions relayed, in order
+	txs    []*tx
+	byHash map[string]*tx
+	// held are the transactions created but not relayed, by metadata
+	held        map[string]*tx
+	globalIndex uint64
+}
+
+type owner struct {
+	wallet *Wallet
+	index  walletrpc.SubaddressIndex
+}
+
+// Wallet is a wallet of the network.
+type Wallet struct {
+	net      *Network
+	name     string
+	password string
+	viewKey  string
+	spendKey string
+	mnemonic string
+	accounts []*account
+	outputs  []*output
+}
+
+type account struct {
+	label        string
+	tag          string
+	subaddresses []subaddress
+}
+
+type subaddress struct {
+	address string
+	label   string
+}
+
+// tx is a transaction, in the mempool while its height is 0.
+type tx struct {
+	hash       string
+	height     uint64
+	timestamp  uint64
+	unlockTime uint64
+	paymentID  string
+	fee        uint64
+	// amount is sent to the destinations
+	amount       uint64
+	destinations []walletrpc.Destination
+	// sender is nil for the credits from outside of the network
+	sender  *Wallet
+	from    walletrpc.SubaddressIndex
+	inputs  []*output
+	outputs []*output
+	// failed transactions were dropped from the mempool
+	failed bool
+}
+
+// output is an output of a transaction to a wallet of the network.
+type output struct {
+	tx          *tx
+	wallet      *Wallet
+	index       walletrpc.SubaddressIndex
+	amount      uint64
+	change      bool
+	keyImage    string
+	globalIndex uint64
+	spentBy     *tx
+	frozen      bool
+}
+
+func (o *output) spent() bool {
+	return o.spentBy != nil && !o.spentBy.failed
+}
+
+// NewNetwork returns a network with the genesis block only.
+func NewNetwork(cfg Config) *Network {
+	if cfg.Fee == 0 {
+		cfg.Fee = 30000000
+	}
+	if cfg.SpendableAge == 0 {
+		cfg.SpendableAge = 10
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Network{
+		cfg:     cfg,
+		height:  1,
+		wallets: map[string]*Wallet{},
+		owners:  map[string]owner{},
+		byHash:  map[string]*tx{},
+		held:    map[string]*tx{},
+	}
+}
+
+func werr(code walletrpc.ErrorCode, message string) error {
+	return &walletrpc.WalletError{Code: code, Message: message}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func randomKey() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// mnemonicWords are the words of the simulated seeds, which aren't valid.
+var mnemonicWords = strings.Fields(`abbey ability ablaze absorb abyss aching
+	acidic acoustic acquire across actress acumen adapt addicted adept adhesive`)
+
+// CreateWallet creates a wallet, with an account and its primary address.
+func (n *Network) CreateWallet(name, password string) (*Wallet, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.createWallet(name, password)
+}
+
+func (n *Network) createWallet(name, password string) (*Wallet, error) {
+	if name == "" {
+		return nil, werr(walletrpc.ErrUnknown, "Invalid filename")
+	}
+	if _, ok := n.wallets[name]; ok {
+		return nil, werr(walletrpc.ErrWalletAlreadyExists, "Wallet already exists.")
+	}
+	words := make([]string, 25)
+	for i := range words {
+		words[i] = mnemonicWords[randomKey()[0]%byte(len(mnemonicWords))]
+	}
+	w := &Wallet{
+		net:      n,
+		name:     name,
+		password: password,
+		viewKey:  randomHex(32),
+		spendKey: randomHex(32),
+		mnemonic: strings.Join(words, " "),
+	}
+	n.wallets[name] = w
+	w.createAccount("Primary account")
+	return w, nil
+}
+
+// Wallet returns the wallet of the name, nil if none.
+func (n *Network) Wallet(name string) *Wallet {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.wallets[name]
+}
+
+// Height returns the number of blocks.
+func (n *Network) Height() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.height
+}
+
+// Mine mines blocks, the first with the transactions of the mempool, and
+// returns the new height.
+func (n *Network) Mine(blocks int) uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := 0; i < blocks; i++ {
+		now := uint64(n.cfg.Now().Unix())
+		for _, t := range n.txs {
+			if t.height == 0 && !t.failed {
+				t.height = n.height
+				t.timestamp = now
+			}
+		}
+		n.height++
+	}
+	return n.height
+}
+
+// Mempool returns the hashes of the transactions in the mempool.
+func (n *Network) Mempool() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var hashes []string
+	for _, t := range n.txs {
+		if t.height == 0 && !t.failed {
+			hashes = append(hashes, t.hash)
+		}
+	}
+	return hashes
+}
+
+// Drop drops a transaction from the mempool, as if it failed: its sender
+// sees it failed and can spend its inputs again.
+func (n *Network) Drop(txid string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	t, ok := n.byHash[txid]
+	if !ok || t.height != 0 || t.failed {
+		return fmt.Errorf("walletrpctest: %v not in the mempool", txid)
+	}
+	t.failed = true
+	return nil
+}
+
+// Credit sends an amount to an address of the network from outside of it,
+// in a transaction of the mempool, and returns its hash. The unlock time is
+// a block height, or a timestamp from 500000000 on, 0 for none.
+func (n *Network) Credit(address string, amount, unlockTime uint64) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	o, paymentID, err := n.resolve(address)
+	if err != nil {
+		return "", err
+	}
+	if o.wallet == nil {
+		return "", fmt.Errorf("walletrpctest: %v isn't an address of the network", address)
+	}
+	if amount == 0 {
+		return "", werr(walletrpc.ErrZeroAmount, "Amount must be greater than zero")
+	}
+	t := &tx{
+		hash:         randomHex(32),
+		unlockTime:   unlockTime,
+		paymentID:    paymentID,
+		amount:       amount,
+		destinations: []walletrpc.Destination{{Amount: amount, Address: address}},
+		outputs:      []*output{{wallet: o.wallet, index: o.index, amount: amount}},
+	}
+	if err := n.relay(t); err != nil {
+		return "", err
+	}
+	return t.hash, nil
+}
+
+// newAddress returns a new address with random keys.
+func (n *Network) newAddress(typ walletrpc.AddressType) string {
+	addr, err := walletrpc.EncodeAddress(walletrpc.Address{
+		Network:        n.cfg.Network,
+		Type:           typ,
+		PublicSpendKey: randomKey(),
+		PublicViewKey:  randomKey(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+// resolve returns the owner of an address, the zero owner for an address
+// outside of the network, and the payment id of an integrated address.
+func (n *Network) resolve(address string) (owner, string, error) {
+	a, err := walletrpc.DecodeAddress(address)
+	if err != nil || a.Network != n.cfg.Network {
+		return owner{}, "", werr(walletrpc.ErrWrongAddress, "WALLET_RPC_ERROR_CODE_WRONG_ADDRESS: "+address)
+	}
+	if a.Type != walletrpc.AddressIntegrated {
+		return n.owners[address], "", nil
+	}
+	paymentID := a.PaymentID
+	a.Type, a.PaymentID = walletrpc.AddressStandard, ""
+	standard, err := walletrpc.EncodeAddress(*a)
+	if err != nil {
+		return owner{}, "", werr(walletrpc.ErrWrongAddress, "WALLET_RPC_ERROR_CODE_WRONG_ADDRESS: "+address)
+	}
+	return n.owners[standard], paymentID, nil
+}
+
+// relay adds a transaction to the mempool, unless one of its inputs was
+// spent meanwhile.
+func (n *Network) relay(t *tx) error {
+	for _, o := range t.inputs {
+		if o.spent() {
+			return werr(walletrpc.ErrGenericTransferError, "Failed to relay tx: double spend")
+		}
+	}
+	for _, o := range t.inputs {
+		o.spentBy = t
+	}
+	t.timestamp = uint64(n.cfg.Now().Unix())
+	for _, o := range t.outputs {
+		o.tx = t
+		o.keyImage = randomHex(32)
+		o.globalIndex = n.globalIndex
+		n.globalIndex++
+		if o.wallet != nil {
+			o.wallet.outputs = append(o.wallet.outputs, o)
+		}
+	}
+	n.txs = append(n.txs, t)
+	n.byHash[t.hash] = t
+	return nil
+}
+
+// confirmations of a transaction, 0 in the mempool.
+func (n *Network) confirmations(t *tx) uint64 {
+	if t.height == 0 {
+		return 0
+	}
+	return n.height - t.height
+}
+
+// unlocked reports whether an output can be spent.
+func (n *Network) unlocked(o *output) bool {
+	if n.confirmations(o.tx) < n.cfg.SpendableAge {
+		return false
+	}
+	switch u := o.tx.unlockTime; {
+	case u == 0:
+		return true
+	case u < unlockTimeMax:
+		return n.height >= u
+	default:
+		return uint64(n.cfg.Now().Unix()) >= u
+	}
+}
+
+// Name returns the name of the wallet, its file name.
+func (w *Wallet) Name() string {
+	return w.name
+}
+
+// Address returns the primary address of the wallet.
+func (w *Wallet) Address() string {
+	w.net.mu.Lock()
+	defer w.net.mu.Unlock()
+	return w.accounts[0].subaddresses[0].address
+}
+
+// CreateAccount creates an account, and returns its index and primary
+// address.
+func (w *Wallet) CreateAccount(label string) (uint64, string) {
+	w.net.mu.Lock()
+	defer w.net.mu.Unlock()
+	return w.createAccount(label)
+}
+
+func (w *Wallet) createAccount(label string) (uint64, string) {
+	w.accounts = append(w.accounts, &account{label: label})
+	index := uint64(len(w.accounts) - 1)
+	address, _, _ := w.createAddress(index, label)
+	return index, address
+}
+
+// CreateAddress creates a subaddress in an account, and returns it with
+// its index.
+func (w *Wallet) CreateAddress(accountIndex uint64, label string) (string, uint64, error) {
+	w.net.mu.Lock()
+	defer w.net.mu.Unlock()
+	return w.createAddress(accountIndex, label)
+}
+
+func (w *Wallet) createAddress(accountIndex uint64, label string) (string, uint64, error) {
+	if accountIndex >= uint64(len(w.accounts)) {
+		return "", 0, werr(walletrpc.ErrAccountIndexOutOfBounds, "Account index is out of bound")
+	}
+	acc := w.accounts[accountIndex]
+	typ := walletrpc.AddressSubaddress
+	if accountIndex == 0 && len(acc.subaddresses) == 0 {
+		typ = walletrpc.AddressStandard
+	}
+	address := w.net.newAddress(typ)
+	index := walletrpc.SubaddressIndex{Major: accountIndex, Minor: uint64(len(acc.subaddresses))}
+	acc.subaddresses = append(acc.subaddresses, subaddress{address: address, label: label})
+	w.net.owners[address] = owner{wallet: w, index: index}
+	return address, index.Minor, nil
+}
+
+// Balance returns the balance and unlocked balance of an account.
+func (w *Wallet) Balance(accountIndex uint64) (balance, unlocked uint64) {
+	w.net.mu.Lock()
+	defer w.net.mu.Unlock()
+	return w.balance(accountIndex, nil)
+}
+
+// balance sums the outputs of the account, and of the subaddresses if
+// any: those in blocks, and the change of the transactions in the mempool.
+func (w *Wallet) balance(accountIndex uint64, minors []uint64) (balance, unlocked uint64) {
+	for _, o := range w.outputs {
+		if o.index.Major != accountIndex || !inMinors(o.index.Minor, minors) ||
+			o.tx.failed || o.spent() || o.frozen {
+			continue
+		}
+		if o.tx.height > 0 || o.change {
+			balance += o.amount
+		}
+		if w.net.unlocked(o) {
+			unlocked += o.amount
+		}
+	}
+	return
+}
+
+func inMinors(minor uint64, minors []uint64) bool {
+	if len(minors) == 0 {
+		return true
+	}
+	for _, m := range minors {
+		if m == minor {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Wallet) address(index walletrpc.SubaddressIndex) string {
+	return w.accounts[index.Major].subaddresses[index.Minor].address
+}
+
+// checkIndexes checks the account and subaddress indexes of a request.
+func (w *Wallet) checkIndexes(accountIndex uint64, minors []uint64) error {
+	if accountIndex >= uint64(len(w.accounts)) {
+		return werr(walletrpc.ErrAccountIndexOutOfBounds, "Account index is out of bound")
+	}
+	for _, m := range minors {
+		if m >= uint64(len(w.accounts[accountIndex].subaddresses)) {
+			return werr(walletrpc.ErrAddressIndexOutOfBounds, "Address index is out of bound")
+		}
+	}
+	return nil
+}
+
+// selectOutputs picks the oldest unlocked outputs of the account, and of the
+// subaddresses if any, worth the amount at least.
+func (w *Wallet) selectOutputs(accountIndex uint64, minors []uint64, amount uint64) ([]*output, error) {
+	var selected []*output
+	var sum uint64
+	for _, o := range w.outputs {
+		if sum >= amount {
+			break
+		}
+		if o.index.Major == accountIndex && inMinors(o.index.Minor, minors) &&
+			!o.tx.failed && !o.spent() && !o.frozen && w.net.unlocked(o) {
+			selected = append(selected, o)
+			sum += o.amount
+		}
+	}
+	if sum >= amount {
+		return selected, nil
+	}
+	if balance, _ := w.balance(accountIndex, minors); balance >= amount {
+		return nil, werr(walletrpc.ErrNotEnoughUnlockedMoney, "not enough unlocked money")
+	}
+	return nil, werr(walletrpc.ErrNotEnoughMoney, "not enough money")
+}
+
+// newTx returns a transaction of the wallet spending inputs to the
+// destinations, with the change to the account.
+func (w *Wallet) newTx(from walletrpc.SubaddressIndex, inputs []*output, dests []walletrpc.Destination, owners []owner,
+	paymentID string, unlockTime, fee uint64) *tx {
+	t := &tx{
+		hash:         randomHex(32),
+		unlockTime:   unlockTime,
+		paymentID:    paymentID,
+		fee:          fee,
+		destinations: dests,
+		sender:       w,
+		from:         from,
+		inputs:       inputs,
+	}
+	var in uint64
+	for _, o := range inputs {
+		in += o.amount
+	}
+	for i, d := range dests {
+		t.amount += d.Amount
+		t.outputs = append(t.outputs, &output{wallet: owners[i].wallet, index: owners[i].index, amount: d.Amount})
+	}
+	if change := in - t.amount - fee; change > 0 {
+		t.outputs = append(t.outputs, &output{
+			wallet: w,
+			index:  walletrpc.SubaddressIndex{Major: from.Major},
+			amount: change,
+			change: true,
+		})
+	}
+	return t
+}
+
+// transfers returns the transfers of a transaction seen by the wallet:
+// out, pending or failed if it sent it, and in or pool for every
+// subaddress it received to.
+func (w *Wallet) transfers(t *tx) []walletrpc.Transfer {
+	n := w.net
+	paymentID := t.paymentID
+	if paymentID == "" {
+		paymentID = noPaymentID
+	}
+	base := walletrpc.Transfer{
+		TxID:          t.hash,
+		PaymentID:     paymentID,
+		Height:        t.height,
+		Timestamp:     t.timestamp,
+		Fee:           t.fee,
+		Confirmations: n.confirmations(t),
+		UnlockTime:    t.unlockTime,
+	}
+	var transfers []walletrpc.Transfer
+	if t.sender == w {
+		out := base
+		out.Amount = t.amount
+		out.Destinations = t.destinations
+		out.SubaddrIndex = t.from
+		out.Address = w.address(t.from)
+		switch {
+		case t.failed:
+			out.Type = "failed"
+		case t.height == 0:
+			out.Type = "pending"
+		default:
+			out.Type = "out"
+		}
+		transfers = append(transfers, out)
+	}
+	if t.failed {
+		return transfers
+	}
+	received := map[walletrpc.SubaddressIndex]uint64{}
+	var indexes []walletrpc.SubaddressIndex
+	for _, o := range t.outputs {
+		if o.wallet != w || o.change {
+			continue
+		}
+		if _, ok := received[o.index]; !ok {
+			indexes = append(indexes, o.index)
+		}
+		received[o.index] += o.amount
+	}
+	for _, index := range indexes {
+		in := base
+		in.Amount = received[index]
+		in.SubaddrIndex = index
+		in.Address = w.address(index)
+		in.Type = "in"
+		if t.height == 0 {
+			in.Type = "pool"
+		}
+		transfers = append(transfers, in)
+	}
+	return transfers
+}
@@ -0,0 +1,179 @@
+package walletrpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Handler answers a call with its result, or an error: a
+// *walletrpc.WalletError for its code, ErrUnknown otherwise.
+type Handler func(params json.RawMessage) (interface{}, error)
+
+// Server is a monero-wallet-rpc server of a network.
+type Server struct {
+	*httptest.Server
+	net *Network
+
+	// guarded by net.mu
+	wallet   *Wallet
+	handlers map[string]Handler
+	failing  map[string]*walletrpc.WalletError
+	failNext map[string][]*walletrpc.WalletError
+}
+
+// NewServer starts a server of the network, with no wallet open. It must
+// be closed.
+func (n *Network) NewServer() *Server {
+	s := &Server{
+		net:      n,
+		handlers: map[string]Handler{},
+		failing:  map[string]*walletrpc.WalletError{},
+		failNext: map[string][]*walletrpc.WalletError{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns a client of the server.
+func (s *Server) Client() *walletrpc.Client {
+	return walletrpc.New(walletrpc.Config{Address: s.URL + "/json_rpc"})
+}
+
+// Open opens a wallet, without its password.
+func (s *Server) Open(w *Wallet) {
+	s.net.mu.Lock()
+	defer s.net.mu.Unlock()
+	s.wallet = w
+}
+
+// Wallet returns the wallet open, nil if none.
+func (s *Server) Wallet() *Wallet {
+	s.net.mu.Lock()
+	defer s.net.mu.Unlock()
+	return s.wallet
+}
+
+// Handle answers the calls of a method with a handler, in place of the
+// simulation, e.g. for a method it doesn't implement.
+func (s *Server) Handle(method string, h Handler) {
+	s.net.mu.Lock()
+	defer s.net.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Fail makes the calls of a method fail with an error until Heal.
+func (s *Server) Fail(method string, code walletrpc.ErrorCode, message string) {
+	s.net.mu.Lock()
+	defer s.net.mu.Unlock()
+	s.failing[method] = &walletrpc.WalletError{Code: code, Message: message}
+}
+
+// FailNext makes the next call of a method fail with an error. Errors
+// queued for a method fail its calls in turn.
+func (s *Server) FailNext(method string, code walletrpc.ErrorCode, message string) {
+	s.net.mu.Lock()
+	defer s.net.mu.Unlock()
+	s.failNext[method] = append(s.failNext[method], &walletrpc.WalletError{Code: code, Message: message})
+}
+
+// Heal removes the errors injected for a method.
+func (s *Server) Heal(method string) {
+	s.net.mu.Lock()
+	defer s.net.mu.Unlock()
+	delete(s.failing, method)
+	delete(s.failNext, method)
+}
+
+type request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Version string                 `json:"jsonrpc"`
+	ID      json.RawMessage        `json:"id"`
+	Result  interface{}            `json:"result,omitempty"`
+	Error   *walletrpc.WalletError `json:"error,omitempty"`
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/json_rpc" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var req request
+	resp := response{Version: "2.0"}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// batches included, as monero-wallet-rpc
+		resp.Error = &walletrpc.WalletError{Code: -32700, Message: "Parse error"}
+	} else {
+		resp.ID = req.ID
+		resp.Result, resp.Error = s.call(req.Method, req.Params)
+	}
+	if resp.Error == nil && resp.Result == nil {
+		resp.Result = struct{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) call(method string, params json.RawMessage) (interface{}, *walletrpc.WalletError) {
+	s.net.mu.Lock()
+	if werr := s.injected(method); werr != nil {
+		s.net.mu.Unlock()
+		return nil, werr
+	}
+	if h, ok := s.handlers[method]; ok {
+		s.net.mu.Unlock()
+		return walletError(h(params))
+	}
+	defer s.net.mu.Unlock()
+	m, ok := methods[method]
+	if !ok {
+		return nil, &walletrpc.WalletError{Code: walletrpc.ErrMethodNotFound, Message: "Method not found"}
+	}
+	if m.needsWallet && s.wallet == nil {
+		return nil, &walletrpc.WalletError{Code: walletrpc.ErrNotOpen, Message: "No wallet file"}
+	}
+	return walletError(m.fn(s, params))
+}
+
+// injected returns the error injected for a method, s.net.mu being held.
+func (s *Server) injected(method string) *walletrpc.WalletError {
+	if queue := s.failNext[method]; len(queue) > 0 {
+		s.failNext[method] = queue[1:]
+		return queue[0]
+	}
+	return s.failing[method]
+}
+
+func walletError(result interface{}, err error) (interface{}, *walletrpc.WalletError) {
+	if err == nil {
+		return result, nil
+	}
+	if iswerr, werr := walletrpc.GetWalletError(err); iswerr {
+		return nil, werr
+	}
+	return nil, &walletrpc.WalletError{Code: walletrpc.ErrUnknown, Message: err.Error()}
+}
+
+// decode decodes the parameters of a call, if any.
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return werr(-32602, "Invalid params")
+	}
+	return nil
+}
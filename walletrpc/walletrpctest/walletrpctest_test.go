@@ -0,0 +1,278 @@
+package walletrpctest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const xmr = 1000000000000
+
+// open returns a client of a new server with the wallet open.
+func open(t *testing.T, n *Network, w *Wallet) (*Server, *walletrpc.Client) {
+	s := n.NewServer()
+	c := s.Client()
+	if err := c.OpenWallet(w.Name(), walletrpc.Secret(w.password)); err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestTransfer(t *testing.T) {
+	n := NewNetwork(Config{})
+	alice, _ := n.CreateWallet("alice", "pw")
+	bob, _ := n.CreateWallet("bob", "")
+	_, err := n.Credit(alice.Address(), 5*xmr, 0)
+	assert.NoError(t, err)
+	n.Mine(10)
+
+	sa, ca := open(t, n, alice)
+	defer sa.Close()
+	sb, cb := open(t, n, bob)
+	defer sb.Close()
+
+	balance, unlocked, err := ca.GetBalance()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5*xmr), balance)
+	assert.Equal(t, uint64(5*xmr), unlocked)
+
+	address, index, err := cb.CreateAddress(0, "invoice")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), index)
+	assert.NoError(t, walletrpc.ValidateAddress(address))
+
+	resp, err := ca.Transfer(walletrpc.TransferRequest{
+		Destinations: []walletrpc.Destination{{Amount: xmr, Address: address}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(xmr), resp.Amount)
+	assert.Equal(t, []string{resp.TxHash}, n.Mempool())
+	fee := resp.Fee
+
+	// the change of the pending transfer is locked
+	balance, unlocked, _ = ca.GetBalance()
+	assert.Equal(t, uint64(4*xmr-fee), balance)
+	assert.Equal(t, uint64(0), unlocked)
+	out, err := ca.GetTransferByTxID(resp.TxHash)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", out.Type)
+
+	transfers, err := cb.GetTransfers(walletrpc.GetTransfersRequest{Pool: true})
+	assert.NoError(t, err)
+	assert.Len(t, transfers.Pool, 1)
+	assert.Equal(t, address, transfers.Pool[0].Address)
+	balance, _, _ = cb.GetBalance()
+	assert.Equal(t, uint64(0), balance)
+
+	n.Mine(1)
+	in, err := cb.GetTransferByTxID(resp.TxHash)
+	assert.NoError(t, err)
+	assert.Equal(t, "in", in.Type)
+	assert.Equal(t, uint64(1), in.Confirmations)
+	assert.Equal(t, walletrpc.SubaddressIndex{Major: 0, Minor: 1}, in.SubaddrIndex)
+	balance, unlocked, _ = cb.GetBalance()
+	assert.Equal(t, uint64(xmr), balance)
+	assert.Equal(t, uint64(0), unlocked)
+
+	n.Mine(9)
+	_, unlocked, _ = cb.GetBalance()
+	assert.Equal(t, uint64(xmr), unlocked)
+	_, unlocked, _ = ca.GetBalance()
+	assert.Equal(t, uint64(4*xmr-fee), unlocked)
+
+	accounts, err := ca.GetAccounts("")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4*xmr-fee), accounts.TotalBalance)
+	assert.Equal(t, alice.Address(), accounts.SubaddressAccounts[0].BaseAddress)
+
+	// bob sends it all back, and the inputs of alice were spent
+	sweep, err := cb.SweepAll(walletrpc.SweepAllRequest{Address: alice.Address()})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{xmr - fee}, sweep.AmountList)
+	n.Mine(1)
+	inc, err := ca.IncomingTransfers(walletrpc.TransferAll)
+	assert.NoError(t, err)
+	assert.Len(t, inc, 3)
+	assert.True(t, inc[0].Spent)
+	assert.False(t, inc[2].Unlocked)
+	balance, _ = bob.Balance(0)
+	assert.Equal(t, uint64(0), balance)
+}
+
+func TestPayments(t *testing.T) {
+	n := NewNetwork(Config{})
+	alice, _ := n.CreateWallet("alice", "")
+	bob, _ := n.CreateWallet("bob", "")
+	n.Credit(alice.Address(), 5*xmr, 0)
+	n.Mine(10)
+	sa, ca := open(t, n, alice)
+	defer sa.Close()
+	sb, cb := open(t, n, bob)
+	defer sb.Close()
+
+	integrated, err := cb.MakeIntegratedAddress("0123456789abcdef")
+	assert.NoError(t, err)
+	pid, standard, err := cb.SplitIntegratedAddress(integrated)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", pid)
+	assert.Equal(t, bob.Address(), standard)
+
+	resp, err := ca.Transfer(walletrpc.TransferRequest{
+		Destinations:           []walletrpc.Destination{{Amount: xmr, Address: integrated}},
+		SubtractFeeFromOutputs: []uint64{0},
+	})
+	assert.NoError(t, err)
+	height := n.Mine(1)
+
+	payments, err := cb.GetBulkPayments([]string{pid}, uint(height-2))
+	assert.NoError(t, err)
+	assert.Len(t, payments, 1)
+	assert.Equal(t, resp.TxHash, payments[0].TxHash)
+	assert.Equal(t, uint64(xmr)-resp.Fee, payments[0].Amount)
+	payments, err = cb.GetBulkPayments([]string{pid}, uint(height-1))
+	assert.NoError(t, err)
+	assert.Len(t, payments, 0)
+}
+
+func TestHeldAndDropped(t *testing.T) {
+	n := NewNetwork(Config{})
+	alice, _ := n.CreateWallet("alice", "")
+	bob, _ := n.CreateWallet("bob", "")
+	n.Credit(alice.Address(), 2*xmr, 0)
+	n.Mine(10)
+	sa, ca := open(t, n, alice)
+	defer sa.Close()
+
+	req := walletrpc.TransferRequest{
+		Destinations: []walletrpc.Destination{{Amount: xmr, Address: bob.Address()}},
+		DoNotRelay:   true,
+	}
+	held, err := ca.Transfer(req)
+	assert.NoError(t, err)
+	assert.Len(t, n.Mempool(), 0)
+	hash, err := ca.RelayTx(held.TxMetadata)
+	assert.NoError(t, err)
+	assert.Equal(t, held.TxHash, hash)
+
+	// a transfer held spending the same output can't be relayed anymore
+	n.Drop(hash)
+	held, err = ca.Transfer(req)
+	assert.NoError(t, err)
+	req.DoNotRelay = false
+	sent, err := ca.Transfer(req)
+	assert.NoError(t, err)
+	_, err = ca.RelayTx(held.TxMetadata)
+	assert.True(t, errors.Is(err, walletrpc.ErrGenericTransferError))
+
+	transfers, err := ca.GetTransfers(walletrpc.GetTransfersRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, transfers.Failed, 1)
+	assert.Equal(t, hash, transfers.Failed[0].TxID)
+	assert.Len(t, transfers.Pending, 1)
+	assert.Equal(t, sent.TxHash, transfers.Pending[0].TxID)
+}
+
+func TestAccounts(t *testing.T) {
+	n := NewNetwork(Config{})
+	alice, _ := n.CreateWallet("alice", "")
+	index, address := alice.CreateAccount("savings")
+	sub, _, _ := alice.CreateAddress(index, "cold")
+	n.Credit(alice.Address(), xmr, 0)
+	n.Credit(address, 2*xmr, 0)
+	n.Credit(sub, 3*xmr, 0)
+	n.Mine(10)
+	s, c := open(t, n, alice)
+	defer s.Close()
+
+	primary, err := c.GetAccountAddress(index)
+	assert.NoError(t, err)
+	assert.Equal(t, address, primary)
+
+	inc, err := c.IncomingTransfers(walletrpc.TransferAvailable)
+	assert.NoError(t, err)
+	assert.Len(t, inc, 1)
+	assert.Equal(t, uint64(xmr), inc[0].Amount)
+	inc, err = c.GetIncomingTransfers(walletrpc.IncomingTransfersRequest{
+		TransferType: walletrpc.TransferAvailable,
+		AccountIndex: index,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, inc, 2)
+	inc, err = c.GetIncomingTransfers(walletrpc.IncomingTransfersRequest{
+		TransferType:   walletrpc.TransferAvailable,
+		AccountIndex:   index,
+		SubaddrIndices: []uint64{1},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, inc, 1)
+	assert.Equal(t, walletrpc.SubaddressIndex{Major: index, Minor: 1}, inc[0].SubaddrIndex)
+}
+
+func TestUnlockTime(t *testing.T) {
+	n := NewNetwork(Config{SpendableAge: 2})
+	alice, _ := n.CreateWallet("alice", "")
+	n.Credit(alice.Address(), xmr, 20)
+	n.Mine(2)
+	_, unlocked := alice.Balance(0)
+	assert.Equal(t, uint64(0), unlocked)
+	n.Mine(17)
+	_, unlocked = alice.Balance(0)
+	assert.Equal(t, uint64(xmr), unlocked)
+}
+
+func TestErrors(t *testing.T) {
+	n := NewNetwork(Config{})
+	alice, _ := n.CreateWallet("alice", "pw")
+	s := n.NewServer()
+	defer s.Close()
+	c := s.Client()
+
+	_, err := c.GetAddress()
+	assert.True(t, errors.Is(err, walletrpc.ErrNotOpen))
+	assert.True(t, errors.Is(c.OpenWallet("alice", "wrong"), walletrpc.ErrInvalidPassword))
+	assert.True(t, errors.Is(c.CreateWallet("alice", "", "English"), walletrpc.ErrWalletAlreadyExists))
+	assert.NoError(t, c.OpenWallet("alice", "pw"))
+
+	transfer := func(address string, amount uint64) error {
+		_, err := c.Transfer(walletrpc.TransferRequest{
+			Destinations: []walletrpc.Destination{{Amount: amount, Address: address}},
+		})
+		return err
+	}
+	assert.True(t, errors.Is(transfer("4abc", xmr), walletrpc.ErrWrongAddress))
+	assert.True(t, errors.Is(transfer(alice.Address(), xmr), walletrpc.ErrNotEnoughMoney))
+	n.Credit(alice.Address(), 2*xmr, 0)
+	n.Mine(1)
+	assert.True(t, errors.Is(transfer(alice.Address(), xmr), walletrpc.ErrNotEnoughUnlockedMoney))
+	_, err = c.GetTransferByTxID("00")
+	assert.True(t, errors.Is(err, walletrpc.ErrWrongTxID))
+
+	s.FailNext("getbalance", walletrpc.ErrDaemonIsBusy, "daemon is busy")
+	_, _, err = c.GetBalance()
+	assert.True(t, errors.Is(err, walletrpc.ErrDaemonIsBusy))
+	_, _, err = c.GetBalance()
+	assert.NoError(t, err)
+
+	s.Fail("getheight", walletrpc.ErrNoDaemonConnection, "no connection to daemon")
+	for i := 0; i < 2; i++ {
+		_, err = c.GetHeight()
+		assert.True(t, errors.Is(err, walletrpc.ErrNoDaemonConnection))
+	}
+	s.Heal("getheight")
+	height, err := c.GetHeight()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), height)
+
+	_, err = c.GetLanguages()
+	assert.True(t, errors.Is(err, walletrpc.ErrUnsupported))
+	s.Handle("get_languages", func(json.RawMessage) (interface{}, error) {
+		return map[string][]string{"languages": {"English"}}, nil
+	})
+	c = s.Client()
+	languages, err := c.GetLanguages()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"English"}, languages)
+}
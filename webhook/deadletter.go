@@ -0,0 +1,197 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/internal/atomicfile"
+)
+
+// DeadLetter is a delivery that failed for good.
+type DeadLetter struct {
+	URL       string    `json:"url"`
+	Payload   Payload   `json:"payload"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// DeadLetterQueue stores failed deliveries in a JSON lines file.
+type DeadLetterQueue struct {
+	path string
+	mu   sync.Mutex
+	// replaying are the entries being delivered again, by key
+	replaying map[string]bool
+}
+
+// replay is an entry of a queue being delivered again. It stays in the
+// queue until the delivery is over.
+type replay struct {
+	queue *DeadLetterQueue
+	entry DeadLetter
+}
+
+func (dl DeadLetter) key() string {
+	return dl.URL + " " + dl.Payload.ID
+}
+
+// OpenDeadLetterQueue opens (creating it if needed) the queue file at path.
+func OpenDeadLetterQueue(path string) (*DeadLetterQueue, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &DeadLetterQueue{path: path, replaying: make(map[string]bool)}, nil
+}
+
+func (q *DeadLetterQueue) add(dl DeadLetter) error {
+	line, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, err := os.OpenFile(q.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List returns the failed deliveries, oldest first.
+func (q *DeadLetterQueue) List() ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.read()
+}
+
+func (q *DeadLetterQueue) read() ([]DeadLetter, error) {
+	f, err := os.Open(q.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []DeadLetter
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(sc.Bytes(), &dl); err != nil {
+			return nil, err
+		}
+		out = append(out, dl)
+	}
+	return out, sc.Err()
+}
+
+func (q *DeadLetterQueue) write(dls []DeadLetter) error {
+	return atomicfile.Write(q.path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, dl := range dls {
+			if err := enc.Encode(dl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// done replaces a replayed entry with the dead letter of its new delivery,
+// or removes it if dl is nil.
+func (q *DeadLetterQueue) done(entry DeadLetter, dl *DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.replaying, entry.key())
+	all, err := q.read()
+	if err != nil {
+		return err
+	}
+	var out []DeadLetter
+	found := false
+	for _, e := range all {
+		if !found && e.key() == entry.key() && e.Attempts == entry.Attempts && e.FailedAt.Equal(entry.FailedAt) {
+			found = true
+			if dl != nil {
+				out = append(out, *dl)
+			}
+			continue
+		}
+		out = append(out, e)
+	}
+	if !found && dl != nil {
+		out = append(out, *dl)
+	}
+	return q.write(out)
+}
+
+// release forgets the replay of entries that weren't queued.
+func (q *DeadLetterQueue) release(entries []DeadLetter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, dl := range entries {
+		delete(q.replaying, dl.key())
+	}
+}
+
+// Replay queues the failed deliveries accepted by filter (all of them if
+// filter is nil) again on the dispatcher, for the endpoint they failed on.
+// An entry stays in the queue until its delivery is over: it's removed
+// once delivered, and replaced if the delivery fails again, so a crash
+// meanwhile leaves it to be replayed, possibly twice. The entries already
+// being replayed are skipped. Deliveries for an endpoint the dispatcher
+// doesn't have stay in the queue, and Replay then fails with
+// ErrNoEndpoint. It returns the number of replayed deliveries.
+func (q *DeadLetterQueue) Replay(ctx context.Context, d *Dispatcher, filter func(DeadLetter) bool) (int, error) {
+	q.mu.Lock()
+	all, err := q.read()
+	if err != nil {
+		q.mu.Unlock()
+		return 0, err
+	}
+	var replays []DeadLetter
+	for _, dl := range all {
+		if !q.replaying[dl.key()] && (filter == nil || filter(dl)) {
+			q.replaying[dl.key()] = true
+			replays = append(replays, dl)
+		}
+	}
+	q.mu.Unlock()
+
+	n := 0
+	var unknown error
+	for i, dl := range replays {
+		p := dl.Payload
+		err := d.dispatch(ctx, &p, dl.URL, &replay{queue: q, entry: dl})
+		if errors.Is(err, ErrNoEndpoint) {
+			q.release(replays[i : i+1])
+			if unknown == nil {
+				unknown = err
+			}
+			continue
+		}
+		if err != nil {
+			q.release(replays[i:])
+			return n, err
+		}
+		n++
+	}
+	return n, unknown
+}
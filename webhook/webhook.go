@@ -0,0 +1,445 @@
+// Package webhook delivers wallet events to HTTP endpoints.
+//
+// Every event is POSTed as JSON to the configured endpoints. Requests are
+// signed with HMAC-SHA256, failed deliveries are retried with exponential
+// backoff and, once the attempts are exhausted, written to a dead-letter
+// file from where they can be replayed.
+//
+// Receivers verify a delivery by computing
+//
+//	hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// where timestamp is the X-Monero-Timestamp header, and comparing it to the
+// X-Monero-Signature header (prefixed with "sha256="). The X-Monero-Delivery
+// header is the same for all the attempts of an event, so it can be used
+// to drop duplicates.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/events"
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// Header names set on every delivery.
+const (
+	HeaderSignature = "X-Monero-Signature"
+	HeaderTimestamp = "X-Monero-Timestamp"
+	HeaderDelivery  = "X-Monero-Delivery"
+	HeaderEvent     = "X-Monero-Event"
+)
+
+// ErrClosed is returned by Dispatch after Close.
+var ErrClosed = errors.New("webhook: dispatcher closed")
+
+// ErrNoEndpoint is returned when replaying a delivery for an endpoint the
+// dispatcher doesn't have.
+var ErrNoEndpoint = errors.New("webhook: no such endpoint")
+
+// Endpoint is a receiver of events.
+type Endpoint struct {
+	URL string
+	// Secret is the HMAC key. Deliveries are unsigned if it's empty.
+	Secret string
+	// Kinds (optional) restricts the events sent to the endpoint.
+	Kinds []events.Kind
+	// MaxConcurrency is the number of deliveries in flight. Defaults to 4.
+	// With more than one, events may arrive out of order.
+	MaxConcurrency int
+	// QueueSize is the number of events waiting for a slot before Dispatch
+	// blocks. Defaults to 100.
+	QueueSize int
+	// Headers are added to every request.
+	Headers map[string]string
+}
+
+func (e *Endpoint) wants(k events.Kind) bool {
+	if len(e.Kinds) == 0 {
+		return true
+	}
+	for _, v := range e.Kinds {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Config holds the configuration of a Dispatcher.
+type Config struct {
+	Endpoints []Endpoint
+	// HTTPClient defaults to a client with a 10 seconds timeout.
+	HTTPClient *http.Client
+	// MaxAttempts per delivery, first one included. Defaults to 5.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled every
+	// attempt up to MaxBackoff. Default to 1 second and 5 minutes.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// DeadLetter (optional) receives the deliveries that failed for good.
+	DeadLetter *DeadLetterQueue
+	// OnError (optional) is called after every failed attempt.
+	OnError func(endpoint string, payload *Payload, err error)
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	// ID is unique per event and shared by all the attempts and endpoints.
+	ID        string       `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Event     events.Event `json:"event"`
+}
+
+// NewPayload wraps an event in a Payload with a random id.
+func NewPayload(e events.Event, now time.Time) (*Payload, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &Payload{
+		ID:        hex.EncodeToString(buf),
+		CreatedAt: now.UTC(),
+		Event:     e,
+	}, nil
+}
+
+// StatusError is the error of a delivery answered with a non 2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook: http status %v: %v", e.StatusCode, e.Body)
+}
+
+// retryable reports whether another attempt may succeed.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500 || se.StatusCode == http.StatusTooManyRequests ||
+			se.StatusCode == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// Sign returns the signature header value of body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, timestamp)
+	io.WriteString(mac, ".")
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery received by an endpoint.
+func Verify(secret, signature, timestamp string, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+type job struct {
+	payload *Payload
+	body    []byte
+	// replay is the dead letter delivered again, if any
+	replay *replay
+}
+
+type endpointQueue struct {
+	Endpoint
+	jobs chan job
+}
+
+// Dispatcher delivers events to the endpoints.
+type Dispatcher struct {
+	cfg    Config
+	queues []*endpointQueue
+
+	closing      chan struct{}
+	abortRetries sync.Once
+	wg           sync.WaitGroup
+	// guards closed, set with stopped closed by Shutdown
+	mu      sync.RWMutex
+	closed  bool
+	stopped chan struct{}
+	// sending counts the dispatches in progress, which Shutdown waits for
+	// before closing the queues
+	sending sync.WaitGroup
+}
+
+// New starts the delivery workers of every endpoint.
+func New(cfg Config) *Dispatcher {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	d := &Dispatcher{
+		cfg:     cfg,
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, ep := range cfg.Endpoints {
+		if ep.MaxConcurrency <= 0 {
+			ep.MaxConcurrency = 4
+		}
+		if ep.QueueSize <= 0 {
+			ep.QueueSize = 100
+		}
+		q := &endpointQueue{
+			Endpoint: ep,
+			jobs:     make(chan job, ep.QueueSize),
+		}
+		d.queues = append(d.queues, q)
+		for i := 0; i < ep.MaxConcurrency; i++ {
+			d.wg.Add(1)
+			go d.worker(q)
+		}
+	}
+	return d
+}
+
+// Dispatch queues an event for every endpoint interested in it. It blocks
+// while the queue of an endpoint is full.
+func (d *Dispatcher) Dispatch(ctx context.Context, e events.Event) error {
+	p, err := NewPayload(e, d.cfg.Now())
+	if err != nil {
+		return err
+	}
+	return d.dispatch(ctx, p, "", nil)
+}
+
+// DispatchTransfer queues a transfer, e.g. from Client.GetTransferByTxID,
+// as an event of the given kind.
+func (d *Dispatcher) DispatchTransfer(ctx context.Context, kind events.Kind, tr walletrpc.Transfer) error {
+	return d.Dispatch(ctx, events.Event{
+		Kind:          kind,
+		Transfer:      tr,
+		Confirmations: tr.Confirmations,
+	})
+}
+
+// dispatch queues p for the endpoint with the given url, or all if empty.
+// It fails with ErrNoEndpoint if no endpoint has the url. The lock isn't
+// held while waiting for a full queue, so Shutdown doesn't wait behind it.
+func (d *Dispatcher) dispatch(ctx context.Context, p *Payload, url string, r *replay) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return ErrClosed
+	}
+	d.sending.Add(1)
+	d.mu.RUnlock()
+	defer d.sending.Done()
+
+	queued := false
+	for _, q := range d.queues {
+		if url != "" && q.URL != url || url == "" && !q.wants(p.Event.Kind) {
+			continue
+		}
+		select {
+		case q.jobs <- job{p, body, r}:
+			queued = true
+		case <-d.stopped:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if url != "" && !queued {
+		return fmt.Errorf("%w: %v", ErrNoEndpoint, url)
+	}
+	return nil
+}
+
+// Consume dispatches the events of ch (e.g. from an events.Watcher) until
+// it is closed or the context is done.
+func (d *Dispatcher) Consume(ctx context.Context, ch <-chan events.Event) error {
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := d.Dispatch(ctx, e); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Shutdown stops accepting events, failing the dispatches waiting for a
+// full queue with ErrClosed, and waits for the queued deliveries, retries
+// included. When ctx is done first, the deliveries waiting for a retry are
+// moved to the dead-letter queue and Shutdown returns ctx.Err() once the
+// attempts in flight are over.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	closing := !d.closed
+	if closing {
+		d.closed = true
+		close(d.stopped)
+	}
+	d.mu.Unlock()
+	if closing {
+		d.sending.Wait()
+		for _, q := range d.queues {
+			close(q.jobs)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	d.abortRetries.Do(func() { close(d.closing) })
+	<-done
+	return ctx.Err()
+}
+
+// Close stops accepting events, delivers the queued ones once and moves
+// the deliveries waiting for a retry to the dead-letter queue.
+func (d *Dispatcher) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.Shutdown(ctx); err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+func (d *Dispatcher) worker(q *endpointQueue) {
+	defer d.wg.Done()
+	for j := range q.jobs {
+		d.deliver(q, j)
+	}
+}
+
+// deliver attempts a delivery until it succeeds, fails for good or the
+// dispatcher is closed.
+func (d *Dispatcher) deliver(q *endpointQueue, j job) {
+	backoff := d.cfg.InitialBackoff
+	var err error
+	attempt := 0
+retry:
+	for {
+		attempt++
+		err = d.post(q, j)
+		if err == nil {
+			break
+		}
+		if d.cfg.OnError != nil {
+			d.cfg.OnError(q.URL, j.payload, err)
+		}
+		if attempt >= d.cfg.MaxAttempts || !retryable(err) {
+			break
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-d.closing:
+			// don't hold Close up, the retry can be replayed
+			t.Stop()
+			break retry
+		}
+		backoff *= 2
+		if backoff > d.cfg.MaxBackoff {
+			backoff = d.cfg.MaxBackoff
+		}
+	}
+	d.finish(q, j, attempt, err)
+}
+
+// finish writes a delivery that failed for good to the dead-letter queue.
+// A replayed one takes the place of its entry, which is removed if the
+// delivery succeeded.
+func (d *Dispatcher) finish(q *endpointQueue, j job, attempts int, err error) {
+	var dl *DeadLetter
+	if err != nil {
+		dl = &DeadLetter{
+			URL:       q.URL,
+			Payload:   *j.payload,
+			Attempts:  attempts,
+			LastError: err.Error(),
+			FailedAt:  d.cfg.Now().UTC(),
+		}
+	}
+	switch {
+	case j.replay != nil:
+		err = j.replay.queue.done(j.replay.entry, dl)
+	case dl != nil && d.cfg.DeadLetter != nil:
+		err = d.cfg.DeadLetter.add(*dl)
+	default:
+		err = nil
+	}
+	if err != nil && d.cfg.OnError != nil {
+		d.cfg.OnError(q.URL, j.payload, err)
+	}
+}
+
+func (d *Dispatcher) post(q *endpointQueue, j job) error {
+	req, err := http.NewRequest(http.MethodPost, q.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(d.cfg.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderDelivery, j.payload.ID)
+	req.Header.Set(HeaderEvent, j.payload.Event.Kind.String())
+	if q.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(q.Secret, ts, j.body))
+	}
+	for k, v := range q.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := d.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(snippet)}
+	}
+	return nil
+}
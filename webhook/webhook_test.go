@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/events"
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchSigned(t *testing.T) {
+	var mu sync.Mutex
+	var got []Payload
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !Verify("s3cret", r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp), body) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var p Payload
+		json.Unmarshal(body, &p)
+		assert.Equal(t, p.ID, r.Header.Get(HeaderDelivery))
+		mu.Lock()
+		got = append(got, p)
+		mu.Unlock()
+	}))
+	defer sv.Close()
+
+	d := New(Config{Endpoints: []Endpoint{{
+		URL:    sv.URL,
+		Secret: "s3cret",
+		Kinds:  []events.Kind{events.Received},
+	}}})
+	ctx := context.Background()
+	assert.NoError(t, d.DispatchTransfer(ctx, events.Received, walletrpc.Transfer{TxID: "a", Amount: 5}))
+	assert.NoError(t, d.Dispatch(ctx, events.Event{Kind: events.Sent}))
+	assert.NoError(t, d.Close())
+	assert.Equal(t, ErrClosed, d.Dispatch(ctx, events.Event{Kind: events.Received}))
+
+	assert.Len(t, got, 1)
+	assert.Equal(t, "a", got[0].Event.Transfer.TxID)
+	assert.Equal(t, events.Received, got[0].Event.Kind)
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	var broken int32 = 1
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&broken) == 1 {
+			http.Error(w, "nope", http.StatusBadRequest)
+		}
+	}))
+	defer rejecting.Close()
+
+	dlq, err := OpenDeadLetterQueue(filepath.Join(t.TempDir(), "dead.jsonl"))
+	assert.NoError(t, err)
+	cfg := Config{
+		Endpoints:      []Endpoint{{URL: flaky.URL}, {URL: rejecting.URL}},
+		InitialBackoff: time.Millisecond,
+		DeadLetter:     dlq,
+	}
+	d := New(cfg)
+	assert.NoError(t, d.Dispatch(context.Background(), events.Event{Kind: events.Confirmed}))
+	assert.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// 4xx are not retried
+	dead, err := dlq.List()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, rejecting.URL, dead[0].URL)
+	assert.Equal(t, 1, dead[0].Attempts)
+	assert.Contains(t, dead[0].LastError, "400")
+
+	// replay once the endpoint is fixed, only to the failed endpoint; the
+	// delivery for a removed endpoint stays
+	assert.NoError(t, dlq.add(DeadLetter{URL: "http://removed", Payload: dead[0].Payload}))
+	atomic.StoreInt32(&broken, 0)
+	d = New(cfg)
+	n, err := dlq.Replay(context.Background(), d, nil)
+	assert.True(t, errors.Is(err, ErrNoEndpoint))
+	assert.Equal(t, 1, n)
+	assert.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	dead, err = dlq.List()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "http://removed", dead[0].URL)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var inflight, max int32
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+	}))
+	defer sv.Close()
+
+	d := New(Config{Endpoints: []Endpoint{{URL: sv.URL, MaxConcurrency: 2}}})
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, d.Dispatch(context.Background(), events.Event{Kind: events.Received}))
+	}
+	assert.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestCloseAbortsRetries(t *testing.T) {
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer sv.Close()
+	dlq, err := OpenDeadLetterQueue(filepath.Join(t.TempDir(), "dead.jsonl"))
+	assert.NoError(t, err)
+	d := New(Config{
+		Endpoints:      []Endpoint{{URL: sv.URL}},
+		InitialBackoff: time.Hour,
+		DeadLetter:     dlq,
+	})
+	assert.NoError(t, d.Dispatch(context.Background(), events.Event{Kind: events.Failed}))
+	assert.NoError(t, d.Close())
+	dead, err := dlq.List()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+}
+
+func TestReplayKeepsEntries(t *testing.T) {
+	release := make(chan struct{})
+	var status int32 = http.StatusBadRequest
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer sv.Close()
+	dlq, err := OpenDeadLetterQueue(filepath.Join(t.TempDir(), "dead.jsonl"))
+	assert.NoError(t, err)
+	failedAt := time.Unix(1, 0).UTC()
+	assert.NoError(t, dlq.add(DeadLetter{URL: sv.URL, Payload: Payload{ID: "p", Event: events.Event{Kind: events.Received}}, Attempts: 3, FailedAt: failedAt}))
+	cfg := Config{Endpoints: []Endpoint{{URL: sv.URL}}, DeadLetter: dlq}
+
+	// the entry stays until the delivery is over, and isn't replayed twice
+	d := New(cfg)
+	n, err := dlq.Replay(context.Background(), d, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = dlq.Replay(context.Background(), d, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	dead, err := dlq.List()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+
+	// failing again replaces it
+	close(release)
+	assert.NoError(t, d.Shutdown(context.Background()))
+	dead, err = dlq.List()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 1, dead[0].Attempts)
+	assert.Contains(t, dead[0].LastError, "400")
+
+	// delivered, it's removed
+	atomic.StoreInt32(&status, http.StatusOK)
+	d = New(cfg)
+	n, err = dlq.Replay(context.Background(), d, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, d.Shutdown(context.Background()))
+	dead, err = dlq.List()
+	assert.NoError(t, err)
+	assert.Empty(t, dead)
+}
+
+func TestShutdownFullQueue(t *testing.T) {
+	release := make(chan struct{})
+	sv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer sv.Close()
+	d := New(Config{Endpoints: []Endpoint{{URL: sv.URL, MaxConcurrency: 1, QueueSize: 1}}})
+
+	// one delivery in flight, one queued and one dispatch waiting
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { errs <- d.Dispatch(context.Background(), events.Event{Kind: events.Received}) }()
+	}
+	assert.NoError(t, <-errs)
+	assert.NoError(t, <-errs)
+	time.Sleep(20 * time.Millisecond)
+
+	shutdown := make(chan error)
+	go func() { shutdown <- d.Shutdown(context.Background()) }()
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch still waiting")
+	}
+	close(release)
+	assert.NoError(t, <-shutdown)
+}
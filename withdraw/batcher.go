@@ -0,0 +1,466 @@
+// Package withdraw batches user withdrawals into multi-destination
+// transfers.
+//
+// Sending one transfer per withdrawal pays a fee per transaction and locks
+// the change output for 10 blocks each time. A Batcher collects the
+// withdrawals for a time window (or until a batch is full), sends them with
+// a single TransferSplit and maps the resulting transactions back to the
+// individual withdrawals.
+package withdraw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+)
+
+// ErrOutcomeUnknown is wrapped in the Result of withdrawals sent in a
+// batch that reached the wallet but failed without an answer, or with an
+// error the wallet may raise after relaying some of the transactions: the
+// transfer may have been relayed, so it isn't retried.
+var ErrOutcomeUnknown = errors.New("withdraw: transfer outcome unknown")
+
+// Wallet is the subset of *walletrpc.Client used by the Batcher.
+type Wallet interface {
+	GetBalance() (uint64, uint64, error)
+	TransferSplit(req walletrpc.TransferRequest) (walletrpc.TransferSplitResponse, error)
+}
+
+// Withdrawal is a payment requested by a user.
+type Withdrawal struct {
+	// ID identifies the withdrawal in the results.
+	ID      string
+	Address string
+	// Amount in atomic units
+	Amount uint64
+}
+
+// Result is the outcome of a withdrawal.
+type Result struct {
+	Withdrawal
+	// TxHashes of the transactions paying the withdrawal. It's usually
+	// one, but the wallet may split a large amount over several.
+	TxHashes []string
+	// Fee is the share of the transaction fees charged to the withdrawal.
+	Fee uint64
+	// Err is set when the withdrawal failed for good.
+	Err error
+}
+
+// Config holds the configuration of a Batcher.
+type Config struct {
+	Wallet Wallet
+	// Window is the time withdrawals are collected before being sent.
+	// Defaults to one minute.
+	Window time.Duration
+	// MaxBatch is the number of destinations sent at once, defaults to 15
+	// (monero transactions have at most 16 outputs, change included).
+	MaxBatch int
+	// MaxRequeues is the number of times a withdrawal is put back in the
+	// queue for lack of unlocked balance before it fails. Zero means forever.
+	MaxRequeues int
+
+	AccountIndex uint64
+	Priority     walletrpc.Priority
+	RingSize     uint64
+
+	// OnResult is called for every withdrawal that was sent or failed.
+	OnResult func(Result)
+	// OnError is called when a batch could not be sent and was requeued.
+	OnError func(error)
+}
+
+type queued struct {
+	Withdrawal
+	requeues int
+}
+
+// Batcher collects withdrawals and sends them in batches.
+type Batcher struct {
+	cfg Config
+
+	mu     sync.Mutex
+	queue  []queued
+	oldest time.Time
+	full   chan struct{}
+	// limit (optional) is the size of the next batch, after a failed one
+	limit int
+	// serializes flushes
+	flushMu sync.Mutex
+}
+
+// New returns a Batcher for the configuration.
+func New(cfg Config) *Batcher {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 15
+	}
+	return &Batcher{
+		cfg:  cfg,
+		full: make(chan struct{}, 1),
+	}
+}
+
+// Submit validates a withdrawal and queues it for the next batch.
+func (b *Batcher) Submit(w Withdrawal) error {
+	if w.Amount == 0 {
+		return errors.New("withdraw: amount must be positive")
+	}
+	if err := walletrpc.ValidateAddress(w.Address); err != nil {
+		return fmt.Errorf("withdraw: %v: %v", w.Address, err)
+	}
+	b.mu.Lock()
+	if len(b.queue) == 0 {
+		b.oldest = time.Now()
+	}
+	b.queue = append(b.queue, queued{Withdrawal: w})
+	n := len(b.queue)
+	b.mu.Unlock()
+	if n >= b.cfg.MaxBatch {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of queued withdrawals.
+func (b *Batcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queue)
+}
+
+// Run sends a batch whenever the window of the oldest queued withdrawal
+// elapsed or a batch is full, until the context is done.
+func (b *Batcher) Run(ctx context.Context) error {
+	timer := time.NewTimer(b.cfg.Window)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.full:
+		case <-timer.C:
+		}
+		b.mu.Lock()
+		due := len(b.queue) >= b.cfg.MaxBatch || len(b.queue) > 0 && time.Since(b.oldest) >= b.cfg.Window
+		b.mu.Unlock()
+		if due {
+			b.Flush()
+		}
+
+		b.mu.Lock()
+		wait := b.cfg.Window
+		if len(b.queue) > 0 {
+			wait = b.cfg.Window - time.Since(b.oldest)
+			if wait <= 0 || len(b.queue) >= b.cfg.MaxBatch {
+				// leftovers of a requeued batch: wait a full window
+				b.oldest = time.Now()
+				wait = b.cfg.Window
+			}
+		}
+		b.mu.Unlock()
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Flush sends the queued withdrawals now, in batches of at most MaxBatch,
+// until the queue is empty or the unlocked balance is exhausted.
+func (b *Batcher) Flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	_, unlocked, err := b.cfg.Wallet.GetBalance()
+	if err != nil {
+		b.report(err)
+		return
+	}
+
+	for {
+		batch, rest, expired := b.take(unlocked)
+		b.results(expired)
+		if len(batch) == 0 {
+			if rest > 0 {
+				b.report(fmt.Errorf("withdraw: %v withdrawals wait for unlocked balance", rest))
+			}
+			return
+		}
+		sent, more := b.send(batch)
+		if !more {
+			return
+		}
+		if sent >= unlocked {
+			unlocked = 0
+		} else {
+			unlocked -= sent
+		}
+	}
+}
+
+// take removes from the queue the first withdrawals whose total fits in
+// the unlocked balance and returns them with the number left behind. The
+// fee isn't known before the wallet builds the transactions: a batch that
+// leaves too little for it fails, and the next one is smaller.
+func (b *Batcher) take(unlocked uint64) (batch []queued, rest int, expired []Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	max := b.cfg.MaxBatch
+	if b.limit > 0 {
+		max, b.limit = b.limit, 0
+	}
+	var total uint64
+	var keep []queued
+	for _, q := range b.queue {
+		if len(batch) < max && total+q.Amount <= unlocked {
+			total += q.Amount
+			batch = append(batch, q)
+			continue
+		}
+		keep = append(keep, q)
+	}
+	b.queue = keep
+	if len(keep) > 0 && len(batch) == 0 {
+		// nothing fits, count the failed attempt
+		for i := range b.queue {
+			b.queue[i].requeues++
+		}
+		expired = b.expireLocked()
+	}
+	return batch, len(b.queue), expired
+}
+
+// send submits one batch and reports the results. It returns the amount
+// sent, fees included, and whether to go on with the next batch.
+func (b *Batcher) send(batch []queued) (uint64, bool) {
+	req := walletrpc.TransferRequest{
+		AccountIndex: b.cfg.AccountIndex,
+		Priority:     b.cfg.Priority,
+		RingSize:     b.cfg.RingSize,
+	}
+	for _, q := range batch {
+		req.Destinations = append(req.Destinations, walletrpc.Destination{
+			Address: q.Address,
+			Amount:  q.Amount,
+		})
+	}
+
+	resp, err := b.cfg.Wallet.TransferSplit(req)
+	if err != nil {
+		return 0, b.failed(batch, err)
+	}
+
+	var total uint64
+	for _, fee := range resp.FeeList {
+		total += fee
+	}
+	for _, a := range resp.AmountList {
+		total += a
+	}
+	b.results(splitResults(batch, resp))
+	return total, true
+}
+
+// failed handles a batch the wallet refused and reports whether to go on
+// with the next batch. A batch that didn't reach the wallet is put back in
+// the queue as is. Errors caused by a destination split the batch in two,
+// so that a bad withdrawal ends up alone and fails on its own. Insufficient
+// funds, the fee not being counted in the batch, put the batch back in the
+// queue and halve the next one, as do other wallet errors.
+func (b *Batcher) failed(batch []queued, err error) bool {
+	b.report(err)
+	iswerr, werr := walletrpc.GetWalletError(err)
+	switch {
+	case walletrpc.IsNotSent(err):
+		b.requeue(batch)
+		return false
+	case !iswerr || !insufficientFunds(werr) && mayBeRelayed(werr):
+		results := make([]Result, len(batch))
+		for i, q := range batch {
+			results[i] = Result{
+				Withdrawal: q.Withdrawal,
+				Err:        fmt.Errorf("%w: %v", ErrOutcomeUnknown, err),
+			}
+		}
+		b.results(results)
+		return false
+	case insufficientFunds(werr) || !destinationError(werr):
+		for i := range batch {
+			batch[i].requeues++
+		}
+		b.results(b.requeue(batch))
+		b.mu.Lock()
+		b.limit = len(batch) / 2
+		b.mu.Unlock()
+		return false
+	case len(batch) == 1:
+		b.results([]Result{{Withdrawal: batch[0].Withdrawal, Err: err}})
+		return true
+	}
+	b.requeue(batch)
+	b.mu.Lock()
+	b.limit = len(batch) / 2
+	b.mu.Unlock()
+	return true
+}
+
+// requeue puts a batch back at the front of the queue and returns the
+// withdrawals that were requeued too many times.
+func (b *Batcher) requeue(batch []queued) []Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queue = append(append([]queued(nil), batch...), b.queue...)
+	return b.expireLocked()
+}
+
+// expireLocked removes the withdrawals requeued too many times from the
+// queue.
+func (b *Batcher) expireLocked() (expired []Result) {
+	if b.cfg.MaxRequeues <= 0 {
+		return nil
+	}
+	keep := b.queue[:0]
+	for _, q := range b.queue {
+		if q.requeues > b.cfg.MaxRequeues {
+			expired = append(expired, Result{
+				Withdrawal: q.Withdrawal,
+				Err:        fmt.Errorf("withdraw: gave up after %v attempts", q.requeues),
+			})
+			continue
+		}
+		keep = append(keep, q)
+	}
+	b.queue = keep
+	return expired
+}
+
+func (b *Batcher) results(results []Result) {
+	if b.cfg.OnResult == nil {
+		return
+	}
+	for _, r := range results {
+		b.cfg.OnResult(r)
+	}
+}
+
+func (b *Batcher) report(err error) {
+	if b.cfg.OnError != nil {
+		b.cfg.OnError(err)
+	}
+}
+
+// splitResults maps the transactions of a TransferSplit back to the
+// withdrawals. The wallet fills the transactions with the destinations in
+// order, splitting a destination over two transactions when needed, so
+// the amounts are matched in order. Each transaction's fee is shared
+// equally by its destinations: it depends on the number of outputs, not
+// on the amounts.
+func splitResults(batch []queued, resp walletrpc.TransferSplitResponse) []Result {
+	results := make([]Result, len(batch))
+	for i, q := range batch {
+		results[i].Withdrawal = q.Withdrawal
+	}
+
+	// members[t] are the indexes of the withdrawals paid by transaction t
+	members := make([][]int, len(resp.TxHashList))
+	d, left := 0, uint64(0)
+	if len(batch) > 0 {
+		left = batch[0].Amount
+	}
+	for t := range resp.TxHashList {
+		var room uint64
+		if t < len(resp.AmountList) {
+			room = resp.AmountList[t]
+		}
+		for room > 0 && d < len(batch) {
+			members[t] = append(members[t], d)
+			if left > room {
+				left -= room
+				room = 0
+				continue
+			}
+			room -= left
+			d++
+			if d < len(batch) {
+				left = batch[d].Amount
+			}
+		}
+		if len(members[t]) == 0 && d < len(batch) {
+			// no amounts reported: assume one transaction for the lot
+			for i := d; i < len(batch); i++ {
+				members[t] = append(members[t], i)
+			}
+			d = len(batch)
+		}
+	}
+
+	for t, idx := range members {
+		if len(idx) == 0 {
+			continue
+		}
+		var fee uint64
+		if t < len(resp.FeeList) {
+			fee = resp.FeeList[t]
+		}
+		share, extra := fee/uint64(len(idx)), fee%uint64(len(idx))
+		for n, i := range idx {
+			results[i].TxHashes = append(results[i].TxHashes, resp.TxHashList[t])
+			results[i].Fee += share
+			if uint64(n) < extra {
+				results[i].Fee++
+			}
+		}
+	}
+	return results
+}
+
+// insufficientFunds reports whether the wallet refused a transfer for lack
+// of (unlocked) balance. Wallets older than v0.12 report it as a generic
+// transfer error.
+func insufficientFunds(werr *walletrpc.WalletError) bool {
+	switch werr.Code {
+	case walletrpc.ErrNotEnoughMoney, walletrpc.ErrNotEnoughUnlockedMoney:
+		return true
+	}
+	return werr.Code == walletrpc.ErrGenericTransferError &&
+		strings.Contains(strings.ToLower(werr.Message), "not enough")
+}
+
+// destinationError reports whether an error may be caused by some of the
+// destinations only, or by their number (transaction too large).
+func destinationError(werr *walletrpc.WalletError) bool {
+	switch werr.Code {
+	case walletrpc.ErrWrongAddress, walletrpc.ErrWrongPaymentID, walletrpc.ErrTxTooLarge,
+		walletrpc.ErrZeroDestination, walletrpc.ErrZeroAmount:
+		return true
+	}
+	return false
+}
+
+// mayBeRelayed reports whether the wallet may have relayed some of the
+// transactions of a transfer failing with the error. transfer_split
+// commits the transactions one by one, and a rejection by the daemon or a
+// failure to reach it past the first one is reported as one of these,
+// though the ones before are already relayed. The wallet may split any
+// batch, so it can't be told from the number of destinations.
+func mayBeRelayed(werr *walletrpc.WalletError) bool {
+	switch werr.Code {
+	case walletrpc.ErrTxNotPossible, walletrpc.ErrGenericTransferError:
+		return true
+	}
+	return false
+}
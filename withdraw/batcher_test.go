@@ -0,0 +1,287 @@
+package withdraw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibclabs/go-monero/walletrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAddress = "44AFFq5kSiGBoZ4NMDwYtN18obc8AemS33DBLWs3H7otXft3XjrpDtQGv7SqSsaBYBb98uNbr2VBBEt7f2wfn3RVGQBEP3A"
+
+// testWallet splits the destinations in transactions of at most perTx,
+// each paying fee.
+type testWallet struct {
+	mu       sync.Mutex
+	unlocked uint64
+	perTx    int
+	fee      uint64
+	fail     func(req walletrpc.TransferRequest) error
+	requests []walletrpc.TransferRequest
+	txs      int
+}
+
+func (w *testWallet) GetBalance() (uint64, uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.unlocked, w.unlocked, nil
+}
+
+func (w *testWallet) TransferSplit(req walletrpc.TransferRequest) (resp walletrpc.TransferSplitResponse, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.requests = append(w.requests, req)
+	if w.fail != nil {
+		if err = w.fail(req); err != nil {
+			return
+		}
+	}
+	for i := 0; i < len(req.Destinations); i += w.perTx {
+		var amount uint64
+		for j := i; j < i+w.perTx && j < len(req.Destinations); j++ {
+			amount += req.Destinations[j].Amount
+		}
+		w.txs++
+		resp.TxHashList = append(resp.TxHashList, fmt.Sprintf("tx%v", w.txs))
+		resp.AmountList = append(resp.AmountList, amount)
+		resp.FeeList = append(resp.FeeList, w.fee)
+		w.unlocked -= amount + w.fee
+	}
+	return
+}
+
+type collector struct {
+	mu      sync.Mutex
+	results map[string]Result
+}
+
+func (c *collector) add(r Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil {
+		c.results = make(map[string]Result)
+	}
+	c.results[r.ID] = r
+}
+
+func (c *collector) get(id string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.results[id]
+	return r, ok
+}
+
+func submit(t *testing.T, b *Batcher, n int, amount uint64) {
+	for i := 0; i < n; i++ {
+		err := b.Submit(Withdrawal{ID: fmt.Sprintf("w%v", b.Pending()), Address: testAddress, Amount: amount})
+		assert.NoError(t, err)
+	}
+}
+
+func TestBatcherFlush(t *testing.T) {
+	w := &testWallet{unlocked: 1e6, perTx: 2, fee: 1000}
+	var c collector
+	b := New(Config{Wallet: w, MaxBatch: 3, OnResult: c.add})
+
+	assert.Error(t, b.Submit(Withdrawal{ID: "bad", Address: "nope", Amount: 1}))
+	assert.Error(t, b.Submit(Withdrawal{ID: "zero", Address: testAddress}))
+	submit(t, b, 4, 100)
+	b.Flush()
+
+	assert.Equal(t, 0, b.Pending())
+	assert.Len(t, w.requests, 2)
+	assert.Len(t, w.requests[0].Destinations, 3)
+	assert.Len(t, w.requests[1].Destinations, 1)
+
+	// the first batch was split in tx1 (w0, w1) and tx2 (w2)
+	r, _ := c.get("w0")
+	assert.Equal(t, []string{"tx1"}, r.TxHashes)
+	assert.Equal(t, uint64(500), r.Fee)
+	r, _ = c.get("w2")
+	assert.Equal(t, []string{"tx2"}, r.TxHashes)
+	assert.Equal(t, uint64(1000), r.Fee)
+	r, _ = c.get("w3")
+	assert.Equal(t, []string{"tx3"}, r.TxHashes)
+	assert.NoError(t, r.Err)
+}
+
+func TestSplitResults(t *testing.T) {
+	batch := []queued{
+		{Withdrawal: Withdrawal{ID: "a", Amount: 10}},
+		{Withdrawal: Withdrawal{ID: "b", Amount: 30}},
+		{Withdrawal: Withdrawal{ID: "c", Amount: 5}},
+	}
+	// b is split over both transactions
+	results := splitResults(batch, walletrpc.TransferSplitResponse{
+		TxHashList: []string{"t1", "t2"},
+		AmountList: []uint64{25, 20},
+		FeeList:    []uint64{7, 4},
+	})
+	assert.Equal(t, []string{"t1"}, results[0].TxHashes)
+	assert.Equal(t, uint64(4), results[0].Fee)
+	assert.Equal(t, []string{"t1", "t2"}, results[1].TxHashes)
+	assert.Equal(t, uint64(3+2), results[1].Fee)
+	assert.Equal(t, []string{"t2"}, results[2].TxHashes)
+	assert.Equal(t, uint64(2), results[2].Fee)
+}
+
+func TestBatcherInsufficientBalance(t *testing.T) {
+	w := &testWallet{unlocked: 250, perTx: 16, fee: 10}
+	var c collector
+	b := New(Config{Wallet: w, MaxRequeues: 1, OnResult: c.add})
+	submit(t, b, 3, 100)
+
+	// the unlocked balance covers two withdrawals, but not the fee
+	w.fail = func(req walletrpc.TransferRequest) error {
+		return &walletrpc.WalletError{Code: walletrpc.ErrGenericTransferError, Message: "not enough unlocked money"}
+	}
+	b.Flush()
+	assert.Len(t, w.requests, 1)
+	assert.Len(t, w.requests[0].Destinations, 2)
+	assert.Equal(t, 3, b.Pending())
+
+	w.fail = nil
+	w.unlocked = 220
+	b.Flush()
+	assert.Equal(t, 1, b.Pending())
+	_, ok := c.get("w0")
+	assert.True(t, ok)
+
+	// w2 can't be paid anymore and gives up
+	b.Flush()
+	b.Flush()
+	assert.Equal(t, 0, b.Pending())
+	r, _ := c.get("w2")
+	assert.Error(t, r.Err)
+}
+
+func TestBatcherFee(t *testing.T) {
+	w := &testWallet{unlocked: 300, perTx: 16, fee: 10}
+	w.fail = func(req walletrpc.TransferRequest) error {
+		var total uint64
+		for _, d := range req.Destinations {
+			total += d.Amount
+		}
+		if total+w.fee > w.unlocked {
+			return &walletrpc.WalletError{Code: walletrpc.ErrNotEnoughMoney, Message: "not enough money"}
+		}
+		return nil
+	}
+	var c collector
+	b := New(Config{Wallet: w, OnResult: c.add})
+	submit(t, b, 3, 100)
+
+	// the batch fits in the unlocked balance, but not with the fee
+	b.Flush()
+	assert.Len(t, w.requests[0].Destinations, 3)
+	assert.Equal(t, 3, b.Pending())
+
+	// the next one is smaller
+	b.Flush()
+	assert.Len(t, w.requests[1].Destinations, 1)
+	assert.Len(t, w.requests[2].Destinations, 1)
+	assert.Equal(t, 1, b.Pending())
+	r, _ := c.get("w1")
+	assert.NoError(t, r.Err)
+}
+
+func TestBatcherBadDestination(t *testing.T) {
+	w := &testWallet{unlocked: 1e6, perTx: 16}
+	var c collector
+	b := New(Config{Wallet: w, OnResult: c.add})
+	submit(t, b, 5, 100)
+	b.queue[3].Address = "bad"
+	w.fail = func(req walletrpc.TransferRequest) error {
+		for _, d := range req.Destinations {
+			if d.Address == "bad" {
+				return &walletrpc.WalletError{Code: walletrpc.ErrWrongAddress, Message: "WALLET_RPC_ERROR_CODE_WRONG_ADDRESS"}
+			}
+		}
+		return nil
+	}
+	b.Flush()
+	assert.Equal(t, 0, b.Pending())
+	for i := 0; i < 5; i++ {
+		r, ok := c.get(fmt.Sprintf("w%v", i))
+		assert.True(t, ok)
+		if i == 3 {
+			assert.Error(t, r.Err)
+		} else {
+			assert.NoError(t, r.Err)
+			assert.Len(t, r.TxHashes, 1)
+		}
+	}
+}
+
+func TestBatcherTransportError(t *testing.T) {
+	w := &testWallet{unlocked: 1e6, perTx: 16}
+	w.fail = func(req walletrpc.TransferRequest) error { return errors.New("connection reset") }
+	var c collector
+	b := New(Config{Wallet: w, OnResult: c.add})
+	submit(t, b, 2, 100)
+	b.Flush()
+	assert.Equal(t, 0, b.Pending())
+	r, _ := c.get("w1")
+	assert.True(t, errors.Is(r.Err, ErrOutcomeUnknown))
+
+	// the wallet couldn't be reached, the batch is sent again
+	w.fail = func(req walletrpc.TransferRequest) error {
+		return &walletrpc.TransportError{Method: "transfer_split", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	}
+	submit(t, b, 2, 100)
+	b.Flush()
+	assert.Equal(t, 2, b.Pending())
+	w.fail = func(req walletrpc.TransferRequest) error {
+		return &walletrpc.WalletError{Code: walletrpc.ErrDaemonIsBusy, Message: "daemon is busy"}
+	}
+	b.Flush()
+	assert.Equal(t, 2, b.Pending())
+	w.fail = nil
+	b.Flush()
+	assert.Equal(t, 0, b.Pending())
+	r, _ = c.get("w1")
+	assert.NoError(t, r.Err)
+	w.requests = nil
+
+	// the wallet may have relayed the first transactions before failing
+	w.fail = func(req walletrpc.TransferRequest) error {
+		return &walletrpc.WalletError{Code: walletrpc.ErrTxNotPossible, Message: "transaction was rejected by daemon"}
+	}
+	submit(t, b, 2, 100)
+	b.Flush()
+	assert.Equal(t, 0, b.Pending())
+	assert.Len(t, w.requests, 1)
+	r, _ = c.get("w0")
+	assert.True(t, errors.Is(r.Err, ErrOutcomeUnknown))
+}
+
+func TestBatcherRun(t *testing.T) {
+	w := &testWallet{unlocked: 1e6, perTx: 16}
+	done := make(chan Result, 10)
+	b := New(Config{
+		Wallet:   w,
+		Window:   time.Hour,
+		MaxBatch: 2,
+		OnResult: func(r Result) { done <- r },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+
+	// a full batch doesn't wait for the window
+	submit(t, b, 2, 100)
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-done:
+			assert.NoError(t, r.Err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("batch not sent")
+		}
+	}
+}